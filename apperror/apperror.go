@@ -0,0 +1,141 @@
+// Package apperror is the error model shared by HTTP and gRPC handlers. Domain code returns an
+// *Error with a Code, and middleware.ErrorHandler and the grpcserver interceptors map the code to
+// the status of the transport, so handlers do not depend on echo or grpc.
+package apperror
+
+import (
+	"errors"
+	"maps"
+	"slices"
+)
+
+type Code string
+
+const (
+	CodeNotFound        Code = "NOT_FOUND"
+	CodeInvalidArgument Code = "INVALID_ARGUMENT"
+	CodeConflict        Code = "CONFLICT"
+	CodeUnauthorized    Code = "UNAUTHORIZED"
+	CodeInternal        Code = "INTERNAL"
+)
+
+// internalMessage replaces the text of causes in Internal errors, which is not meant for clients.
+const internalMessage = "internal error"
+
+// FieldError tells why the value of a request field is invalid.
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Param   string `json:"param,omitempty"`
+	Message string `json:"message"`
+}
+
+// Error is an application error. Message, Details and Fields are returned to clients, Cause is
+// only logged.
+type Error struct {
+	Code    Code
+	Message string
+	Details map[string]any
+	Fields  []FieldError
+	Cause   error
+}
+
+func New(code Code, message string) *Error {
+	return &Error{Code: code, Message: message, Details: nil, Fields: nil, Cause: nil}
+}
+
+// Wrap returns an error of code caused by err.
+func Wrap(err error, code Code, message string) *Error {
+	return &Error{Code: code, Message: message, Details: nil, Fields: nil, Cause: err}
+}
+
+func NotFound(message string) *Error {
+	return New(CodeNotFound, message)
+}
+
+func InvalidArgument(message string) *Error {
+	return New(CodeInvalidArgument, message)
+}
+
+func Conflict(message string) *Error {
+	return New(CodeConflict, message)
+}
+
+func Unauthorized(message string) *Error {
+	return New(CodeUnauthorized, message)
+}
+
+// Internal wraps an unexpected error. Its text stays out of the message returned to clients.
+func Internal(err error) *Error {
+	return Wrap(err, CodeInternal, internalMessage)
+}
+
+func (e *Error) Error() string {
+	if e.Cause == nil {
+		return string(e.Code) + ": " + e.Message
+	}
+
+	return string(e.Code) + ": " + e.Message + ": " + e.Cause.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Cause
+}
+
+// Is matches errors of the same code, so errors.Is(err, apperror.NotFound("")) tells whether err
+// is a not found error whatever its message.
+func (e *Error) Is(target error) bool {
+	var appErr *Error
+	if !errors.As(target, &appErr) {
+		return false
+	}
+
+	return e.Code == appErr.Code
+}
+
+// WithDetail returns a copy of the error with the detail set.
+func (e *Error) WithDetail(key string, value any) *Error {
+	copied := *e
+	copied.Details = maps.Clone(e.Details)
+
+	if copied.Details == nil {
+		copied.Details = make(map[string]any)
+	}
+
+	copied.Details[key] = value
+
+	return &copied
+}
+
+// WithFields returns a copy of the error with fields added to its field errors.
+func (e *Error) WithFields(fields ...FieldError) *Error {
+	copied := *e
+	copied.Fields = append(slices.Clone(e.Fields), fields...)
+
+	return &copied
+}
+
+// As returns the first *Error in the chain of err. Other errors are wrapped as Internal, so
+// transports can map any error.
+func As(err error) *Error {
+	if err == nil {
+		return nil
+	}
+
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		return appErr
+	}
+
+	return Internal(err)
+}
+
+// CodeOf returns the code of err, CodeInternal when err is not an application error and empty
+// when err is nil.
+func CodeOf(err error) Code {
+	if appErr := As(err); appErr != nil {
+		return appErr.Code
+	}
+
+	return ""
+}
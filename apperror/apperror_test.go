@@ -0,0 +1,78 @@
+package apperror_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/thienhaole92/uframework/apperror"
+)
+
+var errDatabase = errors.New("connection refused")
+
+func TestError(t *testing.T) {
+	t.Parallel()
+
+	err := apperror.Wrap(errDatabase, apperror.CodeConflict, "order already exists")
+
+	require.Equal(t, "CONFLICT: order already exists: connection refused", err.Error())
+	require.Equal(t, "NOT_FOUND: order not found", apperror.NotFound("order not found").Error())
+	require.ErrorIs(t, err, errDatabase)
+
+	// Errors match by code, also when wrapped.
+	wrapped := fmt.Errorf("create order: %w", err)
+	require.ErrorIs(t, wrapped, apperror.Conflict(""))
+	require.NotErrorIs(t, wrapped, apperror.NotFound(""))
+}
+
+func TestError_WithDetail(t *testing.T) {
+	t.Parallel()
+
+	base := apperror.InvalidArgument("invalid order")
+	detailed := base.WithDetail("field", "amount")
+	both := detailed.WithDetail("rule", "gt")
+
+	require.Nil(t, base.Details)
+	require.Equal(t, map[string]any{"field": "amount"}, detailed.Details)
+	require.Equal(t, map[string]any{"field": "amount", "rule": "gt"}, both.Details)
+
+	amount := apperror.FieldError{Field: "amount", Rule: "gt", Param: "0", Message: "amount must be greater than 0"}
+	withFields := base.WithFields(amount)
+
+	require.Nil(t, base.Fields)
+	require.Equal(t, []apperror.FieldError{amount}, withFields.Fields)
+}
+
+func TestAs(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		err     error
+		code    apperror.Code
+		message string
+	}{
+		{"nil", nil, "", ""},
+		{"application", fmt.Errorf("get: %w", apperror.Unauthorized("token expired")), apperror.CodeUnauthorized, "token expired"},
+		{"other", errDatabase, apperror.CodeInternal, "internal error"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			require.Equal(t, tt.code, apperror.CodeOf(tt.err))
+
+			appErr := apperror.As(tt.err)
+			if tt.err == nil {
+				require.Nil(t, appErr)
+
+				return
+			}
+
+			require.Equal(t, tt.message, appErr.Message)
+			require.ErrorIs(t, appErr, tt.err)
+		})
+	}
+}
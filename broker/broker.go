@@ -0,0 +1,122 @@
+// Package broker decouples publishing and subscribing code from the message broker, so that the
+// Redis streams of redispub and redissub can be swapped for Kafka, or for an in-process GoChannel in
+// tests and single-binary deployments.
+package broker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/thienhaole92/uframework/redispub"
+	"github.com/thienhaole92/uframework/redissub"
+)
+
+var ErrUnknownDriver = errors.New("unknown broker driver")
+
+// Publisher publishes messages to topics. It is implemented by redispub.RedisPublisher,
+// KafkaPublisher and GoChannel.
+type Publisher interface {
+	Publish(ctx context.Context, topic string, messages ...*message.Message) error
+}
+
+// Subscriber delivers the messages of topics to handlers. It is implemented by
+// redissub.MultiSubscriber, KafkaSubscriber and GoChannel.
+type Subscriber interface {
+	Subscribe(topic string, handler redissub.MessageHandler) error
+	Unsubscribe(topic string) error
+	Close() error
+}
+
+var (
+	_ Publisher  = (*redispub.RedisPublisher)(nil)
+	_ Subscriber = (*redissub.MultiSubscriber)(nil)
+	_ Publisher  = (*GoChannel)(nil)
+	_ Subscriber = (*GoChannel)(nil)
+)
+
+type Driver string
+
+const (
+	DriverRedis     Driver = "redis"
+	DriverKafka     Driver = "kafka"
+	DriverGoChannel Driver = "gochannel"
+)
+
+type Config struct {
+	Driver Driver // Defaults to DriverRedis.
+	// ConsumerGroup is the group of Redis and Kafka subscriptions.
+	ConsumerGroup string
+	Publisher     redispub.Options
+	// Subscriber configures Redis subscriptions. Its Retry, DeadLetterTopic and Middlewares also
+	// apply to the other drivers, so handlers behave the same with all of them. Concurrency bounds
+	// the partitions handled at the same time by Kafka, and is ignored by GoChannel, which handles
+	// the messages of a topic one at a time. PartitionKey and the read options are ignored by both:
+	// messages of a Kafka partition, or of a GoChannel topic, are already handled in order, and
+	// Kafka messages are partitioned by Kafka.PartitionKey.
+	Subscriber redissub.Options
+	Kafka      KafkaOptions
+}
+
+// Broker is the publisher and subscriber of the configured driver.
+type Broker struct {
+	Publisher  Publisher
+	Subscriber Subscriber
+}
+
+// New creates the broker selected by cfg.Driver. redisClient is only used by DriverRedis and may be
+// nil otherwise.
+func New(redisClient goredis.UniversalClient, cfg Config) (*Broker, error) {
+	switch cfg.Driver {
+	case DriverRedis, "":
+		if redisClient == nil {
+			return nil, redissub.ErrNilRedisClient
+		}
+
+		publisher, err := redispub.New(redisClient, cfg.Publisher)
+		if err != nil {
+			return nil, err
+		}
+
+		return &Broker{
+			Publisher:  publisher,
+			Subscriber: redissub.NewMultiSubscriber(redisClient, cfg.ConsumerGroup, cfg.Subscriber),
+		}, nil
+	case DriverKafka:
+		return newKafka(cfg)
+	case DriverGoChannel:
+		pubsub := NewGoChannel(cfg.Subscriber)
+
+		return &Broker{Publisher: pubsub, Subscriber: pubsub}, nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownDriver, cfg.Driver)
+	}
+}
+
+func newKafka(cfg Config) (*Broker, error) {
+	publisher, err := NewKafkaPublisher(cfg.Kafka)
+	if err != nil {
+		return nil, err
+	}
+
+	subscriber, err := NewKafkaSubscriber(cfg.ConsumerGroup, cfg.Kafka, cfg.Subscriber)
+	if err != nil {
+		return nil, errors.Join(err, publisher.Close())
+	}
+
+	return &Broker{Publisher: publisher, Subscriber: subscriber}, nil
+}
+
+// Close stops the subscriptions, and the publisher when it holds its own connection. The redis
+// client is shared, so it is not closed.
+func (b *Broker) Close() error {
+	err := b.Subscriber.Close()
+
+	if publisher, ok := b.Publisher.(*KafkaPublisher); ok {
+		err = errors.Join(err, publisher.Close())
+	}
+
+	return err
+}
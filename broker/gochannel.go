@@ -0,0 +1,58 @@
+package broker
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/pubsub/gochannel"
+	"github.com/thienhaole92/uframework/redispub"
+	"github.com/thienhaole92/uframework/redissub"
+)
+
+// GoChannel is an in-process broker built on the watermill GoChannel. Handlers are called as by
+// redissub: with the same middlewares, retries and dead-letter topic, and with the topic and
+// request ID in their context.
+//
+// Nothing is persisted: messages published to a topic without subscription are dropped, and
+// messages not handled yet are lost when the process stops. Messages of a topic are handled one at
+// a time, in order, so the Concurrency and PartitionKey of the options are ignored.
+type GoChannel struct {
+	*watermillSubscriber
+	pubsub *gochannel.GoChannel
+}
+
+func NewGoChannel(opts redissub.Options) *GoChannel {
+	//nolint:exhaustruct
+	pubsub := gochannel.NewGoChannel(gochannel.Config{}, nil)
+
+	return &GoChannel{
+		watermillSubscriber: newWatermillSubscriber(pubsub, pubsub, opts),
+		pubsub:              pubsub,
+	}
+}
+
+// Publish delivers messages to the subscription of topic. Like redispub.RedisPublisher.Publish, it
+// adds the headers of ctx, its request ID and the publish time to messages that do not set them.
+func (g *GoChannel) Publish(ctx context.Context, topic string, messages ...*message.Message) error {
+	redispub.AddHeaders(ctx, messages...)
+
+	if err := g.pubsub.Publish(topic, messages...); err != nil {
+		return fmt.Errorf("%w to topic %s: %w", redispub.ErrPublishFailed, topic, err)
+	}
+
+	return nil
+}
+
+// Close stops every subscription and waits for the messages being handled.
+func (g *GoChannel) Close() error {
+	if g.stop() {
+		return nil
+	}
+
+	if err := g.pubsub.Close(); err != nil {
+		return fmt.Errorf("failed to close go channel: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,185 @@
+package broker_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/require"
+	"github.com/thienhaole92/uframework/broker"
+	"github.com/thienhaole92/uframework/redispub"
+	"github.com/thienhaole92/uframework/redissub"
+	"github.com/thienhaole92/uframework/util"
+)
+
+var errHandler = errors.New("handler error")
+
+func testOptions() redissub.Options {
+	return redissub.Options{
+		Retry: redissub.RetryPolicy{
+			MaxDeliveries: 3,
+			MinBackoff:    10 * time.Millisecond,
+			MaxBackoff:    50 * time.Millisecond,
+			Factor:        2,
+		},
+		DeadLetterTopic:        "",
+		Concurrency:            0,
+		PartitionKey:           nil,
+		DrainTimeout:           0,
+		Middlewares:            nil,
+		PatternRefreshInterval: 0,
+		// Redis only.
+		Consumer:                  "",
+		BlockTime:                 0,
+		ReadBatchSize:             0,
+		ClaimInterval:             0,
+		ClaimBatchSize:            0,
+		MaxIdleTime:               0,
+		CheckConsumersInterval:    0,
+		ConsumerTimeout:           0,
+		OldestID:                  "",
+		ShouldClaimPendingMessage: nil,
+		ShouldStopOnReadErrors:    nil,
+	}
+}
+
+func newGoChannel(t *testing.T, opts redissub.Options) *broker.Broker {
+	t.Helper()
+
+	brk, err := broker.New(nil, broker.Config{
+		Driver:        broker.DriverGoChannel,
+		ConsumerGroup: "",
+		Publisher:     redispub.Options{MaxStreamEntries: 0, TopicPolicies: nil, DelayedPrefix: ""},
+		Subscriber:    opts,
+		Kafka:         broker.KafkaOptions{Brokers: nil, PartitionKey: nil, Sarama: nil},
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, brk.Close())
+	})
+
+	return brk
+}
+
+func receive(t *testing.T, messages <-chan *message.Message) *message.Message {
+	t.Helper()
+
+	select {
+	case msg := <-messages:
+		return msg
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "message not received")
+
+		return nil
+	}
+}
+
+func TestGoChannel_PublishSubscribe(t *testing.T) {
+	t.Parallel()
+
+	opts := testOptions()
+	opts.Middlewares = []redissub.Middleware{redissub.Recoverer()}
+
+	brk := newGoChannel(t, opts)
+	received := make(chan *message.Message, 1)
+
+	var attempts atomic.Int64
+
+	require.NoError(t, brk.Subscriber.Subscribe("orders", func(ctx context.Context, msg *message.Message) error {
+		if attempts.Add(1) == 1 {
+			panic("boom")
+		}
+
+		require.Equal(t, "orders", redissub.TopicFromContext(ctx))
+		require.Equal(t, "request", util.RequestIDFromContext(ctx))
+		received <- msg
+
+		return nil
+	}))
+	require.ErrorIs(t, brk.Subscriber.Subscribe("orders", nil), redissub.ErrAlreadySubscribed)
+
+	ctx := util.ContextWithRequestID(context.Background(), "request")
+	require.NoError(t, brk.Publisher.Publish(ctx, "orders", message.NewMessage("order", []byte("order"))))
+
+	// The recovered panic is retried like any failure.
+	msg := receive(t, received)
+	require.Equal(t, "order", string(msg.Payload))
+	require.Equal(t, "1", msg.Metadata.Get(redissub.MetadataDeliveryAttempt))
+	require.NotEmpty(t, msg.Metadata.Get(redispub.MetadataPublishedAt))
+
+	require.NoError(t, brk.Subscriber.Unsubscribe("orders"))
+	require.ErrorIs(t, brk.Subscriber.Unsubscribe("orders"), redissub.ErrNotSubscribed)
+}
+
+func TestGoChannel_DeadLetter(t *testing.T) {
+	t.Parallel()
+
+	brk := newGoChannel(t, testOptions())
+	dead := make(chan *message.Message, 2)
+
+	require.NoError(t, brk.Subscriber.Subscribe("payments", func(_ context.Context, msg *message.Message) error {
+		if string(msg.Payload) == "invalid" {
+			return redissub.Permanent(errHandler)
+		}
+
+		return errHandler
+	}))
+	require.NoError(t, brk.Subscriber.Subscribe("payments.dlq", func(_ context.Context, msg *message.Message) error {
+		dead <- msg
+
+		return nil
+	}))
+
+	ctx := context.Background()
+	require.NoError(t, brk.Publisher.Publish(ctx, "payments", message.NewMessage("invalid", []byte("invalid"))))
+
+	msg := receive(t, dead)
+	require.Equal(t, "payments", msg.Metadata.Get(redissub.MetadataDeadLetterTopic))
+	require.Equal(t, "invalid", msg.Metadata.Get(redissub.MetadataDeadLetterMessageID))
+	require.Equal(t, "1", msg.Metadata.Get(redissub.MetadataDeadLetterAttempts))
+
+	require.NoError(t, brk.Publisher.Publish(ctx, "payments", message.NewMessage("failing", []byte("failing"))))
+
+	msg = receive(t, dead)
+	require.Equal(t, "3", msg.Metadata.Get(redissub.MetadataDeadLetterAttempts))
+	require.Len(t, redissub.ErrorHistory(msg), 3)
+}
+
+func TestGoChannel_Close(t *testing.T) {
+	t.Parallel()
+
+	pubsub := broker.NewGoChannel(testOptions())
+
+	require.NoError(t, pubsub.Subscribe("orders", func(context.Context, *message.Message) error { return nil }))
+	require.NoError(t, pubsub.Close())
+	require.NoError(t, pubsub.Close())
+	require.ErrorIs(t, pubsub.Subscribe("orders", nil), redissub.ErrSubscriberClosed)
+}
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	config := broker.Config{
+		Driver:        "nats",
+		ConsumerGroup: "",
+		Publisher:     redispub.Options{MaxStreamEntries: 0, TopicPolicies: nil, DelayedPrefix: ""},
+		Subscriber:    testOptions(),
+		Kafka:         broker.KafkaOptions{Brokers: nil, PartitionKey: nil, Sarama: nil},
+	}
+
+	_, err := broker.New(nil, config)
+	require.ErrorIs(t, err, broker.ErrUnknownDriver)
+
+	config.Driver = broker.DriverRedis
+
+	_, err = broker.New(nil, config)
+	require.ErrorIs(t, err, redissub.ErrNilRedisClient)
+
+	config.Driver = broker.DriverKafka
+
+	_, err = broker.New(nil, config)
+	require.ErrorIs(t, err, broker.ErrEmptyKafkaBrokers)
+}
@@ -0,0 +1,203 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/IBM/sarama"
+	"github.com/ThreeDotsLabs/watermill-kafka/v3/pkg/kafka"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/thienhaole92/uframework/redispub"
+	"github.com/thienhaole92/uframework/redissub"
+)
+
+var (
+	ErrEmptyKafkaBrokers   = errors.New("kafka brokers cannot be empty")
+	ErrKafkaInitialization = errors.New("failed to initialize kafka client")
+)
+
+var (
+	_ Publisher  = (*KafkaPublisher)(nil)
+	_ Subscriber = (*KafkaSubscriber)(nil)
+)
+
+type KafkaOptions struct {
+	Brokers []string
+	// PartitionKey returns the key of a published message. Messages sharing a key are written to the
+	// same partition, so they are handled in order. Messages without a key are spread over partitions.
+	PartitionKey redissub.PartitionKeyFunc
+	// Sarama tunes the client, defaults to the watermill configuration. Subscribers start from the
+	// oldest offset by default, and always commit offsets themselves.
+	Sarama *sarama.Config
+}
+
+func (o KafkaOptions) validate() error {
+	if len(o.Brokers) == 0 {
+		return ErrEmptyKafkaBrokers
+	}
+
+	return nil
+}
+
+func (o KafkaOptions) marshaler() kafka.MarshalerUnmarshaler {
+	if o.PartitionKey == nil {
+		return kafka.DefaultMarshaler{}
+	}
+
+	return kafka.NewWithPartitioningMarshaler(func(_ string, msg *message.Message) (string, error) {
+		return o.PartitionKey(msg), nil
+	})
+}
+
+func (o KafkaOptions) publisherConfig() *sarama.Config {
+	config := kafka.DefaultSaramaSyncPublisherConfig()
+	if o.Sarama != nil {
+		copied := *o.Sarama
+		config = &copied
+	}
+
+	// Required by the sync producer of watermill.
+	config.Producer.Return.Successes = true
+
+	return config
+}
+
+func (o KafkaOptions) subscriberConfig() *sarama.Config {
+	config := kafka.DefaultSaramaSubscriberConfig()
+	config.Consumer.Offsets.Initial = sarama.OffsetOldest
+
+	if o.Sarama != nil {
+		copied := *o.Sarama
+		config = &copied
+	}
+
+	// Offsets are committed once a message is handled or dead-lettered, never before.
+	config.Consumer.Offsets.AutoCommit.Enable = false
+
+	return config
+}
+
+func newKafkaPublisher(opts KafkaOptions) (*kafka.Publisher, error) {
+	publisher, err := kafka.NewPublisher(kafka.PublisherConfig{
+		Brokers:               opts.Brokers,
+		Marshaler:             opts.marshaler(),
+		OverwriteSaramaConfig: opts.publisherConfig(),
+		OTELEnabled:           false,
+		Tracer:                nil,
+	}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrKafkaInitialization, err)
+	}
+
+	return publisher, nil
+}
+
+// KafkaPublisher publishes messages to Kafka topics, with their metadata as record headers.
+type KafkaPublisher struct {
+	publisher *kafka.Publisher
+}
+
+func NewKafkaPublisher(opts KafkaOptions) (*KafkaPublisher, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+
+	publisher, err := newKafkaPublisher(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &KafkaPublisher{publisher: publisher}, nil
+}
+
+// Publish writes messages to topic and waits for the brokers to acknowledge them. Like
+// redispub.RedisPublisher.Publish, it adds the headers of ctx, its request ID and the publish time
+// to messages that do not set them.
+func (p *KafkaPublisher) Publish(ctx context.Context, topic string, messages ...*message.Message) error {
+	redispub.AddHeaders(ctx, messages...)
+
+	if err := p.publisher.Publish(topic, messages...); err != nil {
+		return fmt.Errorf("%w to topic %s: %w", redispub.ErrPublishFailed, topic, err)
+	}
+
+	return nil
+}
+
+func (p *KafkaPublisher) Close() error {
+	if err := p.publisher.Close(); err != nil {
+		return fmt.Errorf("failed to close kafka publisher: %w", err)
+	}
+
+	return nil
+}
+
+// KafkaSubscriber consumes Kafka topics as a consumer group. Handlers are called as by redissub,
+// with the same middlewares, retries and dead-letter topic. The offset of a message is committed
+// once it is handled or dead-lettered, so a message being handled when the subscriber stops is
+// delivered again to the group.
+//
+// Messages of a partition are handled in order, up to opts.Concurrency partitions at a time.
+type KafkaSubscriber struct {
+	*watermillSubscriber
+	subscriber *kafka.Subscriber
+	publisher  *kafka.Publisher
+}
+
+func NewKafkaSubscriber(consumerGroup string, kafkaOpts KafkaOptions, opts redissub.Options) (*KafkaSubscriber, error) {
+	if consumerGroup == "" {
+		return nil, redissub.ErrEmptyConsumerGroup
+	}
+
+	if err := kafkaOpts.validate(); err != nil {
+		return nil, err
+	}
+
+	subscriber, err := kafka.NewSubscriber(kafka.SubscriberConfig{
+		Brokers:               kafkaOpts.Brokers,
+		Unmarshaler:           kafkaOpts.marshaler(),
+		OverwriteSaramaConfig: kafkaOpts.subscriberConfig(),
+		ConsumerGroup:         consumerGroup,
+		// Zero keeps the watermill defaults. Failed messages are retried by the handler, a nack only
+		// follows a failed dead-letter.
+		NackResendSleep:        0,
+		ReconnectRetrySleep:    0,
+		InitializeTopicDetails: nil,
+		OTELEnabled:            false,
+		Tracer:                 nil,
+	}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrKafkaInitialization, err)
+	}
+
+	// Dead letters are published to Kafka as well.
+	publisher, err := newKafkaPublisher(kafkaOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &KafkaSubscriber{
+		watermillSubscriber: newWatermillSubscriber(subscriber, publisher, opts),
+		subscriber:          subscriber,
+		publisher:           publisher,
+	}, nil
+}
+
+// Close stops every subscription, waits for the messages being handled and disconnects.
+func (s *KafkaSubscriber) Close() error {
+	if s.stop() {
+		return nil
+	}
+
+	var errs []error
+
+	if err := s.subscriber.Close(); err != nil {
+		errs = append(errs, fmt.Errorf("failed to close kafka subscriber: %w", err))
+	}
+
+	if err := s.publisher.Close(); err != nil {
+		errs = append(errs, fmt.Errorf("failed to close kafka publisher: %w", err))
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,269 @@
+package broker_test
+
+import (
+	"context"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/require"
+	"github.com/thienhaole92/uframework/broker"
+	"github.com/thienhaole92/uframework/redissub"
+)
+
+const (
+	kafkaGroup = "workers"
+	kafkaTopic = "orders"
+)
+
+func saramaConfig() *sarama.Config {
+	config := sarama.NewConfig()
+	config.Version = sarama.V2_0_0_0
+	config.Consumer.Return.Errors = true
+	config.Consumer.Offsets.Initial = sarama.OffsetOldest
+	config.Consumer.Group.Rebalance.Retry.Backoff = 0
+	config.Producer.Retry.Max = 0
+
+	return config
+}
+
+func kafkaOptions(brokers ...*sarama.MockBroker) broker.KafkaOptions {
+	addrs := make([]string, 0, len(brokers))
+	for _, mock := range brokers {
+		addrs = append(addrs, mock.Addr())
+	}
+
+	return broker.KafkaOptions{
+		Brokers: addrs,
+		PartitionKey: func(msg *message.Message) string {
+			return msg.Metadata.Get("order_id")
+		},
+		Sarama: saramaConfig(),
+	}
+}
+
+// newMockGroup starts a broker leading partition 0 of kafkaTopic and its dead-letter topic, and
+// coordinating kafkaGroup, which is assigned partition 0. The partition holds payloads from offset 0.
+func newMockGroup(t *testing.T, payloads ...string) *sarama.MockBroker {
+	t.Helper()
+
+	mock := sarama.NewMockBroker(t, 0)
+	t.Cleanup(mock.Close)
+
+	fetch := sarama.NewMockFetchResponse(t, len(payloads))
+	for offset, payload := range payloads {
+		fetch.SetMessage(kafkaTopic, 0, int64(offset), sarama.StringEncoder(payload))
+	}
+
+	fetch.SetHighWaterMark(kafkaTopic, 0, int64(len(payloads)))
+
+	mock.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetBroker(mock.Addr(), mock.BrokerID()).
+			SetLeader(kafkaTopic, 0, mock.BrokerID()).
+			SetLeader(kafkaTopic+".dlq", 0, mock.BrokerID()),
+		"OffsetRequest": sarama.NewMockOffsetResponse(t).
+			SetOffset(kafkaTopic, 0, sarama.OffsetOldest, 0).
+			SetOffset(kafkaTopic, 0, sarama.OffsetNewest, int64(len(payloads))),
+		"FindCoordinatorRequest": sarama.NewMockFindCoordinatorResponse(t).
+			SetCoordinator(sarama.CoordinatorGroup, kafkaGroup, mock),
+		"JoinGroupRequest": sarama.NewMockJoinGroupResponse(t).
+			SetGroupProtocol(sarama.RangeBalanceStrategyName).
+			SetMemberId("member").
+			SetLeaderId("leader"),
+		"SyncGroupRequest": sarama.NewMockSyncGroupResponse(t).
+			SetMemberAssignment(&sarama.ConsumerGroupMemberAssignment{
+				Version:  0,
+				Topics:   map[string][]int32{kafkaTopic: {0}},
+				UserData: nil,
+			}),
+		"OffsetFetchRequest": sarama.NewMockOffsetFetchResponse(t).
+			SetOffset(kafkaGroup, kafkaTopic, 0, -1, "", sarama.ErrNoError).
+			SetError(sarama.ErrNoError),
+		"HeartbeatRequest":    sarama.NewMockHeartbeatResponse(t),
+		"LeaveGroupRequest":   sarama.NewMockLeaveGroupResponse(t),
+		"OffsetCommitRequest": sarama.NewMockOffsetCommitResponse(t),
+		"FetchRequest":        fetch,
+		"ProduceRequest":      sarama.NewMockProduceResponse(t),
+	})
+
+	return mock
+}
+
+// committed returns the last offset of partition 0 committed to the mock broker, or -1.
+func committed(mock *sarama.MockBroker) int64 {
+	offset := int64(-1)
+
+	for _, exchange := range mock.History() {
+		if req, ok := exchange.Request.(*sarama.OffsetCommitRequest); ok {
+			if committed, _, err := req.Offset(kafkaTopic, 0); err == nil {
+				offset = committed
+			}
+		}
+	}
+
+	return offset
+}
+
+func produced(mock *sarama.MockBroker) int {
+	count := 0
+
+	for _, exchange := range mock.History() {
+		if _, ok := exchange.Request.(*sarama.ProduceRequest); ok {
+			count++
+		}
+	}
+
+	return count
+}
+
+func newKafkaSubscriber(t *testing.T, mock *sarama.MockBroker) *broker.KafkaSubscriber {
+	t.Helper()
+
+	subscriber, err := broker.NewKafkaSubscriber(kafkaGroup, kafkaOptions(mock), testOptions())
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, subscriber.Close())
+	})
+
+	return subscriber
+}
+
+func TestKafkaPublisher_PartitionKey(t *testing.T) {
+	t.Parallel()
+
+	// Each partition of the topic is led by its own broker, so the broker that receives a record
+	// tells its partition.
+	mocks := []*sarama.MockBroker{sarama.NewMockBroker(t, 0), sarama.NewMockBroker(t, 1)}
+
+	metadata := sarama.NewMockMetadataResponse(t)
+	for partition, mock := range mocks {
+		t.Cleanup(mock.Close)
+		metadata.SetBroker(mock.Addr(), mock.BrokerID()).SetLeader(kafkaTopic, int32(partition), mock.BrokerID())
+	}
+
+	for _, mock := range mocks {
+		mock.SetHandlerByMap(map[string]sarama.MockResponse{
+			"MetadataRequest": metadata,
+			"ProduceRequest":  sarama.NewMockProduceResponse(t),
+		})
+	}
+
+	publisher, err := broker.NewKafkaPublisher(kafkaOptions(mocks...))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, publisher.Close())
+	})
+
+	partitioner := sarama.NewHashPartitioner(kafkaTopic)
+
+	for i := range 3 {
+		orderID := "order-" + strconv.Itoa(i)
+
+		partition, err := partitioner.Partition(&sarama.ProducerMessage{Key: sarama.StringEncoder(orderID)}, 2) //nolint:exhaustruct
+		require.NoError(t, err)
+
+		before := produced(mocks[partition])
+
+		for range 2 {
+			msg := message.NewMessage(orderID, []byte(orderID))
+			msg.Metadata.Set("order_id", orderID)
+			require.NoError(t, publisher.Publish(context.Background(), kafkaTopic, msg))
+		}
+
+		require.Equal(t, before+2, produced(mocks[partition]))
+	}
+}
+
+func TestKafkaSubscriber_CommitAfterSuccess(t *testing.T) {
+	t.Parallel()
+
+	mock := newMockGroup(t, "first", "second")
+	subscriber := newKafkaSubscriber(t, mock)
+
+	release := make(chan struct{})
+	handled := make(chan string, 2)
+
+	var attempts atomic.Int64
+
+	require.NoError(t, subscriber.Subscribe(kafkaTopic, func(_ context.Context, msg *message.Message) error {
+		if string(msg.Payload) == "first" {
+			<-release
+
+			if attempts.Add(1) == 1 {
+				return errHandler
+			}
+		}
+
+		handled <- string(msg.Payload)
+
+		return nil
+	}))
+
+	// Nothing is committed while the first message is being handled.
+	time.Sleep(500 * time.Millisecond)
+	require.Equal(t, int64(-1), committed(mock))
+
+	close(release)
+
+	// The failed attempt is retried, and messages of the partition are handled in order.
+	require.Equal(t, "first", receiveString(t, handled))
+	require.Equal(t, "second", receiveString(t, handled))
+	require.Equal(t, int64(2), attempts.Load())
+
+	require.Eventually(t, func() bool {
+		return committed(mock) == 2
+	}, 5*time.Second, 20*time.Millisecond)
+	require.Zero(t, produced(mock))
+}
+
+func TestKafkaSubscriber_DeadLetter(t *testing.T) {
+	t.Parallel()
+
+	mock := newMockGroup(t, "invalid")
+	subscriber := newKafkaSubscriber(t, mock)
+
+	require.NoError(t, subscriber.Subscribe(kafkaTopic, func(context.Context, *message.Message) error {
+		return redissub.Permanent(errHandler)
+	}))
+
+	// The message is published to the dead-letter topic before its offset is committed.
+	require.Eventually(t, func() bool {
+		return committed(mock) == 1
+	}, 5*time.Second, 20*time.Millisecond)
+	require.Equal(t, 1, produced(mock))
+
+	require.NoError(t, subscriber.Unsubscribe(kafkaTopic))
+	require.ErrorIs(t, subscriber.Unsubscribe(kafkaTopic), redissub.ErrNotSubscribed)
+}
+
+func TestKafka_Options(t *testing.T) {
+	t.Parallel()
+
+	//nolint:exhaustruct
+	_, err := broker.NewKafkaPublisher(broker.KafkaOptions{})
+	require.ErrorIs(t, err, broker.ErrEmptyKafkaBrokers)
+
+	//nolint:exhaustruct
+	_, err = broker.NewKafkaSubscriber(kafkaGroup, broker.KafkaOptions{}, testOptions())
+	require.ErrorIs(t, err, broker.ErrEmptyKafkaBrokers)
+
+	_, err = broker.NewKafkaSubscriber("", kafkaOptions(), testOptions())
+	require.ErrorIs(t, err, redissub.ErrEmptyConsumerGroup)
+}
+
+func receiveString(t *testing.T, values <-chan string) string {
+	t.Helper()
+
+	select {
+	case value := <-values:
+		return value
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "value not received")
+
+		return ""
+	}
+}
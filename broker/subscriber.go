@@ -0,0 +1,228 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/rs/zerolog/log"
+	"github.com/thienhaole92/uframework/redissub"
+)
+
+type subscription struct {
+	cancel  context.CancelFunc
+	stopped chan struct{}
+}
+
+// watermillSubscriber calls redissub handlers with the messages of a watermill subscriber. Brokers
+// other than Redis streams do not count deliveries, so failed messages are retried in place with
+// the backoff of opts.Retry, then published to the dead-letter topic and acknowledged.
+type watermillSubscriber struct {
+	subscriber message.Subscriber
+	publisher  message.Publisher // Publishes dead letters.
+	opts       redissub.Options
+
+	subscriptions map[string]*subscription
+	subMux        sync.Mutex // Protects subscriptions and closed
+	closed        bool
+}
+
+func newWatermillSubscriber(
+	subscriber message.Subscriber,
+	publisher message.Publisher,
+	opts redissub.Options,
+) *watermillSubscriber {
+	return &watermillSubscriber{
+		subscriber:    subscriber,
+		publisher:     publisher,
+		opts:          opts,
+		subscriptions: make(map[string]*subscription),
+		subMux:        sync.Mutex{},
+		closed:        false,
+	}
+}
+
+// Subscribe handles the messages of topic until it is unsubscribed. opts.Concurrency workers take
+// the messages of the subscription, but the watermill subscriber only delivers the next message of a
+// Kafka partition, or of a GoChannel subscription, once the previous one is acknowledged. Up to
+// opts.Concurrency Kafka partitions are thus handled at the same time, and a GoChannel topic one
+// message at a time.
+func (w *watermillSubscriber) Subscribe(topic string, handler redissub.MessageHandler) error {
+	w.subMux.Lock()
+	defer w.subMux.Unlock()
+
+	if w.closed {
+		return redissub.ErrSubscriberClosed
+	}
+
+	if _, ok := w.subscriptions[topic]; ok {
+		return fmt.Errorf("%w: %s", redissub.ErrAlreadySubscribed, topic)
+	}
+
+	opts := w.opts
+	opts.SetDefaults(topic)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	messages, err := w.subscriber.Subscribe(ctx, topic)
+	if err != nil {
+		cancel()
+
+		return fmt.Errorf("%w %s: %w", redissub.ErrSubscribeFailed, topic, err)
+	}
+
+	sub := &subscription{cancel: cancel, stopped: make(chan struct{})}
+	w.subscriptions[topic] = sub
+
+	handler = redissub.Chain(handler, opts.Middlewares...)
+
+	var workers sync.WaitGroup
+
+	for range opts.Concurrency {
+		workers.Add(1)
+
+		go func() {
+			defer workers.Done()
+
+			// The channel is closed once ctx is cancelled.
+			for msg := range messages {
+				w.handle(ctx, topic, opts, handler, msg)
+			}
+		}()
+	}
+
+	go func() {
+		workers.Wait()
+		close(sub.stopped)
+	}()
+
+	return nil
+}
+
+// handle retries the message with backoff, then moves it to the dead-letter topic. A message in
+// flight elsewhere is retried after MaxBackoff without counting an attempt.
+func (w *watermillSubscriber) handle(
+	ctx context.Context,
+	topic string,
+	opts redissub.Options,
+	handler redissub.MessageHandler,
+	msg *message.Message,
+) {
+	for attempt := 1; ; {
+		err := handler(redissub.HandlerContext(context.Background(), topic, msg), msg)
+		if err == nil {
+			msg.Ack()
+
+			return
+		}
+
+		// Another delivery of the message is still being handled, waiting does not use an attempt.
+		if errors.Is(err, redissub.ErrMessageInFlight) {
+			if !wait(ctx, opts.Retry.MaxBackoff) {
+				msg.Nack()
+
+				return
+			}
+
+			continue
+		}
+
+		err = fmt.Errorf("message handler failed: %w", err)
+		redissub.RecordFailure(msg, attempt, err)
+
+		if redissub.IsPermanent(err) || attempt >= opts.Retry.MaxDeliveries {
+			// A message that cannot be dead-lettered is delivered again rather than lost.
+			if w.deadLetter(topic, opts.DeadLetterTopic, msg, attempt, err) {
+				msg.Ack()
+			} else {
+				wait(ctx, opts.Retry.MaxBackoff)
+				msg.Nack()
+			}
+
+			return
+		}
+
+		if !wait(ctx, opts.Retry.Backoff(attempt)) {
+			msg.Nack()
+
+			return
+		}
+
+		attempt++
+	}
+}
+
+// wait sleeps for delay and reports whether it was not interrupted by ctx.
+func wait(ctx context.Context, delay time.Duration) bool {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (w *watermillSubscriber) deadLetter(topic, dlqTopic string, msg *message.Message, attempts int, cause error) bool {
+	if err := w.publisher.Publish(dlqTopic, redissub.DeadLetterMessage(topic, msg, attempts, cause)); err != nil {
+		log.Error().Err(err).Str("topic", topic).Str("message_id", msg.UUID).Msg("Failed to dead-letter message")
+
+		return false
+	}
+
+	log.Warn().
+		Err(cause).
+		Str("topic", topic).
+		Str("dead_letter_topic", dlqTopic).
+		Str("message_id", msg.UUID).
+		Int("attempts", attempts).
+		Msg("Message moved to dead-letter topic")
+
+	return true
+}
+
+// Unsubscribe stops handling the messages of topic, once the messages being handled are done.
+func (w *watermillSubscriber) Unsubscribe(topic string) error {
+	w.subMux.Lock()
+	sub, ok := w.subscriptions[topic]
+	delete(w.subscriptions, topic)
+	w.subMux.Unlock()
+
+	if !ok {
+		return fmt.Errorf("%w: %s", redissub.ErrNotSubscribed, topic)
+	}
+
+	sub.cancel()
+	<-sub.stopped
+
+	return nil
+}
+
+// stop stops every subscription and waits for the messages being handled. It reports whether the
+// subscriber was already stopped.
+func (w *watermillSubscriber) stop() bool {
+	w.subMux.Lock()
+
+	if w.closed {
+		w.subMux.Unlock()
+
+		return true
+	}
+
+	w.closed = true
+	subscriptions := w.subscriptions
+	w.subscriptions = make(map[string]*subscription)
+	w.subMux.Unlock()
+
+	for _, sub := range subscriptions {
+		sub.cancel()
+		<-sub.stopped
+	}
+
+	return false
+}
@@ -0,0 +1,256 @@
+package goredis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+	"github.com/thienhaole92/uframework/metricserver"
+)
+
+const (
+	defaultLocalCapacity      = 10_000
+	defaultLocalTTL           = time.Minute
+	invalidationChannelPrefix = "uframework:cache:invalidate:"
+
+	tierLocal = "local"
+	tierRedis = "redis"
+)
+
+var (
+	ErrCacheMiss             = errors.New("cache miss")
+	ErrEmptyCacheName        = errors.New("cache name cannot be empty")
+	ErrInvalidationFailed    = errors.New("failed to broadcast cache invalidation")
+	ErrInvalidationSubscribe = errors.New("failed to subscribe to cache invalidation channel")
+)
+
+// CacheOption configures a TieredCache.
+type CacheOption struct {
+	Name          string        // Cache name, used for metric labels and the invalidation channel.
+	LocalCapacity int           // Maximum number of entries kept in process.
+	LocalTTL      time.Duration // How long an entry may live in process before it is re-read from Redis.
+	RedisTTL      time.Duration // Expiration of entries written to Redis, zero means no expiration.
+	Registerer    prometheus.Registerer
+}
+
+func (o *CacheOption) setDefaults() {
+	if o.LocalCapacity <= 0 {
+		o.LocalCapacity = defaultLocalCapacity
+	}
+
+	if o.LocalTTL <= 0 {
+		o.LocalTTL = defaultLocalTTL
+	}
+
+	if o.Registerer == nil {
+		o.Registerer = prometheus.DefaultRegisterer
+	}
+}
+
+type invalidation struct {
+	Origin string   `json:"origin"`
+	Keys   []string `json:"keys"`
+	Purge  bool     `json:"purge,omitempty"`
+}
+
+// TieredCache keeps hot keys in an in-process LRU in front of Redis. Writes and
+// deletes are broadcast over Redis pub/sub so every replica evicts its local copy.
+type TieredCache struct {
+	redis    *Redis
+	local    *lruCache
+	name     string
+	channel  string
+	instance string
+	redisTTL time.Duration
+	pubsub   *redis.PubSub
+	hits     *prometheus.CounterVec
+	misses   *prometheus.CounterVec
+	done     chan struct{}
+}
+
+func NewTieredCache(ctx context.Context, rds *Redis, opts *CacheOption) (*TieredCache, error) {
+	if opts.Name == "" {
+		return nil, ErrEmptyCacheName
+	}
+
+	opts.setDefaults()
+
+	hits, err := registerCounterVec(opts.Registerer, prometheus.CounterOpts{
+		Name:        "cache_hits_total",
+		Help:        "Number of cache hits per cache and tier.",
+		Namespace:   "",
+		Subsystem:   "",
+		ConstLabels: nil,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	misses, err := registerCounterVec(opts.Registerer, prometheus.CounterOpts{
+		Name:        "cache_misses_total",
+		Help:        "Number of cache misses per cache and tier.",
+		Namespace:   "",
+		Subsystem:   "",
+		ConstLabels: nil,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	channel := invalidationChannelPrefix + opts.Name
+
+	pubsub := rds.Subscribe(ctx, channel)
+
+	// Wait for the subscription to be confirmed so no invalidation is missed after returning.
+	if _, err := pubsub.Receive(ctx); err != nil {
+		_ = pubsub.Close()
+
+		return nil, fmt.Errorf("%w %s: %w", ErrInvalidationSubscribe, channel, err)
+	}
+
+	cache := &TieredCache{
+		redis:    rds,
+		local:    newLRUCache(opts.LocalCapacity, opts.LocalTTL),
+		name:     opts.Name,
+		channel:  channel,
+		instance: uuid.NewString(),
+		redisTTL: opts.RedisTTL,
+		pubsub:   pubsub,
+		hits:     hits,
+		misses:   misses,
+		done:     make(chan struct{}),
+	}
+
+	go cache.listen()
+
+	return cache, nil
+}
+
+// Get returns the value for key, looking in process first and then in Redis.
+// ErrCacheMiss is returned when neither tier holds the key. A value read from Redis is not kept in
+// process when the key is written or invalidated during the read, as it may already be stale.
+func (c *TieredCache) Get(ctx context.Context, key string) ([]byte, error) {
+	if value, ok := c.local.get(key); ok {
+		c.hits.WithLabelValues(c.name, tierLocal).Inc()
+
+		return value, nil
+	}
+
+	c.misses.WithLabelValues(c.name, tierLocal).Inc()
+
+	generation := c.local.load(key)
+
+	value, err := c.redis.Get(ctx, key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		c.local.unload(key)
+		c.misses.WithLabelValues(c.name, tierRedis).Inc()
+
+		return nil, ErrCacheMiss
+	}
+
+	if err != nil {
+		c.local.unload(key)
+
+		return nil, err
+	}
+
+	c.hits.WithLabelValues(c.name, tierRedis).Inc()
+	c.local.fill(key, value, generation)
+
+	return value, nil
+}
+
+// Set writes value to both tiers using the configured Redis TTL.
+func (c *TieredCache) Set(ctx context.Context, key string, value []byte) error {
+	return c.SetWithTTL(ctx, key, value, c.redisTTL)
+}
+
+// SetWithTTL writes value to both tiers and tells other replicas to drop their copy. The in-process
+// copy expires after ttl when it is shorter than LocalTTL.
+func (c *TieredCache) SetWithTTL(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if err := c.redis.Set(ctx, key, value, ttl).Err(); err != nil {
+		return err
+	}
+
+	c.local.set(key, value, ttl)
+
+	return c.broadcast(ctx, invalidation{Origin: c.instance, Keys: []string{key}, Purge: false})
+}
+
+// Delete removes keys from both tiers on every replica.
+func (c *TieredCache) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	if err := c.redis.Del(ctx, keys...).Err(); err != nil {
+		return err
+	}
+
+	c.local.remove(keys...)
+
+	return c.broadcast(ctx, invalidation{Origin: c.instance, Keys: keys, Purge: false})
+}
+
+// Purge drops every in-process entry on every replica. Redis is left untouched.
+func (c *TieredCache) Purge(ctx context.Context) error {
+	c.local.purge()
+
+	return c.broadcast(ctx, invalidation{Origin: c.instance, Keys: nil, Purge: true})
+}
+
+func (c *TieredCache) Close() error {
+	err := c.pubsub.Close()
+
+	<-c.done
+
+	return err
+}
+
+func (c *TieredCache) broadcast(ctx context.Context, inv invalidation) error {
+	payload, err := json.Marshal(inv)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidationFailed, err)
+	}
+
+	if err := c.redis.Publish(ctx, c.channel, payload).Err(); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidationFailed, err)
+	}
+
+	return nil
+}
+
+func (c *TieredCache) listen() {
+	defer close(c.done)
+
+	for msg := range c.pubsub.Channel() {
+		var inv invalidation
+		if err := json.Unmarshal([]byte(msg.Payload), &inv); err != nil {
+			log.Error().Err(err).Str("channel", c.channel).Msg("Failed to decode cache invalidation")
+
+			continue
+		}
+
+		if inv.Origin == c.instance {
+			continue
+		}
+
+		if inv.Purge {
+			c.local.purge()
+
+			continue
+		}
+
+		c.local.remove(inv.Keys...)
+	}
+}
+
+func registerCounterVec(reg prometheus.Registerer, opts prometheus.CounterOpts) (*prometheus.CounterVec, error) {
+	return metricserver.Register(reg, prometheus.NewCounterVec(opts, []string{"cache", "tier"}))
+}
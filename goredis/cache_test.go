@@ -0,0 +1,130 @@
+package goredis_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+	"github.com/thienhaole92/uframework/goredis"
+	"github.com/thienhaole92/uframework/testutil"
+)
+
+func newTestRedis(ctx context.Context, t *testing.T) *goredis.Redis {
+	t.Helper()
+
+	container := testutil.SetupRedisContainer(ctx, t)
+
+	port, err := strconv.Atoi(container.Port.Port())
+	require.NoError(t, err)
+
+	return goredis.New(&goredis.Option{
+		Host:             container.Host,
+		Port:             port,
+		Username:         "",
+		Password:         "",
+		DB:               0,
+		DialTimeout:      5 * time.Second,
+		UseTLS:           false,
+		MaxIdleConns:     5,
+		MinIdleConns:     1,
+		PingTimeout:      2 * time.Second,
+		TTL:              time.Minute,
+		Mode:             goredis.ModeStandalone,
+		URL:              "",
+		Addrs:            nil,
+		MasterName:       "",
+		SentinelUsername: "",
+		SentinelPassword: "",
+		TLS:              nil,
+	})
+}
+
+func newTestCache(ctx context.Context, t *testing.T, redis *goredis.Redis) *goredis.TieredCache {
+	t.Helper()
+
+	cache, err := goredis.NewTieredCache(ctx, redis, &goredis.CacheOption{
+		Name:          "test",
+		LocalCapacity: 10,
+		LocalTTL:      time.Minute,
+		RedisTTL:      time.Minute,
+		Registerer:    prometheus.NewRegistry(),
+	})
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		_ = cache.Close()
+	})
+
+	return cache
+}
+
+func TestTieredCache(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	redis := newTestRedis(ctx, t)
+
+	replicaA := newTestCache(ctx, t, redis)
+	replicaB := newTestCache(ctx, t, redis)
+
+	_, err := replicaA.Get(ctx, "key")
+	require.ErrorIs(t, err, goredis.ErrCacheMiss)
+
+	require.NoError(t, replicaA.Set(ctx, "key", []byte("v1")))
+
+	value, err := replicaB.Get(ctx, "key")
+	require.NoError(t, err)
+	require.Equal(t, []byte("v1"), value)
+
+	// Replica A overwrites the key, replica B must drop the copy it holds in process.
+	require.NoError(t, replicaA.Set(ctx, "key", []byte("v2")))
+	require.Eventually(t, func() bool {
+		value, err := replicaB.Get(ctx, "key")
+
+		return err == nil && string(value) == "v2"
+	}, 2*time.Second, 50*time.Millisecond)
+
+	require.NoError(t, replicaB.Delete(ctx, "key"))
+	require.Eventually(t, func() bool {
+		_, err := replicaA.Get(ctx, "key")
+
+		return err != nil
+	}, 2*time.Second, 50*time.Millisecond)
+}
+
+func TestTieredCache_SetWithTTL(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	cache := newTestCache(ctx, t, newTestRedis(ctx, t))
+
+	require.NoError(t, cache.SetWithTTL(ctx, "key", []byte("value"), time.Second))
+
+	value, err := cache.Get(ctx, "key")
+	require.NoError(t, err)
+	require.Equal(t, []byte("value"), value)
+
+	// The in-process copy expires with the Redis entry rather than after LocalTTL.
+	require.Eventually(t, func() bool {
+		_, err := cache.Get(ctx, "key")
+
+		return errors.Is(err, goredis.ErrCacheMiss)
+	}, 3*time.Second, 100*time.Millisecond)
+}
+
+func TestTieredCache_EmptyName(t *testing.T) {
+	t.Parallel()
+
+	_, err := goredis.NewTieredCache(context.Background(), nil, &goredis.CacheOption{
+		Name:          "",
+		LocalCapacity: 0,
+		LocalTTL:      0,
+		RedisTTL:      0,
+		Registerer:    nil,
+	})
+	require.ErrorIs(t, err, goredis.ErrEmptyCacheName)
+}
@@ -3,16 +3,36 @@ package goredis
 import (
 	"context"
 	"crypto/tls"
+	"errors"
+	"fmt"
 	"net"
 	"strconv"
 	"time"
 
 	"github.com/redis/go-redis/v9"
+	"github.com/thienhaole92/uframework/tlsconfig"
+)
+
+// Mode selects the kind of Redis deployment the client talks to.
+type Mode string
+
+const (
+	ModeStandalone Mode = "standalone"
+	ModeSentinel   Mode = "sentinel"
+	ModeCluster    Mode = "cluster"
+)
+
+var (
+	ErrUnknownMode       = errors.New("unknown redis mode")
+	ErrMissingMasterName = errors.New("sentinel mode requires a master name")
+	ErrMissingAddrs      = errors.New("sentinel and cluster modes require at least one address")
+	ErrInvalidURL        = errors.New("invalid redis url")
 )
 
 type Option struct {
 	Host         string
 	Port         int
+	Username     string
 	Password     string
 	DB           int
 	TTL          time.Duration
@@ -21,16 +41,31 @@ type Option struct {
 	MaxIdleConns int
 	MinIdleConns int
 	PingTimeout  time.Duration
+
+	// Mode defaults to standalone, which connects to Host and Port.
+	Mode Mode
+	// URL is a redis:// or rediss:// connection string. When set it replaces Host, Port, Username,
+	// Password and DB. In cluster mode further nodes may be given with the addr query parameter.
+	URL string
+	// Addrs are the sentinel addresses in sentinel mode and the seed nodes in cluster mode.
+	Addrs []string
+	// MasterName is the name of the master monitored by the sentinels.
+	MasterName       string
+	SentinelUsername string
+	SentinelPassword string
+	// TLS enables TLS with CA bundles, client certificates and rotation. It takes precedence over UseTLS.
+	TLS *tlsconfig.Option
 }
 
 type Redis struct {
-	*redis.Client
+	redis.UniversalClient
 }
 
 func New(opts *Option) *Redis {
-	opt := buildRedisOptions(opts)
-
-	client := redis.NewClient(&opt)
+	client, err := newClient(opts)
+	if err != nil {
+		panic(err)
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), opts.PingTimeout)
 	defer cancel()
@@ -39,49 +74,169 @@ func New(opts *Option) *Redis {
 		panic(err)
 	}
 
-	return &Redis{Client: client}
+	return &Redis{UniversalClient: client}
 }
 
-func buildRedisOptions(opts *Option) redis.Options {
-	opt := redis.Options{
-		Addr:                       net.JoinHostPort(opts.Host, strconv.Itoa(opts.Port)),
-		Password:                   opts.Password,
-		DB:                         opts.DB,
-		DialTimeout:                opts.DialTimeout,
-		MaxIdleConns:               opts.MaxIdleConns,
-		MinIdleConns:               opts.MinIdleConns,
-		Network:                    "",
-		ClientName:                 "",
-		Dialer:                     nil,
-		OnConnect:                  nil,
-		Protocol:                   0,
-		Username:                   "",
-		CredentialsProvider:        nil,
-		CredentialsProviderContext: nil,
-		MaxRetries:                 0,
-		MinRetryBackoff:            0,
-		MaxRetryBackoff:            0,
-		ReadTimeout:                0,
-		WriteTimeout:               0,
-		ContextTimeoutEnabled:      false,
-		PoolFIFO:                   false,
-		PoolSize:                   0,
-		PoolTimeout:                0,
-		MaxActiveConns:             0,
-		ConnMaxIdleTime:            0,
-		ConnMaxLifetime:            0,
-		TLSConfig:                  nil,
-		Limiter:                    nil,
-		DisableIndentity:           false,
-		IdentitySuffix:             "",
-		UnstableResp3:              false,
+// Unwrap returns the underlying client, such as a *redis.ClusterClient for cluster-only commands.
+//
+//nolint:ireturn
+func (r *Redis) Unwrap() redis.UniversalClient {
+	return r.UniversalClient
+}
+
+//nolint:ireturn
+func newClient(opts *Option) (redis.UniversalClient, error) {
+	if opts.URL != "" {
+		return newClientFromURL(opts)
+	}
+
+	uopt, err := buildUniversalOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	switch opts.Mode {
+	case ModeStandalone, "":
+		return redis.NewClient(uopt.Simple()), nil
+	case ModeSentinel:
+		if opts.MasterName == "" {
+			return nil, ErrMissingMasterName
+		}
+
+		if len(opts.Addrs) == 0 {
+			return nil, ErrMissingAddrs
+		}
+
+		return redis.NewFailoverClient(uopt.Failover()), nil
+	case ModeCluster:
+		if len(opts.Addrs) == 0 {
+			return nil, ErrMissingAddrs
+		}
+
+		return redis.NewClusterClient(uopt.Cluster()), nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownMode, opts.Mode)
+	}
+}
+
+//nolint:ireturn
+func newClientFromURL(opts *Option) (redis.UniversalClient, error) {
+	tlsConfig, err := buildTLSConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	switch opts.Mode {
+	case ModeStandalone, "":
+		opt, err := redis.ParseURL(opts.URL)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidURL, err)
+		}
+
+		opt.DialTimeout = valueOr(opts.DialTimeout, opt.DialTimeout)
+		opt.MaxIdleConns = valueOr(opts.MaxIdleConns, opt.MaxIdleConns)
+		opt.MinIdleConns = valueOr(opts.MinIdleConns, opt.MinIdleConns)
+
+		if tlsConfig != nil {
+			opt.TLSConfig = tlsConfig
+		}
+
+		return redis.NewClient(opt), nil
+	case ModeCluster:
+		opt, err := redis.ParseClusterURL(opts.URL)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidURL, err)
+		}
+
+		opt.DialTimeout = valueOr(opts.DialTimeout, opt.DialTimeout)
+		opt.MaxIdleConns = valueOr(opts.MaxIdleConns, opt.MaxIdleConns)
+		opt.MinIdleConns = valueOr(opts.MinIdleConns, opt.MinIdleConns)
+
+		if tlsConfig != nil {
+			opt.TLSConfig = tlsConfig
+		}
+
+		return redis.NewClusterClient(opt), nil
+	case ModeSentinel:
+		return nil, fmt.Errorf("%w: sentinel mode is configured with Addrs and MasterName", ErrInvalidURL)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownMode, opts.Mode)
+	}
+}
+
+func buildUniversalOptions(opts *Option) (redis.UniversalOptions, error) {
+	addrs := opts.Addrs
+	if opts.Mode == ModeStandalone || opts.Mode == "" {
+		addrs = []string{net.JoinHostPort(opts.Host, strconv.Itoa(opts.Port))}
+	}
+
+	opt := redis.UniversalOptions{
+		Addrs:                 addrs,
+		MasterName:            opts.MasterName,
+		Username:              opts.Username,
+		Password:              opts.Password,
+		SentinelUsername:      opts.SentinelUsername,
+		SentinelPassword:      opts.SentinelPassword,
+		DB:                    opts.DB,
+		DialTimeout:           opts.DialTimeout,
+		MaxIdleConns:          opts.MaxIdleConns,
+		MinIdleConns:          opts.MinIdleConns,
+		ClientName:            "",
+		Dialer:                nil,
+		OnConnect:             nil,
+		Protocol:              0,
+		MaxRetries:            0,
+		MinRetryBackoff:       0,
+		MaxRetryBackoff:       0,
+		ReadTimeout:           0,
+		WriteTimeout:          0,
+		ContextTimeoutEnabled: false,
+		PoolFIFO:              false,
+		PoolSize:              0,
+		PoolTimeout:           0,
+		MaxActiveConns:        0,
+		ConnMaxIdleTime:       0,
+		ConnMaxLifetime:       0,
+		TLSConfig:             nil,
+		MaxRedirects:          0,
+		ReadOnly:              false,
+		RouteByLatency:        false,
+		RouteRandomly:         false,
+		DisableIndentity:      false,
+		IdentitySuffix:        "",
+		UnstableResp3:         false,
+	}
+
+	tlsConfig, err := buildTLSConfig(opts)
+	if err != nil {
+		return opt, err
+	}
+
+	opt.TLSConfig = tlsConfig
+
+	return opt, nil
+}
+
+func buildTLSConfig(opts *Option) (*tls.Config, error) {
+	if opts.TLS != nil {
+		return tlsconfig.NewClientConfig(opts.TLS)
 	}
 
 	if opts.UseTLS {
-		opt.TLSConfig = createTLSConfig()
+		return createTLSConfig(), nil
+	}
+
+	//nolint:nilnil
+	return nil, nil
+}
+
+func valueOr[T comparable](value, fallback T) T {
+	var zero T
+	if value == zero {
+		return fallback
 	}
 
-	return opt
+	return value
 }
 
 func createTLSConfig() *tls.Config {
@@ -2,6 +2,7 @@ package goredis_test
 
 import (
 	"context"
+	"net"
 	"strconv"
 	"testing"
 	"time"
@@ -23,16 +24,24 @@ func TestRedisConnection(t *testing.T) {
 	require.NoError(t, err)
 
 	opts := &goredis.Option{
-		Host:         container.Host,
-		Port:         port,
-		Password:     "",
-		DB:           0,
-		DialTimeout:  5 * time.Second,
-		UseTLS:       false,
-		MaxIdleConns: 5,
-		MinIdleConns: 1,
-		PingTimeout:  2 * time.Second,
-		TTL:          time.Minute,
+		Host:             container.Host,
+		Port:             port,
+		Username:         "",
+		Password:         "",
+		DB:               0,
+		DialTimeout:      5 * time.Second,
+		UseTLS:           false,
+		MaxIdleConns:     5,
+		MinIdleConns:     1,
+		PingTimeout:      2 * time.Second,
+		TTL:              time.Minute,
+		Mode:             goredis.ModeStandalone,
+		URL:              "",
+		Addrs:            nil,
+		MasterName:       "",
+		SentinelUsername: "",
+		SentinelPassword: "",
+		TLS:              nil,
 	}
 
 	redis := goredis.New(opts)
@@ -40,3 +49,126 @@ func TestRedisConnection(t *testing.T) {
 	_, err = redis.Ping(ctx).Result()
 	require.NoError(t, err, "failed to ping Redis")
 }
+
+func TestRedisConnection_URL(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	container := testutil.SetupRedisContainer(ctx, t)
+
+	opts := &goredis.Option{
+		Host:             "",
+		Port:             0,
+		Username:         "",
+		Password:         "",
+		DB:               0,
+		DialTimeout:      5 * time.Second,
+		UseTLS:           false,
+		MaxIdleConns:     5,
+		MinIdleConns:     1,
+		PingTimeout:      2 * time.Second,
+		TTL:              time.Minute,
+		Mode:             goredis.ModeStandalone,
+		URL:              "redis://" + net.JoinHostPort(container.Host, container.Port.Port()) + "/1",
+		Addrs:            nil,
+		MasterName:       "",
+		SentinelUsername: "",
+		SentinelPassword: "",
+		TLS:              nil,
+	}
+
+	redis := goredis.New(opts)
+
+	_, err := redis.Ping(ctx).Result()
+	require.NoError(t, err, "failed to ping Redis")
+}
+
+func TestNew_InvalidOptions(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		mode     goredis.Mode
+		url      string
+		addrs    []string
+		master   string
+		expected error
+	}{
+		{
+			name:     "Sentinel without master name",
+			mode:     goredis.ModeSentinel,
+			url:      "",
+			addrs:    []string{"127.0.0.1:26379"},
+			master:   "",
+			expected: goredis.ErrMissingMasterName,
+		},
+		{
+			name:     "Sentinel without addresses",
+			mode:     goredis.ModeSentinel,
+			url:      "",
+			addrs:    nil,
+			master:   "mymaster",
+			expected: goredis.ErrMissingAddrs,
+		},
+		{
+			name:     "Cluster without addresses",
+			mode:     goredis.ModeCluster,
+			url:      "",
+			addrs:    nil,
+			master:   "",
+			expected: goredis.ErrMissingAddrs,
+		},
+		{
+			name:     "Unknown mode",
+			mode:     goredis.Mode("ring"),
+			url:      "",
+			addrs:    nil,
+			master:   "",
+			expected: goredis.ErrUnknownMode,
+		},
+		{
+			name:     "Invalid URL scheme",
+			mode:     goredis.ModeStandalone,
+			url:      "http://127.0.0.1:6379",
+			addrs:    nil,
+			master:   "",
+			expected: goredis.ErrInvalidURL,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			opts := &goredis.Option{
+				Host:             "127.0.0.1",
+				Port:             6379,
+				Username:         "",
+				Password:         "",
+				DB:               0,
+				DialTimeout:      time.Second,
+				UseTLS:           false,
+				MaxIdleConns:     0,
+				MinIdleConns:     0,
+				PingTimeout:      time.Second,
+				TTL:              0,
+				Mode:             test.mode,
+				URL:              test.url,
+				Addrs:            test.addrs,
+				MasterName:       test.master,
+				SentinelUsername: "",
+				SentinelPassword: "",
+				TLS:              nil,
+			}
+
+			defer func() {
+				err, ok := recover().(error)
+				require.True(t, ok)
+				require.ErrorIs(t, err, test.expected)
+			}()
+
+			goredis.New(opts)
+		})
+	}
+}
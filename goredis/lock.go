@@ -0,0 +1,324 @@
+package goredis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	defaultLockTTL           = 30 * time.Second
+	defaultLockRetryInterval = 100 * time.Millisecond
+	defaultReleaseTimeout    = 5 * time.Second
+	lockExtendDivisor        = 3
+)
+
+var (
+	ErrLockNotAcquired = errors.New("lock not acquired")
+	ErrLockNotHeld     = errors.New("lock is not held")
+	ErrEmptyLockKey    = errors.New("lock key cannot be empty")
+)
+
+// Deletes the key only when it still holds our token.
+const releaseLockScript = `
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`
+
+// Pushes the expiry forward only when the key still holds our token.
+const extendLockScript = `
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0
+`
+
+// LockOption configures how locks and semaphore permits are acquired and kept.
+type LockOption struct {
+	TTL              time.Duration // Lease length, the lock expires after it unless extended.
+	RetryInterval    time.Duration // Wait between acquisition attempts while the lock is busy.
+	DisableAutoRenew bool          // Turns off the background lease extension while the lock is held.
+}
+
+func (o *LockOption) withDefaults() LockOption {
+	opts := LockOption{
+		TTL:              defaultLockTTL,
+		RetryInterval:    defaultLockRetryInterval,
+		DisableAutoRenew: false,
+	}
+
+	if o == nil {
+		return opts
+	}
+
+	opts.DisableAutoRenew = o.DisableAutoRenew
+
+	if o.TTL > 0 {
+		opts.TTL = o.TTL
+	}
+
+	if o.RetryInterval > 0 {
+		opts.RetryInterval = o.RetryInterval
+	}
+
+	return opts
+}
+
+// Locker hands out mutually exclusive locks identified by a Redis key.
+type Locker struct {
+	redis   *Redis
+	opts    LockOption
+	release *redis.Script
+	extend  *redis.Script
+}
+
+func NewLocker(rds *Redis, opts *LockOption) *Locker {
+	return &Locker{
+		redis:   rds,
+		opts:    opts.withDefaults(),
+		release: redis.NewScript(releaseLockScript),
+		extend:  redis.NewScript(extendLockScript),
+	}
+}
+
+// Obtain blocks until the lock is acquired or ctx is done.
+func (l *Locker) Obtain(ctx context.Context, key string) (*Lock, error) {
+	return acquire(ctx, l.opts.RetryInterval, func() (*Lock, error) {
+		return l.TryObtain(ctx, key)
+	})
+}
+
+// TryObtain makes a single attempt and returns ErrLockNotAcquired when the lock is busy.
+func (l *Locker) TryObtain(ctx context.Context, key string) (*Lock, error) {
+	if key == "" {
+		return nil, ErrEmptyLockKey
+	}
+
+	token := uuid.NewString()
+
+	ok, err := l.redis.SetNX(ctx, key, token, l.opts.TTL).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		return nil, ErrLockNotAcquired
+	}
+
+	lck := &Lock{
+		lease: newLease(key, token, l.opts, func(ctx context.Context, ttl time.Duration) (bool, error) {
+			return runScript(ctx, l.redis, l.extend, key, token, ttl.Milliseconds())
+		}, func(ctx context.Context) (bool, error) {
+			return runScript(ctx, l.redis, l.release, key, token)
+		}),
+	}
+
+	return lck, nil
+}
+
+// Do runs fn while holding the lock on key. The context given to fn is cancelled when the lease is lost.
+func (l *Locker) Do(ctx context.Context, key string, fn func(context.Context) error) error {
+	lck, err := l.Obtain(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	return runLeased(ctx, lck.lease, fn)
+}
+
+// Lock is a held lock. Its lease is extended in the background until Release is called.
+type Lock struct {
+	*lease
+}
+
+// lease tracks ownership of a token and keeps it alive.
+type lease struct {
+	key       string
+	token     string
+	ttl       time.Duration
+	extendFn  func(context.Context, time.Duration) (bool, error)
+	releaseFn func(context.Context) (bool, error)
+	lost      chan struct{}
+	stop      chan struct{}
+	done      chan struct{}
+	once      sync.Once
+}
+
+func newLease(
+	key, token string,
+	opts LockOption,
+	extendFn func(context.Context, time.Duration) (bool, error),
+	releaseFn func(context.Context) (bool, error),
+) *lease {
+	lse := &lease{
+		key:       key,
+		token:     token,
+		ttl:       opts.TTL,
+		extendFn:  extendFn,
+		releaseFn: releaseFn,
+		lost:      make(chan struct{}),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+		once:      sync.Once{},
+	}
+
+	if opts.DisableAutoRenew {
+		close(lse.done)
+	} else {
+		go lse.renew()
+	}
+
+	return lse
+}
+
+func (l *lease) Key() string {
+	return l.key
+}
+
+func (l *lease) Token() string {
+	return l.token
+}
+
+// Lost is closed when the lease could not be extended and ownership may have passed to someone else.
+func (l *lease) Lost() <-chan struct{} {
+	return l.lost
+}
+
+// Extend pushes the expiry to ttl from now.
+func (l *lease) Extend(ctx context.Context, ttl time.Duration) error {
+	ok, err := l.extendFn(ctx, ttl)
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return ErrLockNotHeld
+	}
+
+	return nil
+}
+
+// Release stops the background renewal and gives the lease back.
+func (l *lease) Release(ctx context.Context) error {
+	l.once.Do(func() {
+		close(l.stop)
+	})
+
+	<-l.done
+
+	ok, err := l.releaseFn(ctx)
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return ErrLockNotHeld
+	}
+
+	return nil
+}
+
+func (l *lease) renew() {
+	defer close(l.done)
+
+	ticker := time.NewTicker(l.ttl / lockExtendDivisor)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), l.ttl/lockExtendDivisor)
+			err := l.Extend(ctx, l.ttl)
+
+			cancel()
+
+			if errors.Is(err, ErrLockNotHeld) {
+				log.Error().Str("key", l.key).Msg("Lease lost, stopping renewal")
+				close(l.lost)
+
+				return
+			}
+
+			if err != nil {
+				log.Error().Err(err).Str("key", l.key).Msg("Failed to extend lease, retrying")
+			}
+		}
+	}
+}
+
+func runLeased(ctx context.Context, lse *lease, fn func(context.Context) error) error {
+	fnCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go func() {
+		select {
+		case <-lse.Lost():
+			cancel()
+		case <-fnCtx.Done():
+		}
+	}()
+
+	err := fn(fnCtx)
+
+	releaseCtx, releaseCancel := releaseContext()
+	defer releaseCancel()
+
+	if releaseErr := lse.Release(releaseCtx); releaseErr != nil {
+		log.Error().Err(releaseErr).Str("key", lse.Key()).Msg("Failed to release lease")
+	}
+
+	return err
+}
+
+// acquire retries try until it succeeds, fails with something other than ErrLockNotAcquired, or ctx is done.
+func acquire[T any](ctx context.Context, interval time.Duration, try func() (T, error)) (T, error) {
+	var zero T
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		res, err := try()
+		if err == nil {
+			return res, nil
+		}
+
+		if ctx.Err() != nil {
+			return zero, fmt.Errorf("%w: %w", ErrLockNotAcquired, ctx.Err())
+		}
+
+		if !errors.Is(err, ErrLockNotAcquired) {
+			return zero, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return zero, fmt.Errorf("%w: %w", ErrLockNotAcquired, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+func runScript(ctx context.Context, rds *Redis, script *redis.Script, key string, args ...any) (bool, error) {
+	res, err := script.Run(ctx, rds, []string{key}, args...).Int64()
+	if err != nil {
+		return false, err
+	}
+
+	return res == 1, nil
+}
+
+// releaseContext is used when the caller's context may already be cancelled.
+func releaseContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), defaultReleaseTimeout)
+}
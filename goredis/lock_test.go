@@ -0,0 +1,154 @@
+package goredis_test
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thienhaole92/uframework/goredis"
+)
+
+func TestLocker(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	redis := newTestRedis(ctx, t)
+
+	locker := goredis.NewLocker(redis, &goredis.LockOption{
+		TTL:              300 * time.Millisecond,
+		RetryInterval:    10 * time.Millisecond,
+		DisableAutoRenew: false,
+	})
+
+	lock, err := locker.TryObtain(ctx, "lock")
+	require.NoError(t, err)
+
+	_, err = locker.TryObtain(ctx, "lock")
+	require.ErrorIs(t, err, goredis.ErrLockNotAcquired)
+
+	// The lease is renewed in the background, so the lock outlives its TTL.
+	time.Sleep(time.Second)
+
+	waitCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+
+	_, err = locker.Obtain(waitCtx, "lock")
+	require.ErrorIs(t, err, goredis.ErrLockNotAcquired)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	require.NoError(t, lock.Release(ctx))
+
+	lock, err = locker.Obtain(ctx, "lock")
+	require.NoError(t, err)
+	require.NoError(t, lock.Release(ctx))
+	require.ErrorIs(t, lock.Release(ctx), goredis.ErrLockNotHeld)
+}
+
+func TestLocker_Expired(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	redis := newTestRedis(ctx, t)
+
+	locker := goredis.NewLocker(redis, &goredis.LockOption{
+		TTL:              100 * time.Millisecond,
+		RetryInterval:    10 * time.Millisecond,
+		DisableAutoRenew: true,
+	})
+
+	lock, err := locker.TryObtain(ctx, "lock")
+	require.NoError(t, err)
+
+	time.Sleep(200 * time.Millisecond)
+
+	other, err := locker.TryObtain(ctx, "lock")
+	require.NoError(t, err)
+
+	// The expired holder must not be able to release or extend someone else's lock.
+	require.ErrorIs(t, lock.Extend(ctx, time.Second), goredis.ErrLockNotHeld)
+	require.ErrorIs(t, lock.Release(ctx), goredis.ErrLockNotHeld)
+	require.NoError(t, other.Release(ctx))
+}
+
+func TestLocker_Do(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	redis := newTestRedis(ctx, t)
+
+	locker := goredis.NewLocker(redis, nil)
+
+	var (
+		running    atomic.Int32
+		overlapped atomic.Bool
+		waitGroup  sync.WaitGroup
+	)
+
+	for range 5 {
+		waitGroup.Add(1)
+
+		go func() {
+			defer waitGroup.Done()
+
+			err := locker.Do(ctx, "do", func(context.Context) error {
+				if running.Add(1) > 1 {
+					overlapped.Store(true)
+				}
+
+				time.Sleep(20 * time.Millisecond)
+				running.Add(-1)
+
+				return nil
+			})
+			assert.NoError(t, err)
+		}()
+	}
+
+	waitGroup.Wait()
+	require.False(t, overlapped.Load())
+}
+
+func TestSemaphore(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	redis := newTestRedis(ctx, t)
+
+	semaphore, err := goredis.NewSemaphore(redis, "semaphore", 2, &goredis.LockOption{
+		TTL:              time.Second,
+		RetryInterval:    10 * time.Millisecond,
+		DisableAutoRenew: false,
+	})
+	require.NoError(t, err)
+
+	first, err := semaphore.TryAcquire(ctx)
+	require.NoError(t, err)
+
+	second, err := semaphore.TryAcquire(ctx)
+	require.NoError(t, err)
+
+	_, err = semaphore.TryAcquire(ctx)
+	require.ErrorIs(t, err, goredis.ErrLockNotAcquired)
+
+	require.NoError(t, first.Release(ctx))
+
+	third, err := semaphore.Acquire(ctx)
+	require.NoError(t, err)
+
+	require.NoError(t, second.Release(ctx))
+	require.NoError(t, third.Release(ctx))
+}
+
+func TestSemaphore_InvalidOptions(t *testing.T) {
+	t.Parallel()
+
+	_, err := goredis.NewSemaphore(nil, "", 1, nil)
+	require.ErrorIs(t, err, goredis.ErrEmptyLockKey)
+
+	_, err = goredis.NewSemaphore(nil, "semaphore", 0, nil)
+	require.ErrorIs(t, err, goredis.ErrInvalidSemaphoreLimit)
+}
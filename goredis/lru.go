@@ -0,0 +1,182 @@
+package goredis
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+type lruEntry struct {
+	key       string
+	value     []byte
+	expiresAt time.Time
+}
+
+// lruLoad tracks the reads of a key from the next tier. Its generation is bumped whenever the key
+// is written or removed, so a read that raced with the change does not fill the cache.
+type lruLoad struct {
+	readers    int
+	generation uint64
+}
+
+// lruCache is a fixed-capacity, thread-safe LRU cache with per-entry expiry.
+type lruCache struct {
+	capacity int
+	ttl      time.Duration
+	items    map[string]*list.Element
+	order    *list.List
+	loads    map[string]*lruLoad // Keys being read from the next tier.
+	mux      sync.Mutex
+}
+
+func newLRUCache(capacity int, ttl time.Duration) *lruCache {
+	return &lruCache{
+		capacity: capacity,
+		ttl:      ttl,
+		items:    make(map[string]*list.Element, capacity),
+		order:    list.New(),
+		loads:    make(map[string]*lruLoad),
+		mux:      sync.Mutex{},
+	}
+}
+
+func (c *lruCache) get(key string) ([]byte, bool) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	elem, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+
+	//nolint:forcetypeassert
+	entry := elem.Value.(*lruEntry)
+	if c.ttl > 0 && time.Now().After(entry.expiresAt) {
+		c.removeElement(elem)
+
+		return nil, false
+	}
+
+	c.order.MoveToFront(elem)
+
+	return entry.value, true
+}
+
+// set stores value for ttl, or for the TTL of the cache when it is shorter or ttl is zero.
+func (c *lruCache) set(key string, value []byte, ttl time.Duration) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	c.invalidateLoads(key)
+	c.store(key, value, ttl)
+}
+
+// load registers a read of key from the next tier, and returns the generation to pass to fill.
+// Every load must be followed by fill or unload.
+func (c *lruCache) load(key string) uint64 {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	l, ok := c.loads[key]
+	if !ok {
+		l = &lruLoad{readers: 0, generation: 0}
+		c.loads[key] = l
+	}
+
+	l.readers++
+
+	return l.generation
+}
+
+// fill stores the value read since load, unless key was written or removed in the meantime.
+func (c *lruCache) fill(key string, value []byte, generation uint64) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if c.unloadLocked(key) == generation {
+		c.store(key, value, c.ttl)
+	}
+}
+
+// unload ends a load that did not read a value.
+func (c *lruCache) unload(key string) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	c.unloadLocked(key)
+}
+
+func (c *lruCache) unloadLocked(key string) uint64 {
+	l := c.loads[key]
+
+	l.readers--
+	if l.readers == 0 {
+		delete(c.loads, key)
+	}
+
+	return l.generation
+}
+
+func (c *lruCache) invalidateLoads(keys ...string) {
+	for _, key := range keys {
+		if l, ok := c.loads[key]; ok {
+			l.generation++
+		}
+	}
+}
+
+func (c *lruCache) store(key string, value []byte, ttl time.Duration) {
+	if ttl <= 0 || ttl > c.ttl {
+		ttl = c.ttl
+	}
+
+	expiresAt := time.Now().Add(ttl)
+
+	if elem, ok := c.items[key]; ok {
+		//nolint:forcetypeassert
+		entry := elem.Value.(*lruEntry)
+		entry.value = value
+		entry.expiresAt = expiresAt
+		c.order.MoveToFront(elem)
+
+		return
+	}
+
+	c.items[key] = c.order.PushFront(&lruEntry{key: key, value: value, expiresAt: expiresAt})
+
+	for c.order.Len() > c.capacity {
+		c.removeElement(c.order.Back())
+	}
+}
+
+func (c *lruCache) remove(keys ...string) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	c.invalidateLoads(keys...)
+
+	for _, key := range keys {
+		if elem, ok := c.items[key]; ok {
+			c.removeElement(elem)
+		}
+	}
+}
+
+func (c *lruCache) purge() {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	for _, l := range c.loads {
+		l.generation++
+	}
+
+	c.items = make(map[string]*list.Element, c.capacity)
+	c.order.Init()
+}
+
+func (c *lruCache) removeElement(elem *list.Element) {
+	c.order.Remove(elem)
+
+	//nolint:forcetypeassert
+	delete(c.items, elem.Value.(*lruEntry).key)
+}
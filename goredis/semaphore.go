@@ -0,0 +1,120 @@
+package goredis
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+var ErrInvalidSemaphoreLimit = errors.New("semaphore limit must be greater than zero")
+
+// Permits live in a sorted set scored by their expiry in milliseconds. Expired permits are
+// dropped before counting, so a crashed holder frees its slot once its lease runs out.
+const acquireSemaphoreScript = `
+local now = redis.call("TIME")
+local nowMs = tonumber(now[1]) * 1000 + math.floor(tonumber(now[2]) / 1000)
+redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", nowMs)
+if redis.call("ZCARD", KEYS[1]) < tonumber(ARGV[2]) then
+	redis.call("ZADD", KEYS[1], nowMs + tonumber(ARGV[3]), ARGV[1])
+	redis.call("PEXPIRE", KEYS[1], ARGV[3])
+	return 1
+end
+return 0
+`
+
+const extendSemaphoreScript = `
+if not redis.call("ZSCORE", KEYS[1], ARGV[1]) then
+	return 0
+end
+local now = redis.call("TIME")
+local nowMs = tonumber(now[1]) * 1000 + math.floor(tonumber(now[2]) / 1000)
+redis.call("ZADD", KEYS[1], "XX", nowMs + tonumber(ARGV[2]), ARGV[1])
+if redis.call("PTTL", KEYS[1]) < tonumber(ARGV[2]) then
+	redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 1
+`
+
+const releaseSemaphoreScript = `
+return redis.call("ZREM", KEYS[1], ARGV[1])
+`
+
+// Semaphore limits how many holders may share a Redis key at the same time.
+type Semaphore struct {
+	redis   *Redis
+	key     string
+	limit   int64
+	opts    LockOption
+	acquire *redis.Script
+	extend  *redis.Script
+	release *redis.Script
+}
+
+func NewSemaphore(rds *Redis, key string, limit int64, opts *LockOption) (*Semaphore, error) {
+	if key == "" {
+		return nil, ErrEmptyLockKey
+	}
+
+	if limit <= 0 {
+		return nil, ErrInvalidSemaphoreLimit
+	}
+
+	return &Semaphore{
+		redis:   rds,
+		key:     key,
+		limit:   limit,
+		opts:    opts.withDefaults(),
+		acquire: redis.NewScript(acquireSemaphoreScript),
+		extend:  redis.NewScript(extendSemaphoreScript),
+		release: redis.NewScript(releaseSemaphoreScript),
+	}, nil
+}
+
+// Acquire blocks until a permit is free or ctx is done.
+func (s *Semaphore) Acquire(ctx context.Context) (*Permit, error) {
+	return acquire(ctx, s.opts.RetryInterval, func() (*Permit, error) {
+		return s.TryAcquire(ctx)
+	})
+}
+
+// TryAcquire makes a single attempt and returns ErrLockNotAcquired when every permit is taken.
+func (s *Semaphore) TryAcquire(ctx context.Context) (*Permit, error) {
+	token := uuid.NewString()
+
+	ok, err := runScript(ctx, s.redis, s.acquire, s.key, token, s.limit, s.opts.TTL.Milliseconds())
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		return nil, ErrLockNotAcquired
+	}
+
+	permit := &Permit{
+		lease: newLease(s.key, token, s.opts, func(ctx context.Context, ttl time.Duration) (bool, error) {
+			return runScript(ctx, s.redis, s.extend, s.key, token, ttl.Milliseconds())
+		}, func(ctx context.Context) (bool, error) {
+			return runScript(ctx, s.redis, s.release, s.key, token)
+		}),
+	}
+
+	return permit, nil
+}
+
+// Do runs fn while holding a permit. The context given to fn is cancelled when the lease is lost.
+func (s *Semaphore) Do(ctx context.Context, fn func(context.Context) error) error {
+	permit, err := s.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+
+	return runLeased(ctx, permit.lease, fn)
+}
+
+// Permit is one held slot of a Semaphore. Its lease is extended in the background until Release is called.
+type Permit struct {
+	*lease
+}
@@ -0,0 +1,77 @@
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+	"github.com/thienhaole92/uframework/apperror"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Code returns the gRPC code of an application error code.
+func Code(code apperror.Code) codes.Code {
+	switch code {
+	case apperror.CodeNotFound:
+		return codes.NotFound
+	case apperror.CodeInvalidArgument:
+		return codes.InvalidArgument
+	case apperror.CodeConflict:
+		return codes.AlreadyExists
+	case apperror.CodeUnauthorized:
+		return codes.Unauthenticated
+	case apperror.CodeInternal:
+		return codes.Internal
+	default:
+		return codes.Internal
+	}
+}
+
+// ErrorUnaryInterceptor turns the *apperror.Error returned by handlers into a status of the
+// matching code. The status carries an errdetails.ErrorInfo with the error code as reason and the
+// details as metadata. Other errors are returned unchanged. New installs it on every server.
+func ErrorUnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		res, err := handler(ctx, req)
+
+		return res, toStatus(err)
+	}
+}
+
+// ErrorStreamInterceptor is the stream counterpart of ErrorUnaryInterceptor.
+func ErrorStreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, sss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return toStatus(handler(srv, sss))
+	}
+}
+
+func toStatus(err error) error {
+	var appErr *apperror.Error
+	if !errors.As(err, &appErr) {
+		return err
+	}
+
+	st := status.New(Code(appErr.Code), appErr.Message)
+
+	metadata := make(map[string]string, len(appErr.Details))
+	for key, value := range appErr.Details {
+		metadata[key] = fmt.Sprint(value)
+	}
+
+	withDetails, detailsErr := st.WithDetails(&errdetails.ErrorInfo{
+		Reason:   string(appErr.Code),
+		Domain:   "",
+		Metadata: metadata,
+	})
+	if detailsErr != nil {
+		log.Error().Err(detailsErr).Msg("Failed to add error details to gRPC status")
+
+		return st.Err()
+	}
+
+	return withDetails.Err()
+}
@@ -0,0 +1,90 @@
+package grpcserver_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/thienhaole92/uframework/apperror"
+	"github.com/thienhaole92/uframework/grpcserver"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var errStream = errors.New("stream broken")
+
+func TestErrorUnaryInterceptor(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		err  error
+		code codes.Code
+	}{
+		{"not found", fmt.Errorf("get: %w", apperror.NotFound("order not found")), codes.NotFound},
+		{"invalid argument", apperror.InvalidArgument("invalid order"), codes.InvalidArgument},
+		{"conflict", apperror.Conflict("order already exists"), codes.AlreadyExists},
+		{"unauthorized", apperror.Unauthorized("token expired"), codes.Unauthenticated},
+		{"internal", apperror.Internal(errStream), codes.Internal},
+		{"status", status.Error(codes.Unavailable, "unavailable"), codes.Unavailable},
+	}
+
+	info := &grpc.UnaryServerInfo{Server: nil, FullMethod: "/test.Service/Call"}
+	interceptor := grpcserver.ErrorUnaryInterceptor()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := interceptor(context.Background(), nil, info, func(_ context.Context, _ any) (any, error) {
+				return nil, tt.err
+			})
+			require.Equal(t, tt.code, status.Code(err))
+		})
+	}
+
+	res, err := interceptor(context.Background(), nil, info, func(_ context.Context, _ any) (any, error) {
+		return "ok", nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, "ok", res)
+}
+
+func TestErrorUnaryInterceptor_Details(t *testing.T) {
+	t.Parallel()
+
+	info := &grpc.UnaryServerInfo{Server: nil, FullMethod: "/test.Service/Call"}
+
+	_, err := grpcserver.ErrorUnaryInterceptor()(context.Background(), nil, info, func(_ context.Context, _ any) (any, error) {
+		return nil, apperror.Internal(errStream).WithDetail("order_id", 42)
+	})
+
+	st := status.Convert(err)
+	require.Equal(t, "internal error", st.Message())
+	require.Len(t, st.Details(), 1)
+
+	errInfo, ok := st.Details()[0].(*errdetails.ErrorInfo)
+	require.True(t, ok)
+	require.Equal(t, "INTERNAL", errInfo.GetReason())
+	require.Equal(t, map[string]string{"order_id": "42"}, errInfo.GetMetadata())
+}
+
+func TestErrorStreamInterceptor(t *testing.T) {
+	t.Parallel()
+
+	info := &grpc.StreamServerInfo{FullMethod: "/test.Service/Stream", IsClientStream: false, IsServerStream: true}
+
+	err := grpcserver.ErrorStreamInterceptor()(nil, nil, info, func(_ any, _ grpc.ServerStream) error {
+		return apperror.NotFound("order not found")
+	})
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	err = grpcserver.ErrorStreamInterceptor()(nil, nil, info, func(_ any, _ grpc.ServerStream) error {
+		return errStream
+	})
+	require.ErrorIs(t, err, errStream)
+}
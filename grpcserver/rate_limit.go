@@ -0,0 +1,127 @@
+package grpcserver
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/thienhaole92/uframework/ratelimit"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	MetadataRateLimitLimit     = "ratelimit-limit"
+	MetadataRateLimitRemaining = "ratelimit-remaining"
+	MetadataRateLimitReset     = "ratelimit-reset"
+	MetadataRetryAfter         = "retry-after"
+)
+
+// RateLimitKeyFunc returns the identity a call is counted against.
+type RateLimitKeyFunc func(ctx context.Context, fullMethod string) (string, error)
+
+// RateLimitByPeer counts calls per client address.
+func RateLimitByPeer(ctx context.Context, _ string) (string, error) {
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		return "peer:" + p.Addr.String(), nil
+	}
+
+	return "peer:unknown", nil
+}
+
+// RateLimitByMethod counts calls per RPC method, shared by every client.
+func RateLimitByMethod(_ context.Context, fullMethod string) (string, error) {
+	return "method:" + fullMethod, nil
+}
+
+// RateLimitByMetadata counts calls per value of the given metadata key, such as a user ID
+// set by an authenticating proxy, falling back to the client address.
+func RateLimitByMetadata(key string) RateLimitKeyFunc {
+	return func(ctx context.Context, fullMethod string) (string, error) {
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			if values := md.Get(key); len(values) > 0 && values[0] != "" {
+				return key + ":" + values[0], nil
+			}
+		}
+
+		return RateLimitByPeer(ctx, fullMethod)
+	}
+}
+
+// RateLimitUnaryInterceptor rejects calls over the limit with codes.ResourceExhausted.
+// Limiter errors are logged and the call is let through.
+func RateLimitUnaryInterceptor(limiter ratelimit.Limiter, keyFunc RateLimitKeyFunc) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if err := checkRateLimit(ctx, limiter, keyFunc, info.FullMethod, func(md metadata.MD) error {
+			return grpc.SetHeader(ctx, md)
+		}); err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// RateLimitStreamInterceptor applies the limit once when a stream is opened.
+func RateLimitStreamInterceptor(limiter ratelimit.Limiter, keyFunc RateLimitKeyFunc) grpc.StreamServerInterceptor {
+	return func(srv any, sss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := checkRateLimit(sss.Context(), limiter, keyFunc, info.FullMethod, sss.SetHeader); err != nil {
+			return err
+		}
+
+		return handler(srv, sss)
+	}
+}
+
+func checkRateLimit(
+	ctx context.Context,
+	limiter ratelimit.Limiter,
+	keyFunc RateLimitKeyFunc,
+	fullMethod string,
+	setHeader func(metadata.MD) error,
+) error {
+	if keyFunc == nil {
+		keyFunc = RateLimitByPeer
+	}
+
+	key, err := keyFunc(ctx, fullMethod)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	res, err := limiter.Allow(ctx, key)
+	if err != nil {
+		log.Error().Err(err).Str("key", key).Str("method", fullMethod).Msg("Rate limiter failed")
+
+		return nil
+	}
+
+	md := metadata.Pairs(
+		MetadataRateLimitLimit, strconv.FormatInt(res.Limit, 10),
+		MetadataRateLimitRemaining, strconv.FormatInt(res.Remaining, 10),
+		MetadataRateLimitReset, strconv.FormatInt(ceilSeconds(res.ResetAfter), 10),
+	)
+
+	if !res.Allowed {
+		md.Set(MetadataRetryAfter, strconv.FormatInt(ceilSeconds(res.RetryAfter), 10))
+	}
+
+	if err := setHeader(md); err != nil {
+		log.Error().Err(err).Str("method", fullMethod).Msg("Failed to set rate limit metadata")
+	}
+
+	if !res.Allowed {
+		return status.Errorf(codes.ResourceExhausted, "rate limit exceeded, retry after %s", res.RetryAfter)
+	}
+
+	return nil
+}
+
+func ceilSeconds(d time.Duration) int64 {
+	return int64(math.Ceil(d.Seconds()))
+}
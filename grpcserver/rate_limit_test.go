@@ -0,0 +1,66 @@
+package grpcserver_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/thienhaole92/uframework/grpcserver"
+	"github.com/thienhaole92/uframework/ratelimit"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type stubLimiter struct {
+	allowed bool
+	key     string
+}
+
+func (s *stubLimiter) Allow(_ context.Context, key string) (*ratelimit.Result, error) {
+	s.key = key
+
+	return &ratelimit.Result{
+		Allowed:    s.allowed,
+		Limit:      5,
+		Remaining:  0,
+		ResetAfter: time.Second,
+		RetryAfter: time.Second,
+		Window:     time.Second,
+	}, nil
+}
+
+func TestRateLimitUnaryInterceptor(t *testing.T) {
+	t.Parallel()
+
+	info := &grpc.UnaryServerInfo{Server: nil, FullMethod: "/test.Service/Call"}
+	handler := func(_ context.Context, _ any) (any, error) {
+		return "ok", nil
+	}
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-user-id", "42"))
+
+	limiter := &stubLimiter{allowed: true, key: ""}
+	interceptor := grpcserver.RateLimitUnaryInterceptor(limiter, grpcserver.RateLimitByMetadata("x-user-id"))
+
+	res, err := interceptor(ctx, nil, info, handler)
+	require.NoError(t, err)
+	require.Equal(t, "ok", res)
+	require.Equal(t, "x-user-id:42", limiter.key)
+
+	limiter.allowed = false
+
+	res, err = interceptor(ctx, nil, info, handler)
+	require.Nil(t, res)
+	require.Equal(t, codes.ResourceExhausted, status.Code(err))
+}
+
+func TestRateLimitByMethod(t *testing.T) {
+	t.Parallel()
+
+	key, err := grpcserver.RateLimitByMethod(context.Background(), "/test.Service/Call")
+	require.NoError(t, err)
+	require.Equal(t, "method:/test.Service/Call", key)
+}
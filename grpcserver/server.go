@@ -7,7 +7,9 @@ import (
 	"time"
 
 	"github.com/rs/zerolog/log"
+	"github.com/thienhaole92/uframework/tlsconfig"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/keepalive"
 )
 
@@ -24,13 +26,18 @@ const (
 type Option struct {
 	Host                  string
 	Port                  int
-	MaxRecvMsgSize        int           // Maximum message size the server can receive.
-	KeepaliveEnforcement  time.Duration // Minimum time between client pings.
-	MaxConnectionIdle     time.Duration // Maximum time a connection can be idle.
-	MaxConnectionAge      time.Duration // Maximum lifetime of a connection.
-	MaxConnectionAgeGrace time.Duration // Grace period for closing connections.
-	KeepaliveTime         time.Duration // Time after which a ping is sent if the connection is idle.
-	KeepaliveTimeout      time.Duration // Time to wait for a ping acknowledgment.
+	MaxRecvMsgSize        int               // Maximum message size the server can receive.
+	KeepaliveEnforcement  time.Duration     // Minimum time between client pings.
+	MaxConnectionIdle     time.Duration     // Maximum time a connection can be idle.
+	MaxConnectionAge      time.Duration     // Maximum lifetime of a connection.
+	MaxConnectionAgeGrace time.Duration     // Grace period for closing connections.
+	KeepaliveTime         time.Duration     // Time after which a ping is sent if the connection is idle.
+	KeepaliveTimeout      time.Duration     // Time to wait for a ping acknowledgment.
+	TLS                   *tlsconfig.Option // Serves over TLS when set.
+
+	// Extra interceptors, chained after the built-in logging and error interceptors.
+	UnaryInterceptors  []grpc.UnaryServerInterceptor
+	StreamInterceptors []grpc.StreamServerInterceptor
 }
 
 func (o *Option) setDefaults() {
@@ -88,8 +95,26 @@ func New(opts *Option) *Server {
 			Time:                  opts.KeepaliveTime,
 			Timeout:               opts.KeepaliveTimeout,
 		}),
-		grpc.UnaryInterceptor(unaryInterceptor),   // Add the unary interceptor.
-		grpc.StreamInterceptor(streamInterceptor), // Add the stream interceptor.
+		// Add the unary interceptors, application errors are converted before they are logged.
+		grpc.ChainUnaryInterceptor(append(
+			[]grpc.UnaryServerInterceptor{unaryInterceptor, ErrorUnaryInterceptor()},
+			opts.UnaryInterceptors...,
+		)...),
+		// Add the stream interceptors.
+		grpc.ChainStreamInterceptor(append(
+			[]grpc.StreamServerInterceptor{streamInterceptor, ErrorStreamInterceptor()},
+			opts.StreamInterceptors...,
+		)...),
+	}
+
+	// Enable TLS if configured.
+	if opts.TLS != nil {
+		tlsConfig, err := tlsconfig.NewServerConfig(opts.TLS)
+		if err != nil {
+			log.Panic().Err(err).Msg("Failed to build gRPC server TLS config")
+		}
+
+		options = append(options, grpc.Creds(credentials.NewTLS(tlsConfig)))
 	}
 
 	// Create a new gRPC server with the configured options.
@@ -5,9 +5,10 @@ import (
 	"github.com/thienhaole92/uframework/notifylog"
 )
 
-type Delegate[REQ any] func(notifylog.NotifyLog, echo.Context, *REQ) (*Response, *echo.HTTPError)
+// Delegate handles a request. E is error for delegates returning *apperror.Error, or *echo.HTTPError.
+type Delegate[REQ any, E error] func(notifylog.NotifyLog, echo.Context, *REQ) (*Response, E)
 
-func Call[REQ any](e echo.Context, request *REQ, name string, delegate Delegate[REQ]) (*Response, *echo.HTTPError) {
+func Call[REQ any, E error](e echo.Context, request *REQ, name string, delegate Delegate[REQ, E]) (*Response, E) {
 	log := notifylog.New(name, notifylog.JSON)
 
 	res, err := delegate(log, e, request)
@@ -2,6 +2,7 @@ package httpserver
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -15,6 +16,7 @@ import (
 	echomiddleware "github.com/labstack/echo/v4/middleware"
 	"github.com/rs/zerolog/log"
 	"github.com/thienhaole92/uframework/middleware"
+	"github.com/thienhaole92/uframework/tlsconfig"
 	"github.com/thienhaole92/uframework/validator"
 )
 
@@ -28,6 +30,10 @@ type Option struct {
 	GracePeriod      time.Duration
 	Subsystem        string
 	RequireRequestID bool
+	TLS              *tlsconfig.Option // Serves HTTPS when set.
+	// ProblemJSON writes errors as RFC 9457 application/problem+json bodies and hides the message
+	// of 5xx errors. See middleware.ErrorHandlerWithConfig.
+	ProblemJSON bool
 }
 
 type Server struct {
@@ -43,7 +49,12 @@ func New(opts *Option) *Server {
 
 	ech.HideBanner = true
 	ech.Validator = validator.DefaultRestValidator()
-	ech.HTTPErrorHandler = middleware.ErrorHandler(ech.DefaultHTTPErrorHandler)
+	ech.HTTPErrorHandler = middleware.ErrorHandlerWithConfig(middleware.ErrorHandlerConfig{
+		Next:               ech.DefaultHTTPErrorHandler,
+		ProblemJSON:        opts.ProblemJSON,
+		TypeBaseURI:        "",
+		HideInternalErrors: opts.ProblemJSON,
+	})
 
 	ech.Pre(middleware.RequestID(requestIDSkipper(opts.RequireRequestID)))
 	ech.Pre(echoprometheus.NewMiddleware(opts.Subsystem))
@@ -57,13 +68,24 @@ func New(opts *Option) *Server {
 	root := ech.Group("")
 	address := net.JoinHostPort(opts.Host, strconv.Itoa(opts.Port))
 
+	var tlsConfig *tls.Config
+
+	if opts.TLS != nil {
+		cfg, err := tlsconfig.NewServerConfig(opts.TLS)
+		if err != nil {
+			log.Panic().Err(err).Msg("failed to build tls config")
+		}
+
+		tlsConfig = cfg
+	}
+
 	server := &http.Server{
 		Handler:                      ech,
 		ReadTimeout:                  opts.ReadTimeout,
 		WriteTimeout:                 opts.WriteTimeout,
 		Addr:                         address,
 		DisableGeneralOptionsHandler: false,
-		TLSConfig:                    nil,
+		TLSConfig:                    tlsConfig,
 		ReadHeaderTimeout:            0,
 		IdleTimeout:                  0,
 		MaxHeaderBytes:               0,
@@ -87,12 +109,21 @@ func (s *Server) Run() {
 	go func() {
 		log.Info().Str("address", s.address).Msg("start http server")
 
-		if err := s.Server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		if err := s.listenAndServe(); !errors.Is(err, http.ErrServerClosed) {
 			log.Panic().Err(err).Msg("failed to start server")
 		}
 	}()
 }
 
+func (s *Server) listenAndServe() error {
+	if s.Server.TLSConfig != nil {
+		// Certificates come from TLSConfig.GetCertificate.
+		return s.Server.ListenAndServeTLS("", "")
+	}
+
+	return s.Server.ListenAndServe()
+}
+
 func (s *Server) Close() {
 	ctx, cancel := context.WithTimeout(context.TODO(), s.gracePeriod)
 	defer cancel()
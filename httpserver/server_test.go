@@ -52,6 +52,8 @@ func TestNewServer(t *testing.T) {
 		GracePeriod:      time.Second * 10,
 		Subsystem:        "echo",
 		RequireRequestID: true,
+		TLS:              nil,
+		ProblemJSON:      false,
 	}
 
 	headers := map[string]string{
@@ -90,6 +92,8 @@ func TestServerWithMiddleware_Success(t *testing.T) {
 		GracePeriod:      time.Second * 10,
 		Subsystem:        "success",
 		RequireRequestID: true,
+		TLS:              nil,
+		ProblemJSON:      false,
 	}
 
 	headers := map[string]string{
@@ -126,6 +130,8 @@ func TestServerWithMiddleware_Failure(t *testing.T) {
 		GracePeriod:      time.Second * 10,
 		Subsystem:        "failure",
 		RequireRequestID: true,
+		TLS:              nil,
+		ProblemJSON:      false,
 	}
 
 	headers := map[string]string{
@@ -148,6 +154,55 @@ func TestServerWithMiddleware_Failure(t *testing.T) {
 	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code, "Expected status 413 Payload Too Large")
 }
 
+func TestServer_ProblemJSON(t *testing.T) {
+	t.Parallel()
+
+	opts := httpserver.Option{
+		Host:             "0.0.0.0",
+		Port:             80806,
+		EnableCors:       false,
+		BodyLimit:        "1M",
+		ReadTimeout:      time.Second * 10,
+		WriteTimeout:     time.Second * 10,
+		GracePeriod:      time.Second * 10,
+		Subsystem:        "problem",
+		RequireRequestID: true,
+		TLS:              nil,
+		ProblemJSON:      true,
+	}
+
+	requestID := uuid.NewString()
+	headers := map[string]string{
+		"Content-Type":        "application/json",
+		echo.HeaderXRequestID: requestID,
+	}
+
+	_, req, rec, server := SetupTestServer(http.MethodPost, "/users", headers, []byte(`{"username":"testuser"}`), opts)
+
+	server.Echo.POST("/users", httpserver.Wrapper(func(_ echo.Context, _ *MockRequest) (any, error) {
+		return nil, nil
+	}))
+
+	server.Echo.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	require.Equal(t, "application/problem+json", rec.Header().Get(echo.HeaderContentType))
+	require.JSONEq(t, `{
+		"type": "about:blank",
+		"title": "Bad Request",
+		"status": 400,
+		"detail": "request validation failed",
+		"instance": "/users",
+		"request_id": "`+requestID+`",
+		"code": "INVALID_ARGUMENT",
+		"errors": [{
+			"field": "password",
+			"rule": "required",
+			"message": "password is a required field"
+		}]
+	}`, rec.Body.String())
+}
+
 func TestRestLogFieldsExtractor(t *testing.T) {
 	t.Parallel()
 
@@ -1,17 +1,25 @@
 package httpserver
 
 import (
+	"errors"
 	"net/http"
 	"reflect"
 	"runtime"
+	"strings"
 	"time"
 
+	govalidator "github.com/go-playground/validator/v10"
 	"github.com/labstack/echo/v4"
+	"github.com/thienhaole92/uframework/apperror"
 	"github.com/thienhaole92/uframework/notifylog"
+	"github.com/thienhaole92/uframework/validator"
 )
 
-// Wrapper wraps a handler and adds logging, binding, and validation.
-func Wrapper[TREQ any](wrapped func(echo.Context, *TREQ) (any, *echo.HTTPError)) echo.HandlerFunc {
+// Wrapper wraps a handler and adds logging, binding, and validation. The handler may return an
+// *apperror.Error, or any error, which middleware.ErrorHandler turns into a response, or an
+// *echo.HTTPError. Requests failing validation are rejected with a 400 *echo.HTTPError wrapping an
+// apperror.CodeInvalidArgument error.
+func Wrapper[TREQ any, E error](wrapped func(echo.Context, *TREQ) (any, E)) echo.HandlerFunc {
 	return func(ectx echo.Context) error {
 		log := notifylog.New("wrapper", notifylog.JSON)
 		requestURI := ectx.Request().RequestURI
@@ -30,9 +38,9 @@ func Wrapper[TREQ any](wrapped func(echo.Context, *TREQ) (any, *echo.HTTPError))
 		ectx.Set(RequestObjectKey, req)
 
 		// Call the wrapped handler
-		res, err := wrapped(ectx, req)
-		if err != nil {
-			return err
+		res, handlerErr := wrapped(ectx, req)
+		if failed(handlerErr) {
+			return handlerErr
 		}
 
 		// Send the response
@@ -62,7 +70,18 @@ func logError(log *notifylog.NotifyLog, err error, path string, req any, msg str
 		Msg(msg)
 }
 
-func bindAndValidate[TREQ any](ectx echo.Context, log *notifylog.NotifyLog, path string) (*TREQ, *echo.HTTPError) {
+// failed reports whether err is set. A nil *echo.HTTPError is not a nil error once boxed.
+func failed(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	value := reflect.ValueOf(err)
+
+	return value.Kind() != reflect.Pointer || !value.IsNil()
+}
+
+func bindAndValidate[TREQ any](ectx echo.Context, log *notifylog.NotifyLog, path string) (*TREQ, error) {
 	var req TREQ
 
 	// Bind the request
@@ -80,16 +99,64 @@ func bindAndValidate[TREQ any](ectx echo.Context, log *notifylog.NotifyLog, path
 	if err := ectx.Validate(&req); err != nil {
 		logError(log, err, path, req, "request validation failed")
 
+		// The status is kept for echo's default error handler, middleware.ErrorHandler writes the
+		// application error with its field errors.
 		return nil, &echo.HTTPError{
 			Code:     http.StatusBadRequest,
 			Message:  err.Error(),
-			Internal: err,
+			Internal: validationError(ectx, err),
 		}
 	}
 
 	return &req, nil
 }
 
+// validationError reports the failed rule of each field, with messages in the language of the
+// Accept-Language header when the echo validator is a *validator.Validator.
+func validationError(ectx echo.Context, err error) *apperror.Error {
+	appErr := apperror.Wrap(err, apperror.CodeInvalidArgument, "request validation failed")
+
+	if v, ok := ectx.Echo().Validator.(*validator.Validator); ok {
+		return appErr.WithFields(v.FieldErrors(err, acceptedLanguages(ectx.Request())...)...)
+	}
+
+	var validationErrs govalidator.ValidationErrors
+	if !errors.As(err, &validationErrs) {
+		return appErr
+	}
+
+	fields := make([]apperror.FieldError, 0, len(validationErrs))
+	for _, fieldErr := range validationErrs {
+		fields = append(fields, apperror.FieldError{
+			Field:   fieldErr.Field(),
+			Rule:    fieldErr.Tag(),
+			Param:   fieldErr.Param(),
+			Message: fieldErr.Error(),
+		})
+	}
+
+	return appErr.WithFields(fields...)
+}
+
+// acceptedLanguages returns the locales of the Accept-Language header, by order of appearance,
+// in the form of the go-playground locales such as "pt_BR".
+func acceptedLanguages(req *http.Request) []string {
+	var languages []string
+
+	for _, language := range strings.Split(req.Header.Get("Accept-Language"), ",") {
+		language, _, _ = strings.Cut(language, ";")
+
+		language = strings.TrimSpace(language)
+		if language == "" || language == "*" {
+			continue
+		}
+
+		languages = append(languages, strings.ReplaceAll(language, "-", "_"))
+	}
+
+	return languages
+}
+
 func sendResponse(ectx echo.Context, log *notifylog.NotifyLog, status int, res any) error {
 	if status != 0 {
 		logRequestEnd(log, status)
@@ -7,6 +7,7 @@ import (
 
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/require"
+	"github.com/thienhaole92/uframework/apperror"
 	"github.com/thienhaole92/uframework/httpserver"
 	"github.com/thienhaole92/uframework/testutil"
 )
@@ -114,8 +115,61 @@ func TestWrapper_Failure_Validation(t *testing.T) {
 	// Assertions
 	require.Error(t, err, "Expected error due to validation failure")
 
-	var httpErr *echo.HTTPError
+	var appErr *apperror.Error
+
+	require.ErrorAs(t, err, &appErr, "Expected error of type *apperror.Error")
+	require.Equal(t, apperror.CodeInvalidArgument, appErr.Code, "Expected invalid argument error")
+	require.Len(t, appErr.Fields, 1)
+	require.Equal(t, apperror.FieldError{
+		Field:   "username",
+		Rule:    "required",
+		Param:   "",
+		Message: "username is a required field",
+	}, appErr.Fields[0])
+}
 
-	require.ErrorAs(t, err, &httpErr, "Expected error of type *echo.HTTPError")
-	require.Equal(t, http.StatusBadRequest, httpErr.Code, "Expected HTTP 400 Bad Request")
+func TestWrapper_AppError(t *testing.T) {
+	t.Parallel()
+
+	jsonPayload, err := json.Marshal(MockRequest{Username: "testuser", Password: "securepassword"})
+	require.NoError(t, err, "Failed to marshal JSON payload")
+
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{"nil", nil},
+		{"not found", apperror.NotFound("user not found")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, rec, _ := testutil.SetupEchoContext(t, &testutil.Options{
+				Method: http.MethodPost,
+				Path:   "/test",
+				Body:   jsonPayload,
+			})
+
+			// Handlers return plain errors, without depending on echo errors.
+			mockHandler := func(_ echo.Context, _ *MockRequest) (any, error) {
+				if tt.err != nil {
+					return nil, tt.err
+				}
+
+				return &httpserver.Response{RequestID: "123", Data: "Mock Response Data", Pagination: nil}, nil
+			}
+
+			err := httpserver.Wrapper(mockHandler)(ctx)
+			if tt.err != nil {
+				require.ErrorIs(t, err, tt.err)
+
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, http.StatusOK, rec.Code)
+		})
+	}
 }
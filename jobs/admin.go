@@ -0,0 +1,122 @@
+package jobs
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/thienhaole92/uframework/apperror"
+	"github.com/thienhaole92/uframework/httpserver"
+	"github.com/thienhaole92/uframework/notifylog"
+)
+
+const defaultPageLimit = 20
+
+type listFailedRequest struct {
+	Page  int64 `query:"page"  validate:"omitempty,min=1"`
+	Limit int64 `query:"limit" validate:"omitempty,min=1,max=100"`
+}
+
+type jobRequest struct {
+	ID string `param:"id" validate:"required"`
+}
+
+// RegisterAdminRoutes adds routes to inspect jobs and act on failed ones to group, for example the
+// group of the container mounted under an authenticated prefix:
+//
+//	jobs.RegisterAdminRoutes(c.MustEchoGroup().Group("/admin/jobs", auth), client)
+//
+// The routes are GET /failed, GET /:id, POST /:id/retry and DELETE /:id.
+func RegisterAdminRoutes(group *echo.Group, client *Client) {
+	admin := &admin{client: client}
+
+	group.GET("/failed", httpserver.Wrapper(admin.listFailed))
+	group.GET("/:id", httpserver.Wrapper(admin.get))
+	group.POST("/:id/retry", httpserver.Wrapper(admin.retry))
+	group.DELETE("/:id", httpserver.Wrapper(admin.delete))
+}
+
+type admin struct {
+	client *Client
+}
+
+func (a *admin) listFailed(ectx echo.Context, req *listFailedRequest) (any, *echo.HTTPError) {
+	return httpserver.Call(ectx, req, "jobs.listFailed",
+		func(_ notifylog.NotifyLog, ectx echo.Context, req *listFailedRequest) (*httpserver.Response, *echo.HTTPError) {
+			page := max(req.Page, 1)
+
+			limit := req.Limit
+			if limit == 0 {
+				limit = defaultPageLimit
+			}
+
+			jobs, total, err := a.client.ListFailed(ectx.Request().Context(), (page-1)*limit, limit)
+			if err != nil {
+				return nil, httpError(err)
+			}
+
+			return &httpserver.Response{
+				RequestID: "",
+				Data:      jobs,
+				Pagination: &httpserver.Pagination{
+					Limit:     limit,
+					Total:     total,
+					TotalPage: (total + limit - 1) / limit,
+				},
+			}, nil
+		})
+}
+
+func (a *admin) get(ectx echo.Context, req *jobRequest) (any, *echo.HTTPError) {
+	return httpserver.Call(ectx, req, "jobs.get",
+		func(_ notifylog.NotifyLog, ectx echo.Context, req *jobRequest) (*httpserver.Response, *echo.HTTPError) {
+			job, err := a.client.Get(ectx.Request().Context(), req.ID)
+			if err != nil {
+				return nil, httpError(err)
+			}
+
+			return &httpserver.Response{RequestID: "", Data: job, Pagination: nil}, nil
+		})
+}
+
+func (a *admin) retry(ectx echo.Context, req *jobRequest) (any, *echo.HTTPError) {
+	return httpserver.Call(ectx, req, "jobs.retry",
+		func(_ notifylog.NotifyLog, ectx echo.Context, req *jobRequest) (*httpserver.Response, *echo.HTTPError) {
+			job, err := a.client.Retry(ectx.Request().Context(), req.ID)
+			if err != nil {
+				return nil, httpError(err)
+			}
+
+			return &httpserver.Response{RequestID: "", Data: job, Pagination: nil}, nil
+		})
+}
+
+func (a *admin) delete(ectx echo.Context, req *jobRequest) (any, *echo.HTTPError) {
+	return httpserver.Call(ectx, req, "jobs.delete",
+		func(_ notifylog.NotifyLog, ectx echo.Context, req *jobRequest) (*httpserver.Response, *echo.HTTPError) {
+			if err := a.client.Delete(ectx.Request().Context(), req.ID); err != nil {
+				return nil, httpError(err)
+			}
+
+			return &httpserver.Response{RequestID: "", Data: nil, Pagination: nil}, nil
+		})
+}
+
+// httpError maps err to an application error, so clients get its code and message while the text
+// of unexpected errors is only logged.
+func httpError(err error) *echo.HTTPError {
+	code, appErr := http.StatusInternalServerError, apperror.Internal(err)
+
+	switch {
+	case errors.Is(err, ErrJobNotFound):
+		code, appErr = http.StatusNotFound, apperror.NotFound(err.Error())
+	case errors.Is(err, ErrJobNotFailed):
+		code, appErr = http.StatusConflict, apperror.Conflict(err.Error())
+	}
+
+	return &echo.HTTPError{
+		Code:     code,
+		Message:  appErr.Message,
+		Internal: appErr,
+	}
+}
@@ -0,0 +1,122 @@
+package jobs_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+	"github.com/thienhaole92/uframework/jobs"
+	"github.com/thienhaole92/uframework/validator"
+)
+
+type adminResponse struct {
+	Data       json.RawMessage `json:"data"`
+	Pagination *struct {
+		Limit     int64 `json:"limit"`
+		Total     int64 `json:"total"`
+		TotalPage int64 `json:"totalPage"`
+	} `json:"pagination"`
+}
+
+func serve(t *testing.T, e *echo.Echo, method, path string) (int, adminResponse) {
+	t.Helper()
+
+	req := httptest.NewRequest(method, path, nil)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	var res adminResponse
+	if rec.Code == http.StatusOK {
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+	}
+
+	return rec.Code, res
+}
+
+func TestAdminRoutes(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	client := newClient(t, newTestRedis(ctx, t))
+	kind := jobs.Kind[emailArgs]{Name: "email", Queue: "", MaxAttempts: 1}
+
+	worker := startWorker(t, client, kind, func(context.Context, *jobs.Job, emailArgs) error {
+		return errJob
+	})
+
+	failed := make([]string, 0, 3)
+
+	for range 3 {
+		job, err := jobs.Enqueue(ctx, client, kind, emailArgs{To: "a@example.com"})
+		require.NoError(t, err)
+
+		waitForStatus(t, client, job.ID, jobs.StatusFailed)
+		failed = append(failed, job.ID)
+	}
+
+	// Stops the worker, so retried jobs keep their status.
+	worker.Close()
+
+	e := echo.New()
+	e.Validator = validator.DefaultRestValidator()
+	jobs.RegisterAdminRoutes(e.Group("/admin/jobs"), client)
+
+	code, res := serve(t, e, http.MethodGet, "/admin/jobs/failed?page=2&limit=2")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, int64(3), res.Pagination.Total)
+	require.Equal(t, int64(2), res.Pagination.TotalPage)
+
+	var page []jobs.Job
+	require.NoError(t, json.Unmarshal(res.Data, &page))
+	require.Len(t, page, 1)
+	// The most recent failure comes first, so the oldest one is on the last page.
+	require.Equal(t, failed[0], page[0].ID)
+
+	code, _ = serve(t, e, http.MethodGet, "/admin/jobs/failed?limit=1000")
+	require.Equal(t, http.StatusBadRequest, code)
+
+	code, res = serve(t, e, http.MethodGet, "/admin/jobs/"+failed[1])
+	require.Equal(t, http.StatusOK, code)
+
+	var job jobs.Job
+	require.NoError(t, json.Unmarshal(res.Data, &job))
+	require.Equal(t, jobs.StatusFailed, job.Status)
+
+	code, _ = serve(t, e, http.MethodPost, "/admin/jobs/"+failed[1]+"/retry")
+	require.Equal(t, http.StatusOK, code)
+
+	// Only failed jobs can be retried.
+	code, _ = serve(t, e, http.MethodPost, "/admin/jobs/"+failed[1]+"/retry")
+	require.Equal(t, http.StatusConflict, code)
+
+	code, _ = serve(t, e, http.MethodDelete, "/admin/jobs/"+failed[2])
+	require.Equal(t, http.StatusOK, code)
+
+	code, _ = serve(t, e, http.MethodGet, "/admin/jobs/"+failed[2])
+	require.Equal(t, http.StatusNotFound, code)
+}
+
+func TestAdminRoutes_InternalError(t *testing.T) {
+	t.Parallel()
+
+	//nolint:exhaustruct
+	client, err := jobs.NewClient(redis.NewClient(&redis.Options{Addr: "127.0.0.1:0"}), jobs.ClientOptions{Prefix: ""})
+	require.NoError(t, err)
+
+	e := echo.New()
+	e.Validator = validator.DefaultRestValidator()
+	jobs.RegisterAdminRoutes(e.Group("/admin/jobs"), client)
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/jobs/1", nil)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	// The Redis error is not returned to the client.
+	require.Equal(t, http.StatusInternalServerError, rec.Code)
+	require.JSONEq(t, `{"message":"internal error"}`, rec.Body.String())
+}
@@ -0,0 +1,319 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/thienhaole92/uframework/redispub"
+)
+
+// DefaultPrefix prefixes every key of the queue. The hash tag keeps them in one cluster slot, which
+// the delayed messages of redispub need to move retries to their stream.
+const DefaultPrefix = "{jobs}"
+
+var ErrNilRedisClient = errors.New("redis client cannot be nil")
+
+// releaseUniqueScript deletes a unique key only while it is held by the job in ARGV[1].
+const releaseUniqueScript = `
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`
+
+type ClientOptions struct {
+	Prefix string // Prefix of the keys, defaults to DefaultPrefix.
+}
+
+// Client enqueues jobs and manages their state, it is shared by workers and the admin routes.
+//
+// A job is a hash holding its state, its ID being published to the stream of its queue and
+// priority. Delayed jobs and retries are scheduled with redispub.RedisPublisher.PublishAt, workers
+// run the mover adding them to their stream once due.
+type Client struct {
+	redisClient   goredis.UniversalClient
+	publisher     *redispub.RedisPublisher
+	prefix        string
+	releaseUnique *goredis.Script
+}
+
+func NewClient(redisClient goredis.UniversalClient, opts ClientOptions) (*Client, error) {
+	if redisClient == nil {
+		return nil, ErrNilRedisClient
+	}
+
+	if opts.Prefix == "" {
+		opts.Prefix = DefaultPrefix
+	}
+
+	//nolint:exhaustruct
+	publisher, err := redispub.New(redisClient, redispub.Options{DelayedPrefix: opts.Prefix + ":delayed"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create job publisher: %w", err)
+	}
+
+	return &Client{
+		redisClient:   redisClient,
+		publisher:     publisher,
+		prefix:        opts.Prefix,
+		releaseUnique: goredis.NewScript(releaseUniqueScript),
+	}, nil
+}
+
+func (c *Client) jobKey(id string) string {
+	return c.prefix + ":job:" + id
+}
+
+func (c *Client) uniqueKey(key string) string {
+	return c.prefix + ":unique:" + key
+}
+
+func (c *Client) failedKey() string {
+	return c.prefix + ":failed"
+}
+
+func (c *Client) delayedPrefix() string {
+	return c.prefix + ":delayed"
+}
+
+// stream is the stream holding the jobs of a queue with the given priority.
+func (c *Client) stream(queue string, priority Priority) string {
+	return c.prefix + ":queue:" + queue + ":" + priority.String()
+}
+
+// Enqueue adds a job of the given kind, its arguments being encoded as JSON. It returns
+// ErrDuplicateJob when WithUniqueKey is set and another job holds the key.
+func Enqueue[T any](ctx context.Context, client *Client, kind Kind[T], args T, opts ...EnqueueOption) (*Job, error) {
+	if kind.Name == "" {
+		return nil, ErrEmptyJobType
+	}
+
+	payload, err := json.Marshal(args)
+	if err != nil {
+		return nil, fmt.Errorf("%w of job %s: %w", ErrEncodeArgs, kind.Name, err)
+	}
+
+	options := enqueueOptions{priority: PriorityNormal, runAt: time.Time{}, uniqueKey: "", uniqueFor: defaultUniqueFor}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	now := time.Now().UTC()
+	job := &Job{
+		ID:          watermill.NewUUID(),
+		Type:        kind.Name,
+		Queue:       kind.queue(),
+		Priority:    options.priority.String(),
+		Args:        payload,
+		Status:      StatusQueued,
+		Attempts:    0,
+		MaxAttempts: kind.maxAttempts(),
+		LastError:   "",
+		UniqueKey:   options.uniqueKey,
+		RunAt:       now,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	if options.runAt.After(now) {
+		job.Status = StatusScheduled
+		job.RunAt = options.runAt.UTC()
+	}
+
+	if err := client.enqueue(ctx, job, options.uniqueFor); err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
+
+func (c *Client) enqueue(ctx context.Context, job *Job, uniqueFor time.Duration) error {
+	if job.UniqueKey != "" {
+		if uniqueFor <= 0 {
+			uniqueFor = defaultUniqueFor
+		}
+
+		acquired, err := c.redisClient.SetNX(ctx, c.uniqueKey(job.UniqueKey), job.ID, uniqueFor).Result()
+		if err != nil {
+			return fmt.Errorf("%w %s: %w", ErrEnqueueFailed, job.Type, err)
+		}
+
+		if !acquired {
+			return fmt.Errorf("%w: %s", ErrDuplicateJob, job.UniqueKey)
+		}
+	}
+
+	err := c.redisClient.HSet(ctx, c.jobKey(job.ID), job.fields()...).Err()
+	if err == nil {
+		err = c.publish(ctx, job)
+	}
+
+	if err != nil {
+		// Nothing was published, so the job would never run.
+		c.remove(ctx, job)
+
+		return fmt.Errorf("%w %s: %w", ErrEnqueueFailed, job.Type, err)
+	}
+
+	return nil
+}
+
+// publish adds the job to the stream of its queue, or schedules it when it runs later.
+func (c *Client) publish(ctx context.Context, job *Job) error {
+	msg := message.NewMessage(job.ID, []byte(job.ID))
+	stream := c.stream(job.Queue, parsePriority(job.Priority))
+
+	if job.RunAt.After(time.Now()) {
+		return c.publisher.PublishAt(ctx, stream, job.RunAt, msg)
+	}
+
+	return c.publisher.Publish(ctx, stream, msg)
+}
+
+// Get returns the state of a job, or ErrJobNotFound once it was deleted or its retention expired.
+func (c *Client) Get(ctx context.Context, id string) (*Job, error) {
+	values, err := c.redisClient.HGetAll(ctx, c.jobKey(id)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get job %s: %w", id, err)
+	}
+
+	if len(values) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrJobNotFound, id)
+	}
+
+	return jobFromHash(values), nil
+}
+
+// ListFailed returns failed jobs, the most recent failure first, and the total number of failed jobs.
+func (c *Client) ListFailed(ctx context.Context, offset, limit int64) ([]*Job, int64, error) {
+	var (
+		ids   *goredis.StringSliceCmd
+		total *goredis.IntCmd
+	)
+
+	_, err := c.redisClient.Pipelined(ctx, func(pipe goredis.Pipeliner) error {
+		ids = pipe.ZRevRange(ctx, c.failedKey(), offset, offset+limit-1)
+		total = pipe.ZCard(ctx, c.failedKey())
+
+		return nil
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list failed jobs: %w", err)
+	}
+
+	cmds := make([]*goredis.MapStringStringCmd, 0, len(ids.Val()))
+
+	_, err = c.redisClient.Pipelined(ctx, func(pipe goredis.Pipeliner) error {
+		for _, id := range ids.Val() {
+			cmds = append(cmds, pipe.HGetAll(ctx, c.jobKey(id)))
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list failed jobs: %w", err)
+	}
+
+	jobs := make([]*Job, 0, len(cmds))
+
+	for _, cmd := range cmds {
+		// Skips jobs deleted between both reads.
+		if values := cmd.Val(); len(values) > 0 {
+			jobs = append(jobs, jobFromHash(values))
+		}
+	}
+
+	return jobs, total.Val(), nil
+}
+
+// Retry enqueues a failed job again with its attempts reset. It returns ErrJobNotFailed when the
+// job has not failed.
+func (c *Client) Retry(ctx context.Context, id string) (*Job, error) {
+	job, err := c.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if job.Status != StatusFailed {
+		return nil, fmt.Errorf("%w: %s is %s", ErrJobNotFailed, id, job.Status)
+	}
+
+	now := time.Now().UTC()
+	job.Status = StatusQueued
+	job.Attempts = 0
+	job.LastError = ""
+	job.RunAt = now
+	job.UpdatedAt = now
+
+	_, err = c.redisClient.TxPipelined(ctx, func(pipe goredis.Pipeliner) error {
+		pipe.HSet(ctx, c.jobKey(id), job.fields()...)
+		pipe.ZRem(ctx, c.failedKey(), id)
+
+		return nil
+	})
+	if err == nil {
+		err = c.publish(ctx, job)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to retry job %s: %w", id, err)
+	}
+
+	return job, nil
+}
+
+// Delete removes a job. A queued job is skipped by workers, a scheduled one is cancelled.
+func (c *Client) Delete(ctx context.Context, id string) error {
+	job, err := c.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if _, err := c.publisher.CancelScheduled(ctx, id); err != nil {
+		return fmt.Errorf("failed to delete job %s: %w", id, err)
+	}
+
+	if err := c.removeState(ctx, job); err != nil {
+		return fmt.Errorf("failed to delete job %s: %w", id, err)
+	}
+
+	return nil
+}
+
+// remove deletes a job that could not be enqueued, on a best effort basis.
+func (c *Client) remove(ctx context.Context, job *Job) {
+	_ = c.removeState(context.WithoutCancel(ctx), job)
+}
+
+func (c *Client) removeState(ctx context.Context, job *Job) error {
+	_, err := c.redisClient.Pipelined(ctx, func(pipe goredis.Pipeliner) error {
+		pipe.Del(ctx, c.jobKey(job.ID))
+		pipe.ZRem(ctx, c.failedKey(), job.ID)
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.releaseKey(ctx, job)
+}
+
+// releaseKey lets another job take the unique key of job.
+func (c *Client) releaseKey(ctx context.Context, job *Job) error {
+	if job.UniqueKey == "" {
+		return nil
+	}
+
+	if err := c.releaseUnique.Run(ctx, c.redisClient, []string{c.uniqueKey(job.UniqueKey)}, job.ID).Err(); err != nil {
+		return fmt.Errorf("failed to release unique key %s: %w", job.UniqueKey, err)
+	}
+
+	return nil
+}
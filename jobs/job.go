@@ -0,0 +1,214 @@
+package jobs
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+)
+
+const (
+	DefaultQueue       = "default"
+	defaultMaxAttempts = 5
+	defaultUniqueFor   = 24 * time.Hour
+)
+
+var (
+	ErrEmptyJobType     = errors.New("job type cannot be empty")
+	ErrDuplicateJob     = errors.New("a job with the same unique key exists")
+	ErrJobNotFound      = errors.New("job not found")
+	ErrJobNotFailed     = errors.New("job has not failed")
+	ErrEncodeArgs       = errors.New("failed to encode job arguments")
+	ErrDecodeArgs       = errors.New("failed to decode job arguments")
+	ErrEnqueueFailed    = errors.New("failed to enqueue job")
+	ErrDuplicateHandler = errors.New("a handler is already registered for the job type")
+	ErrNoHandler        = errors.New("no handler registered for the job type")
+)
+
+type Status string
+
+const (
+	StatusScheduled Status = "scheduled" // Waiting for its run time.
+	StatusQueued    Status = "queued"    // Waiting for a worker.
+	StatusRunning   Status = "running"
+	StatusRetrying  Status = "retrying"  // Failed, waiting for its next attempt.
+	StatusSucceeded Status = "succeeded" // Kept for WorkerOptions.SuccessRetention.
+	StatusFailed    Status = "failed"    // Out of attempts, kept until retried or deleted.
+)
+
+type Priority int
+
+const (
+	PriorityNormal Priority = iota
+	PriorityHigh
+	PriorityLow
+)
+
+// priorities lists the priorities in the order workers take jobs.
+func priorities() []Priority {
+	return []Priority{PriorityHigh, PriorityNormal, PriorityLow}
+}
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityHigh:
+		return "high"
+	case PriorityLow:
+		return "low"
+	case PriorityNormal:
+		return "normal"
+	}
+
+	return "normal"
+}
+
+func parsePriority(s string) Priority {
+	switch s {
+	case "high":
+		return PriorityHigh
+	case "low":
+		return PriorityLow
+	default:
+		return PriorityNormal
+	}
+}
+
+// Kind describes a job type and the arguments it takes, it is shared by Enqueue and Register.
+type Kind[T any] struct {
+	Name        string
+	Queue       string // Defaults to DefaultQueue.
+	MaxAttempts int    // Attempts before the job fails, defaults to 5.
+}
+
+func (k Kind[T]) queue() string {
+	if k.Queue == "" {
+		return DefaultQueue
+	}
+
+	return k.Queue
+}
+
+func (k Kind[T]) maxAttempts() int {
+	if k.MaxAttempts <= 0 {
+		return defaultMaxAttempts
+	}
+
+	return k.MaxAttempts
+}
+
+// Job is the state of an enqueued job.
+type Job struct {
+	ID          string          `json:"id"`
+	Type        string          `json:"type"`
+	Queue       string          `json:"queue"`
+	Priority    string          `json:"priority"`
+	Args        json.RawMessage `json:"args"`
+	Status      Status          `json:"status"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"maxAttempts"`
+	LastError   string          `json:"lastError,omitempty"`
+	UniqueKey   string          `json:"uniqueKey,omitempty"`
+	RunAt       time.Time       `json:"runAt"`
+	CreatedAt   time.Time       `json:"createdAt"`
+	UpdatedAt   time.Time       `json:"updatedAt"`
+}
+
+// Fields of the hash holding a job.
+const (
+	fieldID          = "id"
+	fieldType        = "type"
+	fieldQueue       = "queue"
+	fieldPriority    = "priority"
+	fieldArgs        = "args"
+	fieldStatus      = "status"
+	fieldAttempts    = "attempts"
+	fieldMaxAttempts = "max_attempts"
+	fieldLastError   = "last_error"
+	fieldUniqueKey   = "unique_key"
+	fieldRunAt       = "run_at"
+	fieldCreatedAt   = "created_at"
+	fieldUpdatedAt   = "updated_at"
+)
+
+func (j *Job) fields() []any {
+	return []any{
+		fieldID, j.ID,
+		fieldType, j.Type,
+		fieldQueue, j.Queue,
+		fieldPriority, j.Priority,
+		fieldArgs, string(j.Args),
+		fieldStatus, string(j.Status),
+		fieldAttempts, j.Attempts,
+		fieldMaxAttempts, j.MaxAttempts,
+		fieldLastError, j.LastError,
+		fieldUniqueKey, j.UniqueKey,
+		fieldRunAt, j.RunAt.UnixMilli(),
+		fieldCreatedAt, j.CreatedAt.UnixMilli(),
+		fieldUpdatedAt, j.UpdatedAt.UnixMilli(),
+	}
+}
+
+func jobFromHash(values map[string]string) *Job {
+	attempts, _ := strconv.Atoi(values[fieldAttempts])
+	maxAttempts, _ := strconv.Atoi(values[fieldMaxAttempts])
+
+	return &Job{
+		ID:          values[fieldID],
+		Type:        values[fieldType],
+		Queue:       values[fieldQueue],
+		Priority:    values[fieldPriority],
+		Args:        json.RawMessage(values[fieldArgs]),
+		Status:      Status(values[fieldStatus]),
+		Attempts:    attempts,
+		MaxAttempts: maxAttempts,
+		LastError:   values[fieldLastError],
+		UniqueKey:   values[fieldUniqueKey],
+		RunAt:       unixMilli(values[fieldRunAt]),
+		CreatedAt:   unixMilli(values[fieldCreatedAt]),
+		UpdatedAt:   unixMilli(values[fieldUpdatedAt]),
+	}
+}
+
+func unixMilli(value string) time.Time {
+	ms, _ := strconv.ParseInt(value, 10, 64)
+
+	return time.UnixMilli(ms).UTC()
+}
+
+type enqueueOptions struct {
+	priority  Priority
+	runAt     time.Time
+	uniqueKey string
+	uniqueFor time.Duration
+}
+
+type EnqueueOption func(*enqueueOptions)
+
+func WithPriority(priority Priority) EnqueueOption {
+	return func(o *enqueueOptions) {
+		o.priority = priority
+	}
+}
+
+// WithDelay runs the job once delay has passed.
+func WithDelay(delay time.Duration) EnqueueOption {
+	return func(o *enqueueOptions) {
+		o.runAt = time.Now().Add(delay)
+	}
+}
+
+// WithRunAt runs the job at the given time.
+func WithRunAt(at time.Time) EnqueueOption {
+	return func(o *enqueueOptions) {
+		o.runAt = at
+	}
+}
+
+// WithUniqueKey rejects the job with ErrDuplicateJob while another job with the same key has not
+// succeeded or failed, for at most uniqueFor (24h when zero).
+func WithUniqueKey(key string, uniqueFor time.Duration) EnqueueOption {
+	return func(o *enqueueOptions) {
+		o.uniqueKey = key
+		o.uniqueFor = uniqueFor
+	}
+}
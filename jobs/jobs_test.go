@@ -0,0 +1,324 @@
+package jobs_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/thienhaole92/uframework/goredis"
+	"github.com/thienhaole92/uframework/jobs"
+	"github.com/thienhaole92/uframework/redissub"
+	"github.com/thienhaole92/uframework/testutil"
+)
+
+var errJob = errors.New("job error")
+
+type emailArgs struct {
+	To string `json:"to"`
+}
+
+func newTestRedis(ctx context.Context, t *testing.T) *goredis.Redis {
+	t.Helper()
+
+	container := testutil.SetupRedisContainer(ctx, t)
+
+	port, err := strconv.Atoi(container.Port.Port())
+	require.NoError(t, err)
+
+	return goredis.New(&goredis.Option{
+		Host:             container.Host,
+		Port:             port,
+		Username:         "",
+		Password:         "",
+		DB:               0,
+		DialTimeout:      5 * time.Second,
+		UseTLS:           false,
+		MaxIdleConns:     5,
+		MinIdleConns:     1,
+		PingTimeout:      2 * time.Second,
+		TTL:              time.Minute,
+		Mode:             goredis.ModeStandalone,
+		URL:              "",
+		Addrs:            nil,
+		MasterName:       "",
+		SentinelUsername: "",
+		SentinelPassword: "",
+		TLS:              nil,
+	})
+}
+
+func newClient(t *testing.T, rds *goredis.Redis) *jobs.Client {
+	t.Helper()
+
+	client, err := jobs.NewClient(rds, jobs.ClientOptions{Prefix: ""})
+	require.NoError(t, err)
+
+	return client
+}
+
+func testWorkerOptions() jobs.WorkerOptions {
+	return jobs.WorkerOptions{
+		Queues:            nil,
+		Concurrency:       1,
+		Group:             "",
+		Consumer:          "",
+		MinBackoff:        10 * time.Millisecond,
+		MaxBackoff:        50 * time.Millisecond,
+		Factor:            2,
+		PollInterval:      50 * time.Millisecond,
+		VisibilityTimeout: time.Minute,
+		SuccessRetention:  time.Minute,
+	}
+}
+
+// startWorker runs a worker with the handler of kind until the test ends.
+func startWorker(
+	t *testing.T,
+	client *jobs.Client,
+	kind jobs.Kind[emailArgs],
+	handler jobs.Handler[emailArgs],
+) *jobs.Worker {
+	t.Helper()
+
+	worker, err := jobs.NewWorker(client, testWorkerOptions())
+	require.NoError(t, err)
+	require.NoError(t, jobs.Register(worker, kind, handler))
+	require.ErrorIs(t, jobs.Register(worker, kind, handler), jobs.ErrDuplicateHandler)
+
+	go worker.Run()
+
+	t.Cleanup(worker.Close)
+
+	return worker
+}
+
+func waitForStatus(t *testing.T, client *jobs.Client, id string, status jobs.Status) *jobs.Job {
+	t.Helper()
+
+	var job *jobs.Job
+
+	require.Eventually(t, func() bool {
+		var err error
+
+		job, err = client.Get(context.Background(), id)
+
+		return err == nil && job.Status == status
+	}, 5*time.Second, 10*time.Millisecond)
+
+	return job
+}
+
+func TestEnqueue(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	client := newClient(t, newTestRedis(ctx, t))
+	kind := jobs.Kind[emailArgs]{Name: "email", Queue: "", MaxAttempts: 0}
+
+	job, err := jobs.Enqueue(ctx, client, kind, emailArgs{To: "a@example.com"}, jobs.WithUniqueKey("welcome:a", 0))
+	require.NoError(t, err)
+	require.Equal(t, jobs.DefaultQueue, job.Queue)
+	require.Equal(t, 5, job.MaxAttempts)
+
+	_, err = jobs.Enqueue(ctx, client, kind, emailArgs{To: "a@example.com"}, jobs.WithUniqueKey("welcome:a", 0))
+	require.ErrorIs(t, err, jobs.ErrDuplicateJob)
+
+	_, err = jobs.Enqueue(ctx, client, jobs.Kind[emailArgs]{Name: "", Queue: "", MaxAttempts: 0}, emailArgs{To: ""})
+	require.ErrorIs(t, err, jobs.ErrEmptyJobType)
+
+	stored, err := client.Get(ctx, job.ID)
+	require.NoError(t, err)
+	require.Equal(t, jobs.StatusQueued, stored.Status)
+	require.Equal(t, "normal", stored.Priority)
+	require.JSONEq(t, `{"to":"a@example.com"}`, string(stored.Args))
+	require.Equal(t, job.CreatedAt.UnixMilli(), stored.CreatedAt.UnixMilli())
+
+	// Deleting the job releases its unique key.
+	require.NoError(t, client.Delete(ctx, job.ID))
+
+	_, err = client.Get(ctx, job.ID)
+	require.ErrorIs(t, err, jobs.ErrJobNotFound)
+
+	_, err = jobs.Enqueue(ctx, client, kind, emailArgs{To: "a@example.com"}, jobs.WithUniqueKey("welcome:a", 0))
+	require.NoError(t, err)
+}
+
+func TestWorker_Priority(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	client := newClient(t, newTestRedis(ctx, t))
+	kind := jobs.Kind[emailArgs]{Name: "email", Queue: "", MaxAttempts: 0}
+
+	for _, priority := range []jobs.Priority{jobs.PriorityLow, jobs.PriorityNormal, jobs.PriorityHigh} {
+		_, err := jobs.Enqueue(ctx, client, kind, emailArgs{To: priority.String()}, jobs.WithPriority(priority))
+		require.NoError(t, err)
+	}
+
+	var (
+		mux  sync.Mutex
+		sent []string
+	)
+
+	startWorker(t, client, kind, func(_ context.Context, _ *jobs.Job, args emailArgs) error {
+		mux.Lock()
+		defer mux.Unlock()
+
+		sent = append(sent, args.To)
+
+		return nil
+	})
+
+	require.Eventually(t, func() bool {
+		mux.Lock()
+		defer mux.Unlock()
+
+		return len(sent) == 3
+	}, 5*time.Second, 10*time.Millisecond)
+
+	require.Equal(t, []string{"high", "normal", "low"}, sent)
+}
+
+func TestWorker_Retry(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	client := newClient(t, newTestRedis(ctx, t))
+	kind := jobs.Kind[emailArgs]{Name: "email", Queue: "", MaxAttempts: 3}
+
+	var calls atomic.Int64
+
+	startWorker(t, client, kind, func(context.Context, *jobs.Job, emailArgs) error {
+		if calls.Add(1) < 3 {
+			return errJob
+		}
+
+		return nil
+	})
+
+	job, err := jobs.Enqueue(ctx, client, kind, emailArgs{To: "a@example.com"}, jobs.WithUniqueKey("retry", 0))
+	require.NoError(t, err)
+
+	job = waitForStatus(t, client, job.ID, jobs.StatusSucceeded)
+	require.Equal(t, 3, job.Attempts)
+	require.Empty(t, job.LastError)
+
+	// The unique key is released once the job succeeded.
+	_, err = jobs.Enqueue(ctx, client, kind, emailArgs{To: "a@example.com"}, jobs.WithUniqueKey("retry", 0))
+	require.NoError(t, err)
+}
+
+func TestWorker_Delay(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	client := newClient(t, newTestRedis(ctx, t))
+	kind := jobs.Kind[emailArgs]{Name: "email", Queue: "", MaxAttempts: 0}
+
+	var ran atomic.Int64
+
+	startWorker(t, client, kind, func(context.Context, *jobs.Job, emailArgs) error {
+		ran.Add(1)
+
+		return nil
+	})
+
+	job, err := jobs.Enqueue(ctx, client, kind, emailArgs{To: "a@example.com"}, jobs.WithDelay(300*time.Millisecond))
+	require.NoError(t, err)
+	require.Equal(t, jobs.StatusScheduled, job.Status)
+
+	require.Never(t, func() bool { return ran.Load() > 0 }, 200*time.Millisecond, 10*time.Millisecond)
+	waitForStatus(t, client, job.ID, jobs.StatusSucceeded)
+}
+
+func TestWorker_Failed(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	client := newClient(t, newTestRedis(ctx, t))
+	kind := jobs.Kind[emailArgs]{Name: "email", Queue: "", MaxAttempts: 2}
+
+	var fixed atomic.Bool
+
+	startWorker(t, client, kind, func(context.Context, *jobs.Job, emailArgs) error {
+		if fixed.Load() {
+			return nil
+		}
+
+		return errJob
+	})
+
+	job, err := jobs.Enqueue(ctx, client, kind, emailArgs{To: "a@example.com"})
+	require.NoError(t, err)
+
+	job = waitForStatus(t, client, job.ID, jobs.StatusFailed)
+	require.Equal(t, 2, job.Attempts)
+	require.Equal(t, errJob.Error(), job.LastError)
+
+	failed, total, err := client.ListFailed(ctx, 0, 10)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), total)
+	require.Len(t, failed, 1)
+	require.Equal(t, job.ID, failed[0].ID)
+
+	fixed.Store(true)
+
+	_, err = client.Retry(ctx, job.ID)
+	require.NoError(t, err)
+
+	_, err = client.Retry(ctx, job.ID)
+	require.ErrorIs(t, err, jobs.ErrJobNotFailed)
+
+	job = waitForStatus(t, client, job.ID, jobs.StatusSucceeded)
+	require.Equal(t, 1, job.Attempts)
+
+	_, total, err = client.ListFailed(ctx, 0, 10)
+	require.NoError(t, err)
+	require.Zero(t, total)
+}
+
+func TestWorker_DeletedWhileRunning(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	client := newClient(t, newTestRedis(ctx, t))
+	kind := jobs.Kind[emailArgs]{Name: "email", Queue: "", MaxAttempts: 3}
+
+	running := make(chan string)
+	release := make(chan struct{})
+	outcomes := []error{nil, errJob, redissub.Permanent(errJob)}
+
+	var calls atomic.Int64
+
+	startWorker(t, client, kind, func(_ context.Context, job *jobs.Job, _ emailArgs) error {
+		running <- job.ID
+		<-release
+
+		return outcomes[calls.Add(1)-1]
+	})
+
+	for range outcomes {
+		job, err := jobs.Enqueue(ctx, client, kind, emailArgs{To: "a@example.com"})
+		require.NoError(t, err)
+		require.Equal(t, job.ID, <-running)
+
+		require.NoError(t, client.Delete(ctx, job.ID))
+		release <- struct{}{}
+
+		// The outcome of the job does not bring it back.
+		require.Never(t, func() bool {
+			_, err := client.Get(ctx, job.ID)
+
+			return !errors.Is(err, jobs.ErrJobNotFound)
+		}, 300*time.Millisecond, 10*time.Millisecond)
+	}
+
+	_, total, err := client.ListFailed(ctx, 0, 10)
+	require.NoError(t, err)
+	require.Zero(t, total)
+}
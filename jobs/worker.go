@@ -0,0 +1,573 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/jpillora/backoff"
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+	"github.com/thienhaole92/uframework/redispub"
+	"github.com/thienhaole92/uframework/redissub"
+)
+
+const (
+	defaultConcurrency       = 10
+	defaultGroup             = "jobs"
+	defaultMinBackoff        = time.Second
+	defaultMaxBackoff        = time.Hour
+	defaultBackoffFactor     = 2
+	defaultPollInterval      = time.Second
+	defaultVisibilityTimeout = 5 * time.Minute
+	defaultSuccessRetention  = 24 * time.Hour
+
+	// payloadField holds the job ID in the stream entries written by redispub.
+	payloadField = "payload"
+)
+
+var (
+	ErrJobPanic     = errors.New("job panicked")
+	ErrWorkerFailed = errors.New("failed to fetch jobs")
+)
+
+// startScript marks a job as running and returns its attempts, or -1 when it was deleted.
+const startScript = `
+if redis.call("EXISTS", KEYS[1]) == 0 then
+	return -1
+end
+redis.call("HSET", KEYS[1], "status", ARGV[1], "updated_at", ARGV[2])
+return redis.call("HINCRBY", KEYS[1], "attempts", 1)
+`
+
+// succeedScript marks a job as succeeded until it expires, and returns 0 when it was deleted.
+const succeedScript = `
+if redis.call("EXISTS", KEYS[1]) == 0 then
+	return 0
+end
+redis.call("HSET", KEYS[1], "status", ARGV[1], "last_error", "", "updated_at", ARGV[2])
+redis.call("PEXPIRE", KEYS[1], ARGV[3])
+return 1
+`
+
+// retryScript marks a job as retrying at ARGV[3], and returns 0 when it was deleted.
+const retryScript = `
+if redis.call("EXISTS", KEYS[1]) == 0 then
+	return 0
+end
+redis.call("HSET", KEYS[1], "status", ARGV[1], "last_error", ARGV[2], "run_at", ARGV[3], "updated_at", ARGV[4])
+return 1
+`
+
+// failScript marks a job as failed and adds it to the failed set in KEYS[2], and returns 0 when it
+// was deleted.
+const failScript = `
+if redis.call("EXISTS", KEYS[1]) == 0 then
+	return 0
+end
+redis.call("HSET", KEYS[1], "status", ARGV[1], "last_error", ARGV[2], "updated_at", ARGV[3])
+redis.call("ZADD", KEYS[2], ARGV[3], ARGV[4])
+return 1
+`
+
+// Handler runs a job with its decoded arguments. Errors marked with redissub.Permanent fail the
+// job without further attempts.
+type Handler[T any] func(ctx context.Context, job *Job, args T) error
+
+type WorkerOptions struct {
+	Queues      []string // Queues to take jobs from, defaults to DefaultQueue.
+	Concurrency int      // Jobs run at the same time, defaults to 10.
+	// Group is the consumer group shared by the workers of the queues, defaults to "jobs".
+	Group string
+	// Consumer names this worker in the group, defaults to a random ID.
+	Consumer   string
+	MinBackoff time.Duration // Delay before the first retry, defaults to 1s.
+	MaxBackoff time.Duration // Upper bound of the delay, defaults to 1h.
+	Factor     float64       // Growth of the delay per attempt, defaults to 2.
+	// PollInterval bounds how long a fetch waits for jobs and how often due jobs are moved, defaults to 1s.
+	PollInterval time.Duration
+	// VisibilityTimeout is how long a job may run before another worker takes it over, as its worker is
+	// assumed to be gone. It must be longer than the slowest job, defaults to 5m.
+	VisibilityTimeout time.Duration
+	// SuccessRetention is how long succeeded jobs can be looked up, defaults to 24h.
+	SuccessRetention time.Duration
+}
+
+func (o *WorkerOptions) setDefaults() {
+	if len(o.Queues) == 0 {
+		o.Queues = []string{DefaultQueue}
+	}
+
+	if o.Concurrency <= 0 {
+		o.Concurrency = defaultConcurrency
+	}
+
+	if o.Group == "" {
+		o.Group = defaultGroup
+	}
+
+	if o.Consumer == "" {
+		o.Consumer = watermill.NewShortUUID()
+	}
+
+	if o.MinBackoff <= 0 {
+		o.MinBackoff = defaultMinBackoff
+	}
+
+	if o.MaxBackoff <= 0 {
+		o.MaxBackoff = defaultMaxBackoff
+	}
+
+	if o.Factor <= 0 {
+		o.Factor = defaultBackoffFactor
+	}
+
+	if o.PollInterval <= 0 {
+		o.PollInterval = defaultPollInterval
+	}
+
+	if o.VisibilityTimeout <= 0 {
+		o.VisibilityTimeout = defaultVisibilityTimeout
+	}
+
+	if o.SuccessRetention <= 0 {
+		o.SuccessRetention = defaultSuccessRetention
+	}
+}
+
+func (o *WorkerOptions) backoff(attempt int) time.Duration {
+	bkf := &backoff.Backoff{
+		Min:    o.MinBackoff,
+		Max:    o.MaxBackoff,
+		Factor: o.Factor,
+		Jitter: true,
+	}
+
+	return bkf.ForAttempt(float64(attempt - 1))
+}
+
+// entry is a job ID read from the stream of a queue.
+type entry struct {
+	stream string
+	id     string
+	jobID  string
+}
+
+// Worker runs the jobs of its queues with the handlers given to Register, taking jobs of higher
+// priority first. Jobs are delivered at least once: a job whose worker stops while running it is run
+// again once VisibilityTimeout has passed. It implements runner.AppRunner.
+type Worker struct {
+	client    *Client
+	opts      WorkerOptions
+	mover     *redispub.DelayedMover
+	start     *goredis.Script
+	succeeded *goredis.Script
+	retrying  *goredis.Script
+	failed    *goredis.Script
+	handlers  map[string]func(context.Context, *Job) error
+	handleMux sync.RWMutex // Protects handlers
+	streams   []string     // Streams of the queues, in the order jobs are taken
+	lastClaim time.Time
+	ctx       context.Context //nolint:containedctx
+	cancel    context.CancelFunc
+	done      sync.WaitGroup // Tracks Run
+	running   sync.WaitGroup // Tracks the mover and running jobs
+	stateMux  sync.Mutex     // Protects started and the registration of Run
+	started   bool
+}
+
+func NewWorker(client *Client, opts WorkerOptions) (*Worker, error) {
+	opts.setDefaults()
+
+	//nolint:exhaustruct
+	mover, err := redispub.NewDelayedMover(client.redisClient, redispub.DelayedMoverOptions{
+		Prefix:       client.delayedPrefix(),
+		PollInterval: opts.PollInterval,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create job mover: %w", err)
+	}
+
+	streams := make([]string, 0, len(opts.Queues)*len(priorities()))
+
+	for _, priority := range priorities() {
+		for _, queue := range opts.Queues {
+			streams = append(streams, client.stream(queue, priority))
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &Worker{
+		client:    client,
+		opts:      opts,
+		mover:     mover,
+		start:     goredis.NewScript(startScript),
+		succeeded: goredis.NewScript(succeedScript),
+		retrying:  goredis.NewScript(retryScript),
+		failed:    goredis.NewScript(failScript),
+		handlers:  make(map[string]func(context.Context, *Job) error),
+		handleMux: sync.RWMutex{},
+		streams:   streams,
+		lastClaim: time.Time{},
+		ctx:       ctx,
+		cancel:    cancel,
+		done:      sync.WaitGroup{},
+		running:   sync.WaitGroup{},
+		stateMux:  sync.Mutex{},
+		started:   false,
+	}, nil
+}
+
+// Register sets the handler of a job kind. Jobs of a kind without handler fail with ErrNoHandler.
+func Register[T any](worker *Worker, kind Kind[T], handler Handler[T]) error {
+	if kind.Name == "" {
+		return ErrEmptyJobType
+	}
+
+	worker.handleMux.Lock()
+	defer worker.handleMux.Unlock()
+
+	if _, ok := worker.handlers[kind.Name]; ok {
+		return fmt.Errorf("%w: %s", ErrDuplicateHandler, kind.Name)
+	}
+
+	worker.handlers[kind.Name] = func(ctx context.Context, job *Job) error {
+		var args T
+
+		if err := json.Unmarshal(job.Args, &args); err != nil {
+			return redissub.Permanent(fmt.Errorf("%w of job %s: %w", ErrDecodeArgs, job.ID, err))
+		}
+
+		return handler(ctx, job, args)
+	}
+
+	return nil
+}
+
+func (w *Worker) Name() string {
+	return "jobs-worker"
+}
+
+// Run takes and runs jobs until Close is called. It returns right away when the worker already
+// runs or is closed.
+func (w *Worker) Run() {
+	// Registered under the lock so Close either waits for Run or Run never starts.
+	w.stateMux.Lock()
+
+	if w.started || w.ctx.Err() != nil {
+		w.stateMux.Unlock()
+
+		return
+	}
+
+	w.started = true
+	w.done.Add(1)
+	w.stateMux.Unlock()
+
+	defer w.done.Done()
+
+	log.Info().Strs("queues", w.opts.Queues).Str("consumer", w.opts.Consumer).Msg("Starting job worker")
+
+	w.running.Add(1)
+
+	go func() {
+		defer w.running.Done()
+
+		w.mover.Run()
+	}()
+
+	slots := make(chan struct{}, w.opts.Concurrency)
+
+	for w.ctx.Err() == nil {
+		select {
+		case slots <- struct{}{}:
+		case <-w.ctx.Done():
+			continue
+		}
+
+		job, err := w.fetch(w.ctx)
+		if err != nil && w.ctx.Err() == nil {
+			log.Error().Err(err).Msg("Failed to fetch jobs")
+
+			// Waits before trying again, so an unreachable Redis is not hammered.
+			select {
+			case <-w.ctx.Done():
+			case <-time.After(w.opts.PollInterval):
+			}
+		}
+
+		if job == nil {
+			<-slots
+
+			continue
+		}
+
+		w.running.Add(1)
+
+		go func() {
+			defer func() {
+				<-slots
+
+				w.running.Done()
+			}()
+
+			w.process(job)
+		}()
+	}
+
+	log.Info().Str("consumer", w.opts.Consumer).Msg("Job worker stopped")
+}
+
+// fetch returns the next job, taking over jobs of gone workers first and then reading the streams in
+// priority order. It returns nil when no job arrived within PollInterval.
+func (w *Worker) fetch(ctx context.Context) (*entry, error) {
+	if time.Since(w.lastClaim) >= w.opts.PollInterval {
+		w.lastClaim = time.Now()
+
+		job, err := w.claim(ctx)
+		if job != nil || err != nil {
+			return job, err
+		}
+	}
+
+	for _, stream := range w.streams {
+		job, err := w.read(ctx, []string{stream}, -1)
+		if job != nil || err != nil {
+			return job, err
+		}
+	}
+
+	// Every stream is empty, waits for a job of any of them.
+	return w.read(ctx, w.streams, w.opts.PollInterval)
+}
+
+// read reads one new job of streams, a negative block returning right away.
+func (w *Worker) read(ctx context.Context, streams []string, block time.Duration) (*entry, error) {
+	args := make([]string, 0, 2*len(streams)) //nolint:mnd
+	args = append(args, streams...)
+
+	for range streams {
+		args = append(args, ">")
+	}
+
+	readArgs := &goredis.XReadGroupArgs{
+		Group:    w.opts.Group,
+		Consumer: w.opts.Consumer,
+		Streams:  args,
+		Count:    1,
+		Block:    block,
+		NoAck:    false,
+	}
+
+	res, err := w.client.redisClient.XReadGroup(ctx, readArgs).Result()
+	if isNoGroup(err) {
+		// The group is created with its streams, so jobs enqueued before are not missed.
+		if err := w.createGroups(ctx); err != nil {
+			return nil, err
+		}
+
+		res, err = w.client.redisClient.XReadGroup(ctx, readArgs).Result()
+	}
+
+	if err != nil {
+		if errors.Is(err, goredis.Nil) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("%w: %w", ErrWorkerFailed, err)
+	}
+
+	for _, stream := range res {
+		for _, msg := range stream.Messages {
+			return newEntry(stream.Stream, msg), nil
+		}
+	}
+
+	return nil, nil
+}
+
+// claim takes over a job read by a worker more than VisibilityTimeout ago and not acknowledged.
+func (w *Worker) claim(ctx context.Context) (*entry, error) {
+	for _, stream := range w.streams {
+		msgs, _, err := w.client.redisClient.XAutoClaim(ctx, &goredis.XAutoClaimArgs{
+			Stream:   stream,
+			Group:    w.opts.Group,
+			MinIdle:  w.opts.VisibilityTimeout,
+			Start:    "0-0",
+			Count:    1,
+			Consumer: w.opts.Consumer,
+		}).Result()
+		if err != nil {
+			if isNoGroup(err) {
+				continue
+			}
+
+			return nil, fmt.Errorf("%w: %w", ErrWorkerFailed, err)
+		}
+
+		if len(msgs) > 0 {
+			return newEntry(stream, msgs[0]), nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (w *Worker) createGroups(ctx context.Context) error {
+	for _, stream := range w.streams {
+		err := w.client.redisClient.XGroupCreateMkStream(ctx, stream, w.opts.Group, "0").Err()
+		if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+			return fmt.Errorf("%w: failed to create group of %s: %w", ErrWorkerFailed, stream, err)
+		}
+	}
+
+	return nil
+}
+
+func isNoGroup(err error) bool {
+	return err != nil && strings.HasPrefix(err.Error(), "NOGROUP")
+}
+
+func newEntry(stream string, msg goredis.XMessage) *entry {
+	jobID, _ := msg.Values[payloadField].(string)
+
+	return &entry{stream: stream, id: msg.ID, jobID: jobID}
+}
+
+// process runs a job and records its outcome. The job is acknowledged once its outcome is stored,
+// otherwise it is taken over after VisibilityTimeout.
+func (w *Worker) process(ent *entry) {
+	// Not derived from w.ctx, so Close lets running jobs finish.
+	ctx := context.Background()
+	logger := log.With().Str("stream", ent.stream).Str("job_id", ent.jobID).Logger()
+
+	attempts, err := w.start.Run(ctx, w.client.redisClient, []string{w.client.jobKey(ent.jobID)},
+		string(StatusRunning), time.Now().UnixMilli()).Int()
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to start job")
+
+		return
+	}
+
+	if attempts < 0 {
+		// The job was deleted while queued.
+		w.ack(ctx, ent)
+
+		return
+	}
+
+	job, err := w.client.Get(ctx, ent.jobID)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to load job")
+
+		return
+	}
+
+	err = w.run(ctx, job)
+	if err == nil {
+		err = w.succeed(ctx, job)
+	} else {
+		logger.Warn().Err(err).Str("type", job.Type).Int("attempt", attempts).Msg("Job failed")
+
+		err = w.fail(ctx, job, err)
+	}
+
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to record job outcome")
+
+		return
+	}
+
+	w.ack(ctx, ent)
+}
+
+func (w *Worker) run(ctx context.Context, job *Job) (err error) {
+	w.handleMux.RLock()
+	handler, ok := w.handlers[job.Type]
+	w.handleMux.RUnlock()
+
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrNoHandler, job.Type)
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%w: %v", ErrJobPanic, r)
+		}
+	}()
+
+	return handler(ctx, job)
+}
+
+// succeed marks a job as succeeded. A job deleted while running is left deleted.
+func (w *Worker) succeed(ctx context.Context, job *Job) error {
+	recorded, err := w.succeeded.Run(ctx, w.client.redisClient, []string{w.client.jobKey(job.ID)},
+		string(StatusSucceeded), time.Now().UnixMilli(), w.opts.SuccessRetention.Milliseconds()).Bool()
+	if err != nil || !recorded {
+		return err
+	}
+
+	return w.client.releaseKey(ctx, job)
+}
+
+// fail schedules the next attempt of a job, or marks it as failed once out of attempts. A job deleted
+// while running is left deleted.
+func (w *Worker) fail(ctx context.Context, job *Job, cause error) error {
+	key := w.client.jobKey(job.ID)
+	now := time.Now()
+
+	if job.Attempts < job.MaxAttempts && !redissub.IsPermanent(cause) {
+		runAt := now.Add(w.opts.backoff(job.Attempts))
+
+		recorded, err := w.retrying.Run(ctx, w.client.redisClient, []string{key},
+			string(StatusRetrying), cause.Error(), runAt.UnixMilli(), now.UnixMilli()).Bool()
+		if err != nil || !recorded {
+			return err
+		}
+
+		msg := message.NewMessage(job.ID, []byte(job.ID))
+
+		return w.client.publisher.PublishAt(ctx, w.client.stream(job.Queue, parsePriority(job.Priority)), runAt, msg)
+	}
+
+	recorded, err := w.failed.Run(ctx, w.client.redisClient, []string{key, w.client.failedKey()},
+		string(StatusFailed), cause.Error(), now.UnixMilli(), job.ID).Bool()
+	if err != nil || !recorded {
+		return err
+	}
+
+	log.Error().Err(cause).Str("job_id", job.ID).Str("type", job.Type).Int("attempts", job.Attempts).Msg("Job failed permanently")
+
+	return w.client.releaseKey(ctx, job)
+}
+
+// ack acknowledges the entry of a job and deletes it, as streams are only read by the workers' group.
+func (w *Worker) ack(ctx context.Context, ent *entry) {
+	_, err := w.client.redisClient.Pipelined(ctx, func(pipe goredis.Pipeliner) error {
+		pipe.XAck(ctx, ent.stream, w.opts.Group, ent.id)
+		pipe.XDel(ctx, ent.stream, ent.id)
+
+		return nil
+	})
+	if err != nil {
+		log.Error().Err(err).Str("stream", ent.stream).Str("job_id", ent.jobID).Msg("Failed to acknowledge job")
+	}
+}
+
+// Close stops taking jobs and waits for the running ones to finish.
+func (w *Worker) Close() {
+	w.stateMux.Lock()
+	w.cancel()
+	w.stateMux.Unlock()
+
+	w.mover.Close()
+	w.done.Wait()
+	w.running.Wait()
+}
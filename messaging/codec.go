@@ -0,0 +1,93 @@
+package messaging
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/vmihailenco/msgpack"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	ContentTypeJSON     = "application/json"
+	ContentTypeMsgpack  = "application/msgpack"
+	ContentTypeProtobuf = "application/protobuf"
+	// ContentTypeEnvelope is the content type of messages published by Publish.
+	ContentTypeEnvelope = "application/vnd.uframework.envelope+json"
+)
+
+var ErrNotProtoMessage = errors.New("value is not a protobuf message")
+
+// Codec encodes event data on the wire.
+type Codec interface {
+	ContentType() string
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+type JSONCodec struct{}
+
+func (JSONCodec) ContentType() string {
+	return ContentTypeJSON
+}
+
+func (JSONCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (JSONCodec) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+type MsgpackCodec struct{}
+
+func (MsgpackCodec) ContentType() string {
+	return ContentTypeMsgpack
+}
+
+func (MsgpackCodec) Marshal(v any) ([]byte, error) {
+	return msgpack.Marshal(v)
+}
+
+func (MsgpackCodec) Unmarshal(data []byte, v any) error {
+	return msgpack.Unmarshal(data, v)
+}
+
+// ProtobufCodec encodes generated protobuf messages, the event type must be a message pointer.
+type ProtobufCodec struct{}
+
+func (ProtobufCodec) ContentType() string {
+	return ContentTypeProtobuf
+}
+
+func (ProtobufCodec) Marshal(v any) ([]byte, error) {
+	msg, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("%w: %T", ErrNotProtoMessage, v)
+	}
+
+	return proto.Marshal(msg)
+}
+
+// Unmarshal accepts a message, or a pointer to a message pointer which is allocated when nil.
+func (ProtobufCodec) Unmarshal(data []byte, v any) error {
+	msg, ok := v.(proto.Message)
+	if !ok {
+		value := reflect.ValueOf(v)
+		if value.Kind() == reflect.Pointer && value.Elem().Kind() == reflect.Pointer {
+			if value.Elem().IsNil() {
+				value.Elem().Set(reflect.New(value.Elem().Type().Elem()))
+			}
+
+			msg, ok = value.Elem().Interface().(proto.Message)
+		}
+	}
+
+	if !ok {
+		return fmt.Errorf("%w: %T", ErrNotProtoMessage, v)
+	}
+
+	return proto.Unmarshal(data, msg)
+}
@@ -0,0 +1,96 @@
+package messaging
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/thienhaole92/uframework/util"
+)
+
+type correlationIDKey struct{}
+
+// Envelope is the wire format of an event. Data holds the codec output, inline for JSON and
+// base64 encoded for binary codecs.
+type Envelope struct {
+	ID            string          `json:"id"`
+	Type          string          `json:"type"`
+	Version       int             `json:"version"`
+	OccurredAt    time.Time       `json:"occurred_at"`
+	CorrelationID string          `json:"correlation_id,omitempty"`
+	ContentType   string          `json:"content_type"`
+	Data          json.RawMessage `json:"data"`
+}
+
+// Event is a decoded envelope handed to a Handler.
+type Event[T any] struct {
+	ID            string
+	Type          string
+	Version       int
+	OccurredAt    time.Time
+	CorrelationID string
+	Data          T
+}
+
+// PublishOption overrides envelope fields of a published event.
+type PublishOption func(*Envelope)
+
+func WithCorrelationID(correlationID string) PublishOption {
+	return func(env *Envelope) {
+		env.CorrelationID = correlationID
+	}
+}
+
+func WithOccurredAt(occurredAt time.Time) PublishOption {
+	return func(env *Envelope) {
+		env.OccurredAt = occurredAt.UTC()
+	}
+}
+
+func WithEventID(id string) PublishOption {
+	return func(env *Envelope) {
+		env.ID = id
+	}
+}
+
+// ContextWithCorrelationID stores the correlation ID used by Publish when none is given.
+// Handlers receive a context carrying the correlation ID of their event, so events published
+// while handling another one share its correlation ID.
+func ContextWithCorrelationID(ctx context.Context, correlationID string) context.Context {
+	return context.WithValue(ctx, correlationIDKey{}, correlationID)
+}
+
+func CorrelationIDFromContext(ctx context.Context) string {
+	correlationID, _ := ctx.Value(correlationIDKey{}).(string)
+
+	return correlationID
+}
+
+func correlationID(ctx context.Context) string {
+	if correlationID := CorrelationIDFromContext(ctx); correlationID != "" {
+		return correlationID
+	}
+
+	return util.RequestIDFromContext(ctx)
+}
+
+func encodeData(codec Codec, data []byte) (json.RawMessage, error) {
+	if codec.ContentType() == ContentTypeJSON {
+		return data, nil
+	}
+
+	return json.Marshal(data)
+}
+
+func decodeData(env *Envelope) ([]byte, error) {
+	if env.ContentType == ContentTypeJSON {
+		return env.Data, nil
+	}
+
+	var data []byte
+	if err := json.Unmarshal(env.Data, &data); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
@@ -0,0 +1,216 @@
+package messaging
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/google/uuid"
+	"github.com/thienhaole92/uframework/broker"
+	"github.com/thienhaole92/uframework/redispub"
+	"github.com/thienhaole92/uframework/redissub"
+	"github.com/thienhaole92/uframework/validator"
+)
+
+var (
+	ErrEncode              = errors.New("failed to encode event")
+	ErrDecode              = errors.New("failed to decode event")
+	ErrInvalidEvent        = errors.New("event failed validation")
+	ErrUnexpectedEventType = errors.New("unexpected event type")
+	ErrUnsupportedVersion  = errors.New("unsupported event version")
+	ErrContentTypeMismatch = errors.New("event content type does not match the codec")
+)
+
+// defaultValidator is shared by the topics without a validator, building one registers every
+// rule and message.
+//
+//nolint:gochecknoglobals
+var defaultValidator = sync.OnceValue(validator.DefaultRestValidator)
+
+// Topic describes the events of type T carried by a stream.
+type Topic[T any] struct {
+	Name string
+	// Type names the event, such as "order.created". When set, Subscribe rejects other types.
+	Type string
+	// Version of the event schema written by Publish. Subscribe rejects events of a newer version.
+	Version   int
+	Codec     Codec                // Defaults to JSONCodec.
+	Validator *validator.Validator // Defaults to validator.DefaultRestValidator.
+}
+
+// Handler handles a decoded and validated event.
+type Handler[T any] func(ctx context.Context, event *Event[T]) error
+
+func (t Topic[T]) codec() Codec {
+	if t.Codec == nil {
+		return JSONCodec{}
+	}
+
+	return t.Codec
+}
+
+func (t Topic[T]) validator() *validator.Validator {
+	if t.Validator == nil {
+		return defaultValidator()
+	}
+
+	return t.Validator
+}
+
+// Encode validates data and wraps it in an envelope. The correlation ID defaults to the one of ctx,
+// or to its request ID.
+func Encode[T any](ctx context.Context, topic Topic[T], data T, opts ...PublishOption) ([]byte, error) {
+	if err := validate(topic.validator(), data); err != nil {
+		return nil, err
+	}
+
+	codec := topic.codec()
+
+	raw, err := codec.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w %s: %w", ErrEncode, topic.Type, err)
+	}
+
+	encoded, err := encodeData(codec, raw)
+	if err != nil {
+		return nil, fmt.Errorf("%w %s: %w", ErrEncode, topic.Type, err)
+	}
+
+	env := &Envelope{
+		ID:            uuid.NewString(),
+		Type:          topic.Type,
+		Version:       topic.Version,
+		OccurredAt:    time.Now().UTC(),
+		CorrelationID: correlationID(ctx),
+		ContentType:   codec.ContentType(),
+		Data:          encoded,
+	}
+
+	for _, opt := range opts {
+		opt(env)
+	}
+
+	payload, err := json.Marshal(env)
+	if err != nil {
+		return nil, fmt.Errorf("%w %s: %w", ErrEncode, topic.Type, err)
+	}
+
+	return payload, nil
+}
+
+// Decode unwraps and validates an event written by Encode.
+func Decode[T any](topic Topic[T], payload []byte) (*Event[T], error) {
+	var env Envelope
+	if err := json.Unmarshal(payload, &env); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDecode, err)
+	}
+
+	if topic.Type != "" && env.Type != topic.Type {
+		return nil, fmt.Errorf("%w: got %q, want %q", ErrUnexpectedEventType, env.Type, topic.Type)
+	}
+
+	if env.Version > topic.Version {
+		return nil, fmt.Errorf("%w: %s version %d, supported up to %d", ErrUnsupportedVersion, env.Type, env.Version, topic.Version)
+	}
+
+	codec := topic.codec()
+	if env.ContentType != codec.ContentType() {
+		return nil, fmt.Errorf("%w: got %q, want %q", ErrContentTypeMismatch, env.ContentType, codec.ContentType())
+	}
+
+	raw, err := decodeData(&env)
+	if err != nil {
+		return nil, fmt.Errorf("%w %s: %w", ErrDecode, env.Type, err)
+	}
+
+	var data T
+	if err := codec.Unmarshal(raw, &data); err != nil {
+		return nil, fmt.Errorf("%w %s: %w", ErrDecode, env.Type, err)
+	}
+
+	event := &Event[T]{
+		ID:            env.ID,
+		Type:          env.Type,
+		Version:       env.Version,
+		OccurredAt:    env.OccurredAt,
+		CorrelationID: env.CorrelationID,
+		Data:          data,
+	}
+
+	if err := validate(topic.validator(), event.Data); err != nil {
+		return nil, err
+	}
+
+	return event, nil
+}
+
+// Publish encodes data and publishes it to the topic.
+func Publish[T any](
+	ctx context.Context,
+	publisher broker.Publisher,
+	topic Topic[T],
+	data T,
+	opts ...PublishOption,
+) error {
+	payload, err := Encode(ctx, topic, data, opts...)
+	if err != nil {
+		return err
+	}
+
+	msg := message.NewMessage(watermill.NewUUID(), payload)
+	msg.Metadata.Set(redispub.MetadataContentType, ContentTypeEnvelope)
+
+	return publisher.Publish(ctx, topic.Name, msg)
+}
+
+// Handle adapts a typed handler to a redissub.MessageHandler. Events that cannot be decoded or
+// fail validation are returned as permanent errors, so they are dead-lettered instead of retried.
+func Handle[T any](topic Topic[T], handler Handler[T]) redissub.MessageHandler {
+	topic.Validator = topic.validator()
+
+	return func(ctx context.Context, msg *message.Message) error {
+		event, err := Decode(topic, msg.Payload)
+		if err != nil {
+			return redissub.Permanent(err)
+		}
+
+		if event.CorrelationID != "" {
+			ctx = ContextWithCorrelationID(ctx, event.CorrelationID)
+		}
+
+		return handler(ctx, event)
+	}
+}
+
+// Subscribe registers a typed handler for the topic.
+func Subscribe[T any](subscriber broker.Subscriber, topic Topic[T], handler Handler[T]) error {
+	return subscriber.Subscribe(topic.Name, Handle(topic, handler))
+}
+
+// validate runs struct validation, other kinds of data have no rules to check.
+func validate(v *validator.Validator, data any) error {
+	value := reflect.ValueOf(data)
+	for value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			return nil
+		}
+
+		value = value.Elem()
+	}
+
+	if value.Kind() != reflect.Struct {
+		return nil
+	}
+
+	if err := v.Validate(data); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidEvent, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,213 @@
+package messaging_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/require"
+	"github.com/thienhaole92/uframework/broker"
+	"github.com/thienhaole92/uframework/messaging"
+	"github.com/thienhaole92/uframework/redissub"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type OrderCreated struct {
+	OrderID string `json:"order_id" msgpack:"order_id" validate:"required"`
+	Amount  int64  `json:"amount"   msgpack:"amount"   validate:"gt=0"`
+}
+
+func orderTopic(codec messaging.Codec) messaging.Topic[OrderCreated] {
+	return messaging.Topic[OrderCreated]{
+		Name:      "orders",
+		Type:      "order.created",
+		Version:   2,
+		Codec:     codec,
+		Validator: nil,
+	}
+}
+
+func TestEncodeDecode(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		codec messaging.Codec
+	}{
+		{name: "default", codec: nil},
+		{name: "json", codec: messaging.JSONCodec{}},
+		{name: "msgpack", codec: messaging.MsgpackCodec{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			topic := orderTopic(tt.codec)
+			occurredAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+			ctx := messaging.ContextWithCorrelationID(context.Background(), "correlation")
+
+			payload, err := messaging.Encode(ctx, topic, OrderCreated{OrderID: "o-1", Amount: 10},
+				messaging.WithOccurredAt(occurredAt))
+			require.NoError(t, err)
+
+			event, err := messaging.Decode(topic, payload)
+			require.NoError(t, err)
+			require.Equal(t, OrderCreated{OrderID: "o-1", Amount: 10}, event.Data)
+			require.Equal(t, "order.created", event.Type)
+			require.Equal(t, 2, event.Version)
+			require.Equal(t, "correlation", event.CorrelationID)
+			require.True(t, occurredAt.Equal(event.OccurredAt))
+			require.NotEmpty(t, event.ID)
+		})
+	}
+}
+
+func TestEncode_JSONDataInline(t *testing.T) {
+	t.Parallel()
+
+	payload, err := messaging.Encode(context.Background(), orderTopic(nil), OrderCreated{OrderID: "o-1", Amount: 10})
+	require.NoError(t, err)
+
+	var env messaging.Envelope
+	require.NoError(t, json.Unmarshal(payload, &env))
+	require.Equal(t, messaging.ContentTypeJSON, env.ContentType)
+	require.JSONEq(t, `{"order_id":"o-1","amount":10}`, string(env.Data))
+}
+
+func TestEncodeDecode_Protobuf(t *testing.T) {
+	t.Parallel()
+
+	topic := messaging.Topic[*wrapperspb.StringValue]{
+		Name:      "names",
+		Type:      "name.changed",
+		Version:   1,
+		Codec:     messaging.ProtobufCodec{},
+		Validator: nil,
+	}
+
+	payload, err := messaging.Encode(context.Background(), topic, wrapperspb.String("alice"))
+	require.NoError(t, err)
+
+	event, err := messaging.Decode(topic, payload)
+	require.NoError(t, err)
+	require.Equal(t, "alice", event.Data.GetValue())
+
+	_, err = messaging.ProtobufCodec{}.Marshal("not a message")
+	require.ErrorIs(t, err, messaging.ErrNotProtoMessage)
+}
+
+func TestDecode_Rejects(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	valid, err := messaging.Encode(ctx, orderTopic(nil), OrderCreated{OrderID: "o-1", Amount: 10})
+	require.NoError(t, err)
+
+	_, err = messaging.Encode(ctx, orderTopic(nil), OrderCreated{OrderID: "", Amount: 10})
+	require.ErrorIs(t, err, messaging.ErrInvalidEvent)
+
+	invalid, err := json.Marshal(messaging.Envelope{
+		ID:            "id",
+		Type:          "order.created",
+		Version:       1,
+		OccurredAt:    time.Now(),
+		CorrelationID: "",
+		ContentType:   messaging.ContentTypeJSON,
+		Data:          json.RawMessage(`{"order_id":"o-1","amount":0}`),
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		topic   messaging.Topic[OrderCreated]
+		payload []byte
+		err     error
+	}{
+		{name: "malformed", topic: orderTopic(nil), payload: []byte("{"), err: messaging.ErrDecode},
+		{name: "invalid", topic: orderTopic(nil), payload: invalid, err: messaging.ErrInvalidEvent},
+		{name: "codec", topic: orderTopic(messaging.MsgpackCodec{}), payload: valid, err: messaging.ErrContentTypeMismatch},
+		{
+			name: "type",
+			topic: messaging.Topic[OrderCreated]{
+				Name: "orders", Type: "order.cancelled", Version: 2, Codec: nil, Validator: nil,
+			},
+			payload: valid,
+			err:     messaging.ErrUnexpectedEventType,
+		},
+		{
+			name: "version",
+			topic: messaging.Topic[OrderCreated]{
+				Name: "orders", Type: "order.created", Version: 1, Codec: nil, Validator: nil,
+			},
+			payload: valid,
+			err:     messaging.ErrUnsupportedVersion,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := messaging.Decode(tt.topic, tt.payload)
+			require.ErrorIs(t, err, tt.err)
+		})
+	}
+}
+
+func TestHandle(t *testing.T) {
+	t.Parallel()
+
+	topic := orderTopic(nil)
+	ctx := messaging.ContextWithCorrelationID(context.Background(), "correlation")
+
+	payload, err := messaging.Encode(ctx, topic, OrderCreated{OrderID: "o-1", Amount: 10})
+	require.NoError(t, err)
+
+	var received *messaging.Event[OrderCreated]
+
+	handler := messaging.Handle(topic, func(ctx context.Context, event *messaging.Event[OrderCreated]) error {
+		received = event
+
+		require.Equal(t, "correlation", messaging.CorrelationIDFromContext(ctx))
+
+		return nil
+	})
+
+	require.NoError(t, handler(context.Background(), message.NewMessage("id", payload)))
+	require.Equal(t, "o-1", received.Data.OrderID)
+
+	// Undecodable events are not retried.
+	require.True(t, redissub.IsPermanent(handler(context.Background(), message.NewMessage("id", []byte("{")))))
+}
+
+func TestPublishSubscribe_GoChannel(t *testing.T) {
+	t.Parallel()
+
+	//nolint:exhaustruct
+	pubsub := broker.NewGoChannel(redissub.Options{})
+	t.Cleanup(func() {
+		require.NoError(t, pubsub.Close())
+	})
+
+	topic := orderTopic(nil)
+	received := make(chan *messaging.Event[OrderCreated], 1)
+
+	require.NoError(t, messaging.Subscribe(pubsub, topic, func(_ context.Context, event *messaging.Event[OrderCreated]) error {
+		received <- event
+
+		return nil
+	}))
+	require.NoError(t, messaging.Publish(context.Background(), pubsub, topic, OrderCreated{OrderID: "o-1", Amount: 10}))
+
+	select {
+	case event := <-received:
+		require.Equal(t, "o-1", event.Data.OrderID)
+		require.Equal(t, 2, event.Version)
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "event not received")
+	}
+}
@@ -0,0 +1,27 @@
+package metricserver
+
+import (
+	"errors"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Register registers the collector, or returns the one already registered under the same name so
+// that several components can share their metrics.
+func Register[T prometheus.Collector](reg prometheus.Registerer, collector T) (T, error) {
+	if err := reg.Register(collector); err != nil {
+		var are prometheus.AlreadyRegisteredError
+		if !errors.As(err, &are) {
+			return collector, err
+		}
+
+		existing, ok := are.ExistingCollector.(T)
+		if !ok {
+			return collector, err
+		}
+
+		return existing, nil
+	}
+
+	return collector, nil
+}
@@ -0,0 +1,43 @@
+package metricserver_test
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+	"github.com/thienhaole92/uframework/metricserver"
+)
+
+func newCounter() *prometheus.CounterVec {
+	return prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name:        "jobs_total",
+		Help:        "Jobs handled.",
+		Namespace:   "",
+		Subsystem:   "",
+		ConstLabels: nil,
+	}, []string{"queue"})
+}
+
+func TestRegister(t *testing.T) {
+	t.Parallel()
+
+	reg := prometheus.NewRegistry()
+
+	first, err := metricserver.Register(reg, newCounter())
+	require.NoError(t, err)
+
+	// A second registration shares the collector already registered.
+	second, err := metricserver.Register(reg, newCounter())
+	require.NoError(t, err)
+	require.Same(t, first, second)
+
+	// A collector of another type under the same name is rejected.
+	_, err = metricserver.Register(reg, prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name:        "jobs_total",
+		Help:        "Jobs handled.",
+		Namespace:   "",
+		Subsystem:   "",
+		ConstLabels: nil,
+	}, []string{"queue"}))
+	require.Error(t, err)
+}
@@ -6,6 +6,7 @@ import (
 	"net"
 	"net/http"
 	"strconv"
+	"sync/atomic"
 	"time"
 
 	"github.com/labstack/echo-contrib/echoprometheus"
@@ -26,17 +27,23 @@ type Option struct {
 type Server struct {
 	gracePeriod time.Duration
 	address     string
+	healthCheck atomic.Pointer[func() error]
 	Echo        *echo.Echo
 	Server      *http.Server
 }
 
 func New(opts *Option) *Server {
 	ech := echo.New()
+	svr := &Server{
+		gracePeriod: opts.GracePeriod,
+		address:     "",
+		healthCheck: atomic.Pointer[func() error]{},
+		Echo:        ech,
+		Server:      nil,
+	}
 
 	ech.HideBanner = true
-	ech.GET(opts.StatusPath, func(ctx echo.Context) error {
-		return ctx.JSON(http.StatusOK, map[string]any{"status": "ok"})
-	})
+	ech.GET(opts.StatusPath, svr.status)
 	ech.GET(opts.MetricPath, echoprometheus.NewHandler())
 
 	address := net.JoinHostPort(opts.Host, strconv.Itoa(opts.Port))
@@ -58,12 +65,26 @@ func New(opts *Option) *Server {
 		ConnContext:                  nil,
 	}
 
-	return &Server{
-		gracePeriod: opts.GracePeriod,
-		address:     address,
-		Echo:        ech,
-		Server:      server,
+	svr.address = address
+	svr.Server = server
+
+	return svr
+}
+
+// SetHealthCheck makes the status endpoint answer 503 while check returns an error. The runner sets
+// it to the health of the whole service.
+func (s *Server) SetHealthCheck(check func() error) {
+	s.healthCheck.Store(&check)
+}
+
+func (s *Server) status(ctx echo.Context) error {
+	if check := s.healthCheck.Load(); check != nil {
+		if err := (*check)(); err != nil {
+			return ctx.JSON(http.StatusServiceUnavailable, map[string]any{"status": "unhealthy", "error": err.Error()})
+		}
 	}
+
+	return ctx.JSON(http.StatusOK, map[string]any{"status": "ok"})
 }
 
 func (s *Server) Run() {
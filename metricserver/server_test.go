@@ -2,8 +2,10 @@ package metricserver_test
 
 import (
 	"context"
+	"errors"
 	"io"
 	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
@@ -11,6 +13,8 @@ import (
 	"github.com/thienhaole92/uframework/metricserver"
 )
 
+var errUnhealthy = errors.New("subscriptions keep failing")
+
 func startServer(t *testing.T) *metricserver.Server {
 	t.Helper()
 
@@ -98,3 +102,36 @@ func TestMetricServer(t *testing.T) {
 
 	shutdownServer(t, server)
 }
+
+func TestMetricServer_HealthCheck(t *testing.T) {
+	t.Parallel()
+
+	server := metricserver.New(&metricserver.Option{
+		Host:         "127.0.0.1",
+		Port:         0,
+		ReadTimeout:  time.Second,
+		WriteTimeout: time.Second,
+		GracePeriod:  time.Second,
+		MetricPath:   "/metrics",
+		StatusPath:   "/status",
+	})
+
+	var healthErr error
+
+	server.SetHealthCheck(func() error { return healthErr })
+
+	status := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		server.Echo.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status", nil))
+
+		return rec
+	}
+
+	require.Equal(t, http.StatusOK, status().Code)
+
+	healthErr = errUnhealthy
+
+	rec := status()
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	require.Contains(t, rec.Body.String(), "subscriptions keep failing")
+}
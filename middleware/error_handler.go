@@ -2,25 +2,211 @@ package middleware
 
 import (
 	"errors"
+	"fmt"
+	"net/http"
+	"strings"
 
 	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog/log"
+	"github.com/thienhaole92/uframework/apperror"
 )
 
+const (
+	MIMEApplicationProblemJSON = "application/problem+json"
+
+	// problemTypeBlank is the type of problems that have no more semantics than their status.
+	problemTypeBlank = "about:blank"
+)
+
+type ErrorHandlerConfig struct {
+	// Next handles the errors that are neither *echo.HTTPError nor *apperror.Error, when
+	// ProblemJSON is off.
+	Next echo.HTTPErrorHandler
+	// ProblemJSON writes every error as an RFC 9457 application/problem+json body.
+	ProblemJSON bool
+	// TypeBaseURI prefixes the code of application errors to form their problem type, such as
+	// "https://errors.example.com/" for "https://errors.example.com/not-found". The type is
+	// "about:blank" when empty.
+	TypeBaseURI string
+	// HideInternalErrors replaces the message of 5xx errors by the status text, so internal
+	// errors do not reach clients. They are logged either way.
+	HideInternalErrors bool
+}
+
+// Problem is an RFC 9457 problem details body, extended with the request ID, the application
+// error code and the field errors.
+type Problem struct {
+	Type      string                `json:"type"`
+	Title     string                `json:"title"`
+	Status    int                   `json:"status"`
+	Detail    string                `json:"detail,omitempty"`
+	Instance  string                `json:"instance,omitempty"`
+	RequestID string                `json:"request_id,omitempty"`
+	Code      apperror.Code         `json:"code,omitempty"`
+	Errors    []apperror.FieldError `json:"errors,omitempty"`
+}
+
+type appErrorResponse struct {
+	Code    apperror.Code         `json:"code"`
+	Message string                `json:"message"`
+	Details map[string]any        `json:"details,omitempty"`
+	Fields  []apperror.FieldError `json:"fields,omitempty"`
+}
+
+// HTTPStatus returns the HTTP status of an application error code.
+func HTTPStatus(code apperror.Code) int {
+	switch code {
+	case apperror.CodeNotFound:
+		return http.StatusNotFound
+	case apperror.CodeInvalidArgument:
+		return http.StatusBadRequest
+	case apperror.CodeConflict:
+		return http.StatusConflict
+	case apperror.CodeUnauthorized:
+		return http.StatusUnauthorized
+	case apperror.CodeInternal:
+		return http.StatusInternalServerError
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// ErrorHandler writes *echo.HTTPError and *apperror.Error as JSON, with the status of the error
+// code for the latter, which wins when an *echo.HTTPError wraps one. Other errors are passed to next.
 func ErrorHandler(next echo.HTTPErrorHandler) echo.HTTPErrorHandler {
+	return ErrorHandlerWithConfig(ErrorHandlerConfig{
+		Next:               next,
+		ProblemJSON:        false,
+		TypeBaseURI:        "",
+		HideInternalErrors: false,
+	})
+}
+
+func ErrorHandlerWithConfig(config ErrorHandlerConfig) echo.HTTPErrorHandler {
 	return func(err error, ectx echo.Context) {
 		if ectx.Response().Committed {
 			return
 		}
 
-		var httpErr *echo.HTTPError
-		if errors.As(err, &httpErr) {
-			_ = ectx.JSON(httpErr.Code, httpErr)
+		var (
+			httpErr *echo.HTTPError
+			appErr  *apperror.Error
+		)
+
+		// An application error wrapped in an *echo.HTTPError, such as the validation errors of
+		// httpserver.Wrapper, is written with its code and field errors.
+		switch {
+		case errors.As(err, &appErr):
+		case errors.As(err, &httpErr):
+		case !config.ProblemJSON:
+			if config.Next != nil {
+				config.Next(err, ectx)
+			}
+
+			return
+		default:
+			appErr = apperror.Internal(err)
+		}
+
+		status := errorStatus(httpErr, appErr)
+		if status >= http.StatusInternalServerError {
+			log.Error().Err(err).Str("path", ectx.Request().URL.Path).Msg("request failed")
+		}
+
+		if config.ProblemJSON {
+			writeProblem(ectx, config, status, httpErr, appErr)
+
+			return
+		}
+
+		if httpErr != nil {
+			if status >= http.StatusInternalServerError && config.HideInternalErrors {
+				httpErr = echo.NewHTTPError(status, http.StatusText(status))
+			}
+
+			_ = ectx.JSON(status, httpErr)
 
 			return
 		}
 
-		if next != nil {
-			next(err, ectx)
+		message := appErr.Message
+		if status >= http.StatusInternalServerError && config.HideInternalErrors {
+			message = http.StatusText(status)
 		}
+
+		_ = ectx.JSON(status, appErrorResponse{
+			Code:    appErr.Code,
+			Message: message,
+			Details: appErr.Details,
+			Fields:  appErr.Fields,
+		})
+	}
+}
+
+// errorStatus returns the status of the error, exactly one of httpErr and appErr being set.
+func errorStatus(httpErr *echo.HTTPError, appErr *apperror.Error) int {
+	if httpErr != nil {
+		return httpErr.Code
 	}
+
+	return HTTPStatus(appErr.Code)
+}
+
+func writeProblem(
+	ectx echo.Context,
+	config ErrorHandlerConfig,
+	status int,
+	httpErr *echo.HTTPError,
+	appErr *apperror.Error,
+) {
+	problem := Problem{
+		Type:      problemTypeBlank,
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    "",
+		Instance:  ectx.Request().URL.Path,
+		RequestID: requestID(ectx),
+		Code:      "",
+		Errors:    nil,
+	}
+
+	if httpErr != nil {
+		problem.Detail = fmt.Sprint(httpErr.Message)
+	} else {
+		problem.Detail = appErr.Message
+		problem.Code = appErr.Code
+		problem.Errors = appErr.Fields
+
+		if config.TypeBaseURI != "" {
+			problem.Type = config.TypeBaseURI + strings.ReplaceAll(strings.ToLower(string(appErr.Code)), "_", "-")
+		}
+	}
+
+	if status >= http.StatusInternalServerError && config.HideInternalErrors {
+		problem.Detail = ""
+	}
+
+	// The title already says as much.
+	if problem.Detail == problem.Title {
+		problem.Detail = ""
+	}
+
+	ectx.Response().Header().Set(echo.HeaderContentType, MIMEApplicationProblemJSON)
+
+	if ectx.Request().Method == http.MethodHead {
+		_ = ectx.NoContent(status)
+
+		return
+	}
+
+	_ = ectx.JSON(status, problem)
+}
+
+// requestID returns the ID set by the RequestID middleware, or the one of the request header.
+func requestID(ectx echo.Context) string {
+	if rid, ok := ectx.Get(RequestIDContextKey).(string); ok {
+		return rid
+	}
+
+	return ectx.Request().Header.Get(echo.HeaderXRequestID)
 }
@@ -2,12 +2,14 @@ package middleware_test
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/require"
+	"github.com/thienhaole92/uframework/apperror"
 	"github.com/thienhaole92/uframework/middleware"
 	"github.com/thienhaole92/uframework/testutil"
 )
@@ -78,6 +80,213 @@ func TestErrorHandler_GenericError(t *testing.T) {
 	require.True(t, nextCalled) // Ensure next handler was called
 }
 
+func TestErrorHandler_AppError(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		err      error
+		status   int
+		expected string
+	}{
+		{
+			name:     "not found",
+			err:      fmt.Errorf("get order: %w", apperror.NotFound("order not found")),
+			status:   http.StatusNotFound,
+			expected: `{"code":"NOT_FOUND","message":"order not found"}`,
+		},
+		{
+			name:     "details",
+			err:      apperror.InvalidArgument("invalid order").WithDetail("field", "amount"),
+			status:   http.StatusBadRequest,
+			expected: `{"code":"INVALID_ARGUMENT","message":"invalid order","details":{"field":"amount"}}`,
+		},
+		{
+			name:     "conflict",
+			err:      apperror.Conflict("order already paid"),
+			status:   http.StatusConflict,
+			expected: `{"code":"CONFLICT","message":"order already paid"}`,
+		},
+		{
+			name:     "unauthorized",
+			err:      apperror.Unauthorized("token expired"),
+			status:   http.StatusUnauthorized,
+			expected: `{"code":"UNAUTHORIZED","message":"token expired"}`,
+		},
+		{
+			name:     "internal",
+			err:      apperror.Internal(ErrGeneric),
+			status:   http.StatusInternalServerError,
+			expected: `{"code":"INTERNAL","message":"internal error"}`,
+		},
+		{
+			name: "wrapped in HTTP error",
+			err: &echo.HTTPError{
+				Code:     http.StatusBadRequest,
+				Message:  "validation failed",
+				Internal: apperror.InvalidArgument("request validation failed"),
+			},
+			status:   http.StatusBadRequest,
+			expected: `{"code":"INVALID_ARGUMENT","message":"request validation failed"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, rec, _ := testutil.SetupEchoContext(t, &testutil.Options{
+				Method: http.MethodGet,
+				Path:   "/orders/1",
+				Body:   nil,
+			})
+
+			middleware.ErrorHandler(func(_ error, _ echo.Context) {
+				t.Fatalf("Next handler should not be called for application errors")
+			})(tt.err, ctx)
+
+			require.Equal(t, tt.status, rec.Code)
+			require.JSONEq(t, tt.expected, rec.Body.String())
+		})
+	}
+}
+
+func TestErrorHandlerWithConfig_ProblemJSON(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		config   middleware.ErrorHandlerConfig
+		err      error
+		status   int
+		expected string
+	}{
+		{
+			name: "application error",
+			config: middleware.ErrorHandlerConfig{
+				Next:               nil,
+				ProblemJSON:        true,
+				TypeBaseURI:        "https://errors.example.com/",
+				HideInternalErrors: true,
+			},
+			err: apperror.InvalidArgument("invalid order").WithFields(apperror.FieldError{
+				Field:   "amount",
+				Rule:    "gt",
+				Param:   "0",
+				Message: "amount must be greater than 0",
+			}),
+			status: http.StatusBadRequest,
+			expected: `{
+				"type": "https://errors.example.com/invalid-argument",
+				"title": "Bad Request",
+				"status": 400,
+				"detail": "invalid order",
+				"instance": "/orders/1",
+				"request_id": "request",
+				"code": "INVALID_ARGUMENT",
+				"errors": [{"field": "amount", "rule": "gt", "param": "0", "message": "amount must be greater than 0"}]
+			}`,
+		},
+		{
+			name: "http error",
+			config: middleware.ErrorHandlerConfig{
+				Next:               nil,
+				ProblemJSON:        true,
+				TypeBaseURI:        "https://errors.example.com/",
+				HideInternalErrors: true,
+			},
+			err:    echo.NewHTTPError(http.StatusTooManyRequests, "rate limit exceeded"),
+			status: http.StatusTooManyRequests,
+			expected: `{
+				"type": "about:blank",
+				"title": "Too Many Requests",
+				"status": 429,
+				"detail": "rate limit exceeded",
+				"instance": "/orders/1",
+				"request_id": "request"
+			}`,
+		},
+		{
+			name: "hidden internal error",
+			config: middleware.ErrorHandlerConfig{
+				Next:               nil,
+				ProblemJSON:        true,
+				TypeBaseURI:        "",
+				HideInternalErrors: true,
+			},
+			err:    apperror.Wrap(ErrGeneric, apperror.CodeInternal, "database password rejected"),
+			status: http.StatusInternalServerError,
+			expected: `{
+				"type": "about:blank",
+				"title": "Internal Server Error",
+				"status": 500,
+				"instance": "/orders/1",
+				"request_id": "request",
+				"code": "INTERNAL"
+			}`,
+		},
+		{
+			name: "generic error",
+			config: middleware.ErrorHandlerConfig{
+				Next:               nil,
+				ProblemJSON:        true,
+				TypeBaseURI:        "",
+				HideInternalErrors: false,
+			},
+			err:    ErrGeneric,
+			status: http.StatusInternalServerError,
+			expected: `{
+				"type": "about:blank",
+				"title": "Internal Server Error",
+				"status": 500,
+				"detail": "internal error",
+				"instance": "/orders/1",
+				"request_id": "request",
+				"code": "INTERNAL"
+			}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, rec, _ := testutil.SetupEchoContext(t, &testutil.Options{
+				Method: http.MethodGet,
+				Path:   "/orders/1",
+				Body:   nil,
+			})
+			ctx.Set(middleware.RequestIDContextKey, "request")
+
+			middleware.ErrorHandlerWithConfig(tt.config)(tt.err, ctx)
+
+			require.Equal(t, tt.status, rec.Code)
+			require.Equal(t, middleware.MIMEApplicationProblemJSON, rec.Header().Get(echo.HeaderContentType))
+			require.JSONEq(t, tt.expected, rec.Body.String())
+		})
+	}
+}
+
+func TestErrorHandlerWithConfig_HideInternalErrors(t *testing.T) {
+	t.Parallel()
+
+	ctx, rec, _ := testutil.SetupEchoContext(t, &testutil.Options{
+		Method: http.MethodGet,
+		Path:   "/orders/1",
+		Body:   nil,
+	})
+
+	middleware.ErrorHandlerWithConfig(middleware.ErrorHandlerConfig{
+		Next:               nil,
+		ProblemJSON:        false,
+		TypeBaseURI:        "",
+		HideInternalErrors: true,
+	})(echo.NewHTTPError(http.StatusBadGateway, "upstream 10.0.0.3 refused"), ctx)
+
+	require.Equal(t, http.StatusBadGateway, rec.Code)
+	require.JSONEq(t, `{"message":"Bad Gateway"}`, rec.Body.String())
+}
+
 // BenchmarkErrorHandler_HTTPError benchmarks handling of *echo.HTTPError.
 func BenchmarkErrorHandler_HTTPError(b *testing.B) {
 	e := echo.New()
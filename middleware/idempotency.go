@@ -0,0 +1,375 @@
+package middleware
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+	"github.com/thienhaole92/uframework/goredis"
+)
+
+const (
+	HeaderIdempotencyKey     = "Idempotency-Key"
+	HeaderIdempotentReplayed = "Idempotent-Replayed"
+
+	defaultIdempotencyTTL       = 24 * time.Hour
+	defaultIdempotencyLockTTL   = time.Minute
+	defaultIdempotencyKeyPrefix = "idempotency:"
+	maxIdempotencyKeyLength     = 255
+	defaultIdempotencyMaxBody   = 1 << 20
+
+	idempotencyStateInFlight  = "in_flight"
+	idempotencyStateCompleted = "completed"
+)
+
+// completeIdempotencyScript replaces the in-flight record ARGV[1] with the completed record ARGV[2]
+// for ARGV[3] ms. It returns nil when the lock expired and the key was taken by another request.
+const completeIdempotencyScript = `
+if redis.call("GET", KEYS[1]) ~= ARGV[1] then
+	return false
+end
+return redis.call("SET", KEYS[1], ARGV[2], "PX", ARGV[3])
+`
+
+// releaseIdempotencyScript deletes the key while it still holds the in-flight record ARGV[1].
+const releaseIdempotencyScript = `
+if redis.call("GET", KEYS[1]) ~= ARGV[1] then
+	return 0
+end
+return redis.call("DEL", KEYS[1])
+`
+
+//nolint:gochecknoglobals
+var (
+	completeIdempotency = redis.NewScript(completeIdempotencyScript)
+	releaseIdempotency  = redis.NewScript(releaseIdempotencyScript)
+)
+
+var (
+	errResponseNotHijackable = errors.New("response writer does not support hijacking")
+	errRequestBodyTooLarge   = errors.New("request body too large")
+)
+
+type IdempotencyConfig struct {
+	Skipper   middleware.Skipper
+	Redis     *goredis.Redis
+	TTL       time.Duration // How long a completed response is replayed, defaults to 24h.
+	LockTTL   time.Duration // How long a request may stay in flight before the key is released, defaults to 1m.
+	Methods   []string      // Methods the middleware applies to, defaults to POST and PATCH.
+	KeyPrefix string        // Prefix of the Redis keys, defaults to "idempotency:".
+	// ReplayHeaders are the response headers stored and replayed besides Content-Type, defaults to
+	// Location. Other headers, such as X-Request-ID or RateLimit-*, are set by the middlewares of
+	// the retry.
+	ReplayHeaders []string
+	// MaxBodyBytes bounds the request body read to fingerprint the request, defaults to 1MiB. Larger
+	// bodies get 413 before the handler runs.
+	MaxBodyBytes int64
+}
+
+type idempotencyRecord struct {
+	State       string      `json:"state"`
+	Fingerprint string      `json:"fingerprint"`
+	Token       string      `json:"token,omitempty"` // Tells the in-flight records of requests apart.
+	Status      int         `json:"status,omitempty"`
+	Header      http.Header `json:"header,omitempty"`
+	Body        []byte      `json:"body,omitempty"`
+}
+
+func Idempotency(rds *goredis.Redis) echo.MiddlewareFunc {
+	return IdempotencyWithConfig(IdempotencyConfig{
+		Skipper:       middleware.DefaultSkipper,
+		Redis:         rds,
+		TTL:           defaultIdempotencyTTL,
+		LockTTL:       defaultIdempotencyLockTTL,
+		Methods:       []string{http.MethodPost, http.MethodPatch},
+		KeyPrefix:     defaultIdempotencyKeyPrefix,
+		ReplayHeaders: []string{echo.HeaderLocation},
+		MaxBodyBytes:  defaultIdempotencyMaxBody,
+	})
+}
+
+// IdempotencyWithConfig stores the first response to a request carrying an Idempotency-Key header
+// and replays it for retries. Keys are scoped by user and route. A retry that arrives while the
+// original is still in flight gets 409, and reusing a key with a different body gets 422.
+// Server errors are not stored so the client may retry them.
+func IdempotencyWithConfig(config IdempotencyConfig) echo.MiddlewareFunc {
+	config = idempotencyDefaults(config)
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ectx echo.Context) error {
+			req := ectx.Request()
+			idemKey := strings.TrimSpace(req.Header.Get(HeaderIdempotencyKey))
+
+			if config.Skipper(ectx) || idemKey == "" || !slices.Contains(config.Methods, req.Method) {
+				return next(ectx)
+			}
+
+			if len(idemKey) > maxIdempotencyKeyLength {
+				return echo.NewHTTPError(
+					http.StatusBadRequest,
+					fmt.Sprintf("%s must not be longer than %d characters", HeaderIdempotencyKey, maxIdempotencyKeyLength),
+				)
+			}
+
+			fingerprint, err := fingerprintRequest(req, config.MaxBodyBytes)
+			if errors.Is(err, errRequestBodyTooLarge) {
+				return echo.NewHTTPError(http.StatusRequestEntityTooLarge, "request body too large").SetInternal(err)
+			}
+
+			if err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, "failed to read request body").SetInternal(err)
+			}
+
+			key := idempotencyKey(ectx, config.KeyPrefix, idemKey)
+
+			lock, acquired, err := lockIdempotencyKey(ectx, config, key, fingerprint)
+			if err != nil {
+				return err
+			}
+
+			if !acquired {
+				return replayIdempotent(ectx, config.Redis, key, fingerprint)
+			}
+
+			return recordIdempotent(ectx, next, config, key, fingerprint, lock)
+		}
+	}
+}
+
+func idempotencyDefaults(config IdempotencyConfig) IdempotencyConfig {
+	if config.Skipper == nil {
+		config.Skipper = middleware.DefaultSkipper
+	}
+
+	if config.TTL <= 0 {
+		config.TTL = defaultIdempotencyTTL
+	}
+
+	if config.LockTTL <= 0 {
+		config.LockTTL = defaultIdempotencyLockTTL
+	}
+
+	if len(config.Methods) == 0 {
+		config.Methods = []string{http.MethodPost, http.MethodPatch}
+	}
+
+	if config.MaxBodyBytes <= 0 {
+		config.MaxBodyBytes = defaultIdempotencyMaxBody
+	}
+
+	if len(config.ReplayHeaders) == 0 {
+		config.ReplayHeaders = []string{echo.HeaderLocation}
+	}
+
+	if config.KeyPrefix == "" {
+		config.KeyPrefix = defaultIdempotencyKeyPrefix
+	}
+
+	return config
+}
+
+// idempotencyKey scopes the client key by user and route so clients cannot collide.
+func idempotencyKey(ectx echo.Context, prefix, idemKey string) string {
+	user := "anonymous"
+	if userID := ectx.Get(UserIDContextKey); userID != nil {
+		user = fmt.Sprint(userID)
+	}
+
+	return prefix + user + ":" + ectx.Request().Method + ":" + ectx.Path() + ":" + idemKey
+}
+
+// fingerprintRequest hashes the request body, which must not be longer than maxBytes.
+func fingerprintRequest(req *http.Request, maxBytes int64) (string, error) {
+	hash := sha256.New()
+
+	if req.Body != nil {
+		body, err := io.ReadAll(io.LimitReader(req.Body, maxBytes+1))
+		if err != nil {
+			return "", err
+		}
+
+		if int64(len(body)) > maxBytes {
+			return "", fmt.Errorf("%w: more than %d bytes", errRequestBodyTooLarge, maxBytes)
+		}
+
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		hash.Write(body)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// lockIdempotencyKey stores an in-flight record under key, and returns it to complete or release
+// the key with.
+func lockIdempotencyKey(ectx echo.Context, config IdempotencyConfig, key, fingerprint string) (string, bool, error) {
+	record, err := json.Marshal(idempotencyRecord{
+		State:       idempotencyStateInFlight,
+		Fingerprint: fingerprint,
+		Token:       uuid.NewString(),
+		Status:      0,
+		Header:      nil,
+		Body:        nil,
+	})
+	if err != nil {
+		return "", false, err
+	}
+
+	acquired, err := config.Redis.SetNX(ectx.Request().Context(), key, record, config.LockTTL).Result()
+	if err != nil {
+		return "", false, echo.NewHTTPError(http.StatusServiceUnavailable, "idempotency store unavailable").SetInternal(err)
+	}
+
+	return string(record), acquired, nil
+}
+
+func replayIdempotent(ectx echo.Context, rds *goredis.Redis, key, fingerprint string) error {
+	raw, err := rds.Get(ectx.Request().Context(), key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		// The original finished with a server error and released the key in the meantime.
+		return echo.NewHTTPError(http.StatusConflict, "request with this idempotency key is being retried, try again")
+	}
+
+	if err != nil {
+		return echo.NewHTTPError(http.StatusServiceUnavailable, "idempotency store unavailable").SetInternal(err)
+	}
+
+	var record idempotencyRecord
+	if err := json.Unmarshal(raw, &record); err != nil {
+		return err
+	}
+
+	if record.Fingerprint != fingerprint {
+		return echo.NewHTTPError(
+			http.StatusUnprocessableEntity,
+			"idempotency key was already used with a different request body",
+		)
+	}
+
+	if record.State != idempotencyStateCompleted {
+		return echo.NewHTTPError(http.StatusConflict, "request with this idempotency key is still being processed")
+	}
+
+	header := ectx.Response().Header()
+	for name, values := range record.Header {
+		header[name] = values
+	}
+
+	header.Set(HeaderIdempotentReplayed, "true")
+
+	ectx.Response().WriteHeader(record.Status)
+
+	_, err = ectx.Response().Write(record.Body)
+
+	return err
+}
+
+func recordIdempotent(
+	ectx echo.Context,
+	next echo.HandlerFunc,
+	config IdempotencyConfig,
+	key, fingerprint, lock string,
+) error {
+	res := ectx.Response()
+	body := new(bytes.Buffer)
+	res.Writer = &teeResponseWriter{Writer: io.MultiWriter(res.Writer, body), ResponseWriter: res.Writer}
+
+	// Render errors here so the response written by the error handler is captured as well.
+	if err := next(ectx); err != nil {
+		ectx.Error(err)
+	}
+
+	// A detached context, the client may already be gone but the outcome must be stored.
+	ctx := context.WithoutCancel(ectx.Request().Context())
+
+	if res.Status >= http.StatusInternalServerError {
+		if err := releaseIdempotency.Run(ctx, config.Redis, []string{key}, lock).Err(); err != nil {
+			log.Error().Err(err).Str("key", key).Msg("failed to release idempotency key")
+		}
+
+		return nil
+	}
+
+	record, err := json.Marshal(idempotencyRecord{
+		State:       idempotencyStateCompleted,
+		Fingerprint: fingerprint,
+		Token:       "",
+		Status:      res.Status,
+		Header:      replayHeader(res.Header(), config.ReplayHeaders),
+		Body:        body.Bytes(),
+	})
+	if err != nil {
+		return err
+	}
+
+	err = completeIdempotency.Run(ctx, config.Redis, []string{key}, lock, record, config.TTL.Milliseconds()).Err()
+
+	switch {
+	case errors.Is(err, redis.Nil):
+		log.Warn().Str("key", key).Msg("idempotency key expired before the response was stored")
+	case err != nil:
+		log.Error().Err(err).Str("key", key).Msg("failed to store idempotent response")
+	}
+
+	return nil
+}
+
+// replayHeader keeps the Content-Type and the named headers of the response.
+func replayHeader(header http.Header, names []string) http.Header {
+	replayed := make(http.Header, len(names)+1)
+
+	for _, name := range append([]string{echo.HeaderContentType}, names...) {
+		if values := header.Values(name); len(values) > 0 {
+			replayed[http.CanonicalHeaderKey(name)] = slices.Clone(values)
+		}
+	}
+
+	return replayed
+}
+
+// teeResponseWriter copies everything written to the client into a buffer.
+type teeResponseWriter struct {
+	io.Writer
+	http.ResponseWriter
+}
+
+func (w *teeResponseWriter) WriteHeader(code int) {
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *teeResponseWriter) Write(b []byte) (int, error) {
+	return w.Writer.Write(b)
+}
+
+func (w *teeResponseWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *teeResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if hijacker, ok := w.ResponseWriter.(http.Hijacker); ok {
+		return hijacker.Hijack()
+	}
+
+	return nil, nil, errResponseNotHijackable
+}
+
+func (w *teeResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
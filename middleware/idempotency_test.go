@@ -0,0 +1,240 @@
+package middleware_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+	"github.com/thienhaole92/uframework/goredis"
+	"github.com/thienhaole92/uframework/middleware"
+	"github.com/thienhaole92/uframework/testutil"
+)
+
+func newIdempotencyServer(ctx context.Context, t *testing.T, handler echo.HandlerFunc) (*echo.Echo, *goredis.Redis) {
+	t.Helper()
+
+	container := testutil.SetupRedisContainer(ctx, t)
+
+	port, err := strconv.Atoi(container.Port.Port())
+	require.NoError(t, err)
+
+	redis := goredis.New(&goredis.Option{
+		Host:             container.Host,
+		Port:             port,
+		Username:         "",
+		Password:         "",
+		DB:               0,
+		DialTimeout:      5 * time.Second,
+		UseTLS:           false,
+		MaxIdleConns:     5,
+		MinIdleConns:     1,
+		PingTimeout:      2 * time.Second,
+		TTL:              time.Minute,
+		Mode:             goredis.ModeStandalone,
+		URL:              "",
+		Addrs:            nil,
+		MasterName:       "",
+		SentinelUsername: "",
+		SentinelPassword: "",
+		TLS:              nil,
+	})
+
+	iecho := echo.New()
+	iecho.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ectx echo.Context) error {
+			if userID := ectx.Request().Header.Get("X-User-ID"); userID != "" {
+				ectx.Set(middleware.UserIDContextKey, userID)
+			}
+
+			return next(ectx)
+		}
+	})
+	iecho.Use(middleware.Idempotency(redis))
+	iecho.POST("/orders", handler)
+
+	return iecho, redis
+}
+
+func idempotentRequest(iecho *echo.Echo, key, userID, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(body))
+	req.Header.Set(middleware.HeaderIdempotencyKey, key)
+	req.Header.Set("X-User-ID", userID)
+
+	rec := httptest.NewRecorder()
+	iecho.ServeHTTP(rec, req)
+
+	return rec
+}
+
+func TestIdempotency_Replay(t *testing.T) {
+	t.Parallel()
+
+	var calls atomic.Int32
+
+	iecho, _ := newIdempotencyServer(context.Background(), t, func(ectx echo.Context) error {
+		n := calls.Add(1)
+		ectx.Response().Header().Set(echo.HeaderLocation, "/orders/"+strconv.Itoa(int(n)))
+		ectx.Response().Header().Set(echo.HeaderXRequestID, "request-"+strconv.Itoa(int(n)))
+
+		return ectx.String(http.StatusCreated, "order "+strconv.Itoa(int(n)))
+	})
+
+	first := idempotentRequest(iecho, "key-1", "alice", `{"amount":1}`)
+	require.Equal(t, http.StatusCreated, first.Code)
+	require.Equal(t, "order 1", first.Body.String())
+
+	second := idempotentRequest(iecho, "key-1", "alice", `{"amount":1}`)
+	require.Equal(t, http.StatusCreated, second.Code)
+	require.Equal(t, "order 1", second.Body.String())
+	require.Equal(t, "/orders/1", second.Header().Get(echo.HeaderLocation))
+	require.Equal(t, echo.MIMETextPlainCharsetUTF8, second.Header().Get(echo.HeaderContentType))
+	// Headers of the original request are not replayed.
+	require.Empty(t, second.Header().Get(echo.HeaderXRequestID))
+	require.Equal(t, "true", second.Header().Get(middleware.HeaderIdempotentReplayed))
+
+	// Keys are scoped by user.
+	other := idempotentRequest(iecho, "key-1", "bob", `{"amount":1}`)
+	require.Equal(t, "order 2", other.Body.String())
+
+	mismatch := idempotentRequest(iecho, "key-1", "alice", `{"amount":2}`)
+	require.Equal(t, http.StatusUnprocessableEntity, mismatch.Code)
+
+	require.Equal(t, int32(2), calls.Load())
+}
+
+func TestIdempotency_InFlight(t *testing.T) {
+	t.Parallel()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	iecho, _ := newIdempotencyServer(context.Background(), t, func(ectx echo.Context) error {
+		close(started)
+		<-release
+
+		return ectx.NoContent(http.StatusCreated)
+	})
+
+	done := make(chan *httptest.ResponseRecorder)
+
+	go func() {
+		done <- idempotentRequest(iecho, "key-1", "alice", "")
+	}()
+
+	<-started
+
+	conflict := idempotentRequest(iecho, "key-1", "alice", "")
+	require.Equal(t, http.StatusConflict, conflict.Code)
+
+	close(release)
+	require.Equal(t, http.StatusCreated, (<-done).Code)
+}
+
+func TestIdempotency_LockExpired(t *testing.T) {
+	t.Parallel()
+
+	var calls atomic.Int32
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	iecho, redis := newIdempotencyServer(context.Background(), t, func(ectx echo.Context) error {
+		n := calls.Add(1)
+		if n == 1 {
+			close(started)
+			<-release
+		}
+
+		return ectx.String(http.StatusCreated, "order "+strconv.Itoa(int(n)))
+	})
+
+	done := make(chan *httptest.ResponseRecorder)
+
+	go func() {
+		done <- idempotentRequest(iecho, "key-1", "alice", "")
+	}()
+
+	<-started
+
+	// The lock of the first request expires, and a retry takes the key over.
+	require.NoError(t, redis.Del(context.Background(), "idempotency:alice:POST:/orders:key-1").Err())
+	require.Equal(t, "order 2", idempotentRequest(iecho, "key-1", "alice", "").Body.String())
+
+	close(release)
+	require.Equal(t, "order 1", (<-done).Body.String())
+
+	// The late first request does not overwrite the stored response of the retry.
+	require.Equal(t, "order 2", idempotentRequest(iecho, "key-1", "alice", "").Body.String())
+	require.Equal(t, int32(2), calls.Load())
+}
+
+func TestIdempotency_ServerErrorNotStored(t *testing.T) {
+	t.Parallel()
+
+	var calls atomic.Int32
+
+	iecho, _ := newIdempotencyServer(context.Background(), t, func(ectx echo.Context) error {
+		if calls.Add(1) == 1 {
+			return echo.NewHTTPError(http.StatusInternalServerError, "boom")
+		}
+
+		return ectx.NoContent(http.StatusCreated)
+	})
+
+	require.Equal(t, http.StatusInternalServerError, idempotentRequest(iecho, "key-1", "alice", "").Code)
+	require.Equal(t, http.StatusCreated, idempotentRequest(iecho, "key-1", "alice", "").Code)
+	require.Equal(t, http.StatusCreated, idempotentRequest(iecho, "key-1", "alice", "").Code)
+	require.Equal(t, int32(2), calls.Load())
+}
+
+func TestIdempotency_WithoutKey(t *testing.T) {
+	t.Parallel()
+
+	ctx, rec, _ := testutil.SetupEchoContext(t, &testutil.Options{
+		Method: http.MethodPost,
+		Path:   "/orders",
+		Body:   nil,
+	})
+
+	// Requests without the header never touch Redis.
+	require.NoError(t, middleware.Idempotency(nil)(echoSuccessHandler)(ctx))
+	require.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestIdempotency_BodyTooLarge(t *testing.T) {
+	t.Parallel()
+
+	ctx, _, req := testutil.SetupEchoContext(t, &testutil.Options{
+		Method: http.MethodPost,
+		Path:   "/orders",
+		Body:   []byte(strings.Repeat("a", 11)),
+	})
+	req.Header.Set(middleware.HeaderIdempotencyKey, "key-1")
+
+	// The body is rejected before Redis is used or the handler runs.
+	err := middleware.IdempotencyWithConfig(middleware.IdempotencyConfig{
+		Skipper:       nil,
+		Redis:         nil,
+		TTL:           0,
+		LockTTL:       0,
+		Methods:       nil,
+		KeyPrefix:     "",
+		ReplayHeaders: nil,
+		MaxBodyBytes:  10,
+	})(func(echo.Context) error {
+		t.Fatalf("Handler should not be called for a body over MaxBodyBytes")
+
+		return nil
+	})(ctx)
+
+	var httpErr *echo.HTTPError
+	require.ErrorAs(t, err, &httpErr)
+	require.Equal(t, http.StatusRequestEntityTooLarge, httpErr.Code)
+}
@@ -0,0 +1,112 @@
+package middleware
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/rs/zerolog/log"
+	"github.com/thienhaole92/uframework/ratelimit"
+)
+
+const (
+	HeaderRateLimitLimit     = "RateLimit-Limit"
+	HeaderRateLimitRemaining = "RateLimit-Remaining"
+	HeaderRateLimitReset     = "RateLimit-Reset"
+	HeaderRateLimitPolicy    = "RateLimit-Policy"
+)
+
+// RateLimitKeyFunc returns the identity a request is counted against.
+type RateLimitKeyFunc func(echo.Context) (string, error)
+
+type RateLimitConfig struct {
+	Skipper middleware.Skipper
+	Limiter ratelimit.Limiter
+	KeyFunc RateLimitKeyFunc // Defaults to RateLimitByIP.
+	// DenyOnError rejects requests when the limiter fails. By default they are let through.
+	DenyOnError bool
+}
+
+// RateLimitByIP counts requests per client IP.
+func RateLimitByIP(ectx echo.Context) (string, error) {
+	return "ip:" + ectx.RealIP(), nil
+}
+
+// RateLimitByUserID counts requests per authenticated user, falling back to the client IP.
+func RateLimitByUserID(ectx echo.Context) (string, error) {
+	if userID := ectx.Get(UserIDContextKey); userID != nil {
+		return fmt.Sprint("user:", userID), nil
+	}
+
+	return RateLimitByIP(ectx)
+}
+
+// RateLimitByRoute counts requests per route, shared by every client.
+func RateLimitByRoute(ectx echo.Context) (string, error) {
+	return "route:" + ectx.Request().Method + ":" + ectx.Path(), nil
+}
+
+func RateLimit(limiter ratelimit.Limiter) echo.MiddlewareFunc {
+	return RateLimitWithConfig(RateLimitConfig{
+		Skipper:     middleware.DefaultSkipper,
+		Limiter:     limiter,
+		KeyFunc:     RateLimitByIP,
+		DenyOnError: false,
+	})
+}
+
+func RateLimitWithConfig(config RateLimitConfig) echo.MiddlewareFunc {
+	if config.Skipper == nil {
+		config.Skipper = middleware.DefaultSkipper
+	}
+
+	if config.KeyFunc == nil {
+		config.KeyFunc = RateLimitByIP
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ectx echo.Context) error {
+			if config.Skipper(ectx) {
+				return next(ectx)
+			}
+
+			key, err := config.KeyFunc(ectx)
+			if err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+			}
+
+			res, err := config.Limiter.Allow(ectx.Request().Context(), key)
+			if err != nil {
+				log.Error().Err(err).Str("key", key).Msg("rate limiter failed")
+
+				if config.DenyOnError {
+					return echo.NewHTTPError(http.StatusServiceUnavailable, "rate limiter unavailable")
+				}
+
+				return next(ectx)
+			}
+
+			header := ectx.Response().Header()
+			header.Set(HeaderRateLimitLimit, strconv.FormatInt(res.Limit, 10))
+			header.Set(HeaderRateLimitRemaining, strconv.FormatInt(res.Remaining, 10))
+			header.Set(HeaderRateLimitReset, strconv.FormatInt(ceilSeconds(res.ResetAfter), 10))
+			header.Set(HeaderRateLimitPolicy, fmt.Sprintf("%d;w=%d", res.Limit, ceilSeconds(res.Window)))
+
+			if !res.Allowed {
+				header.Set(echo.HeaderRetryAfter, strconv.FormatInt(ceilSeconds(res.RetryAfter), 10))
+
+				return echo.NewHTTPError(http.StatusTooManyRequests, "rate limit exceeded")
+			}
+
+			return next(ectx)
+		}
+	}
+}
+
+func ceilSeconds(d time.Duration) int64 {
+	return int64(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,141 @@
+package middleware_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+	"github.com/thienhaole92/uframework/middleware"
+	"github.com/thienhaole92/uframework/ratelimit"
+	"github.com/thienhaole92/uframework/testutil"
+)
+
+type stubLimiter struct {
+	result *ratelimit.Result
+	err    error
+	keys   []string
+}
+
+func (s *stubLimiter) Allow(_ context.Context, key string) (*ratelimit.Result, error) {
+	s.keys = append(s.keys, key)
+
+	return s.result, s.err
+}
+
+func TestRateLimit_Allowed(t *testing.T) {
+	t.Parallel()
+
+	ctx, rec, _ := testutil.SetupEchoContext(t, &testutil.Options{
+		Method: http.MethodGet,
+		Path:   "/test",
+		Body:   nil,
+	})
+	ctx.Set(middleware.UserIDContextKey, "42")
+
+	limiter := &stubLimiter{
+		result: &ratelimit.Result{
+			Allowed:    true,
+			Limit:      10,
+			Remaining:  9,
+			ResetAfter: 1500 * time.Millisecond,
+			RetryAfter: 0,
+			Window:     time.Minute,
+		},
+		err:  nil,
+		keys: nil,
+	}
+
+	mw := middleware.RateLimitWithConfig(middleware.RateLimitConfig{
+		Skipper:     nil,
+		Limiter:     limiter,
+		KeyFunc:     middleware.RateLimitByUserID,
+		DenyOnError: false,
+	})
+
+	require.NoError(t, mw(echoSuccessHandler)(ctx))
+	require.Equal(t, []string{"user:42"}, limiter.keys)
+	require.Equal(t, "10", rec.Header().Get(middleware.HeaderRateLimitLimit))
+	require.Equal(t, "9", rec.Header().Get(middleware.HeaderRateLimitRemaining))
+	require.Equal(t, "2", rec.Header().Get(middleware.HeaderRateLimitReset))
+	require.Equal(t, "10;w=60", rec.Header().Get(middleware.HeaderRateLimitPolicy))
+}
+
+func TestRateLimit_Exceeded(t *testing.T) {
+	t.Parallel()
+
+	ctx, rec, _ := testutil.SetupEchoContext(t, &testutil.Options{
+		Method: http.MethodGet,
+		Path:   "/test",
+		Body:   nil,
+	})
+
+	limiter := &stubLimiter{
+		result: &ratelimit.Result{
+			Allowed:    false,
+			Limit:      10,
+			Remaining:  0,
+			ResetAfter: time.Minute,
+			RetryAfter: 3 * time.Second,
+			Window:     time.Minute,
+		},
+		err:  nil,
+		keys: nil,
+	}
+
+	err := middleware.RateLimit(limiter)(echoSuccessHandler)(ctx)
+
+	var httpErr *echo.HTTPError
+	require.ErrorAs(t, err, &httpErr)
+	require.Equal(t, http.StatusTooManyRequests, httpErr.Code)
+	require.Equal(t, "3", rec.Header().Get(echo.HeaderRetryAfter))
+	require.Equal(t, "0", rec.Header().Get(middleware.HeaderRateLimitRemaining))
+}
+
+func TestRateLimit_LimiterError(t *testing.T) {
+	t.Parallel()
+
+	limiterErr := errors.New("redis down")
+
+	tests := []struct {
+		name        string
+		denyOnError bool
+		expected    int
+	}{
+		{name: "Fail open", denyOnError: false, expected: http.StatusOK},
+		{name: "Fail closed", denyOnError: true, expected: http.StatusServiceUnavailable},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, _, _ := testutil.SetupEchoContext(t, &testutil.Options{
+				Method: http.MethodGet,
+				Path:   "/test",
+				Body:   nil,
+			})
+
+			mw := middleware.RateLimitWithConfig(middleware.RateLimitConfig{
+				Skipper:     nil,
+				Limiter:     &stubLimiter{result: nil, err: limiterErr, keys: nil},
+				KeyFunc:     middleware.RateLimitByRoute,
+				DenyOnError: test.denyOnError,
+			})
+
+			err := mw(echoSuccessHandler)(ctx)
+			if test.expected == http.StatusOK {
+				require.NoError(t, err)
+
+				return
+			}
+
+			var httpErr *echo.HTTPError
+			require.ErrorAs(t, err, &httpErr)
+			require.Equal(t, test.expected, httpErr.Code)
+		})
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	"github.com/thienhaole92/uframework/util"
 )
 
 func RequestID(skipper middleware.Skipper) echo.MiddlewareFunc {
@@ -35,6 +36,7 @@ func RequestID(skipper middleware.Skipper) echo.MiddlewareFunc {
 			}
 
 			ctx.Set(RequestIDContextKey, rid)
+			ctx.SetRequest(req.WithContext(util.ContextWithRequestID(req.Context(), rid)))
 
 			return next(ctx)
 		}
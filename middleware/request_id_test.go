@@ -11,6 +11,7 @@ import (
 	"github.com/stretchr/testify/require"
 	"github.com/thienhaole92/uframework/middleware"
 	"github.com/thienhaole92/uframework/testutil"
+	"github.com/thienhaole92/uframework/util"
 )
 
 func echoSuccessHandler(ctx echo.Context) error {
@@ -95,3 +96,23 @@ func TestRequestIDMiddleware(t *testing.T) {
 		})
 	}
 }
+
+func TestRequestIDMiddleware_RequestContext(t *testing.T) {
+	t.Parallel()
+
+	ctx, _, req := testutil.SetupEchoContext(t, &testutil.Options{
+		Method: http.MethodPost,
+		Path:   "/test",
+		Body:   nil,
+	})
+
+	rid := uuid.New().String()
+	req.Header.Set(echo.HeaderXRequestID, rid)
+
+	err := middleware.RequestID(echomiddleware.DefaultSkipper)(func(ectx echo.Context) error {
+		require.Equal(t, rid, util.RequestIDFromContext(ectx.Request().Context()))
+
+		return nil
+	})(ctx)
+	require.NoError(t, err)
+}
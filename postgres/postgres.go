@@ -12,6 +12,7 @@ import (
 	"github.com/jackc/pgx/v5/tracelog"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
+	"github.com/thienhaole92/uframework/tlsconfig"
 )
 
 type Option struct {
@@ -21,6 +22,7 @@ type Option struct {
 	MaxConnectionIdleTime time.Duration
 	PingTimeout           time.Duration
 	LogLevel              tracelog.LogLevel
+	TLS                   *tlsconfig.Option // Replaces the TLS settings derived from the sslmode of URL.
 }
 
 type Postgres struct {
@@ -46,6 +48,21 @@ func New(ctx context.Context, opts *Option) *Postgres {
 	pgConfig.MinConns = opts.MinConnection
 	pgConfig.MaxConnIdleTime = opts.MaxConnectionIdleTime
 	pgConfig.ConnConfig.Tracer = tracer
+
+	if opts.TLS != nil {
+		tlsConfig, err := tlsconfig.NewClientConfig(opts.TLS)
+		if err != nil {
+			log.Panic().Err(err).Msg("can not build tls config")
+		}
+
+		if tlsConfig.ServerName == "" {
+			tlsConfig.ServerName = pgConfig.ConnConfig.Host
+		}
+
+		pgConfig.ConnConfig.TLSConfig = tlsConfig
+		pgConfig.ConnConfig.Fallbacks = nil
+	}
+
 	pgConfig.AfterConnect = func(_ context.Context, conn *pgx.Conn) error {
 		pgxdecimal.Register(conn.TypeMap())
 
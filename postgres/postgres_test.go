@@ -37,6 +37,7 @@ func TestPostgresConnection(t *testing.T) {
 		MaxConnectionIdleTime: 60 * time.Second,
 		PingTimeout:           10 * time.Second,
 		LogLevel:              tracelog.LogLevelTrace,
+		TLS:                   nil,
 	}
 
 	// Create Postgres instance
@@ -0,0 +1,183 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/thienhaole92/uframework/goredis"
+)
+
+const defaultKeyPrefix = "ratelimit:"
+
+var (
+	ErrInvalidLimit  = errors.New("rate limit must be greater than zero")
+	ErrInvalidWindow = errors.New("rate limit window must be at least one millisecond")
+	ErrUnexpectedRes = errors.New("unexpected rate limit script result")
+)
+
+// Result describes the outcome of a single Allow call.
+type Result struct {
+	Allowed    bool
+	Limit      int64
+	Remaining  int64
+	ResetAfter time.Duration // Time until the quota is fully available again.
+	RetryAfter time.Duration // Time until the next request may be allowed, zero when allowed.
+	Window     time.Duration
+}
+
+// Limiter decides whether a request identified by key may proceed.
+type Limiter interface {
+	Allow(ctx context.Context, key string) (*Result, error)
+}
+
+type Option struct {
+	Limit  int64         // Requests allowed per Window, also the burst size of the token bucket.
+	Window time.Duration // Length of the window, or the time to refill an empty bucket, at least 1ms.
+	Prefix string        // Prefix of the Redis keys, defaults to "ratelimit:".
+}
+
+func (o *Option) validate() error {
+	if o.Limit <= 0 {
+		return ErrInvalidLimit
+	}
+
+	// Windows are sent to Redis in milliseconds, a shorter one would be zero.
+	if o.Window < time.Millisecond {
+		return ErrInvalidWindow
+	}
+
+	if o.Prefix == "" {
+		o.Prefix = defaultKeyPrefix
+	}
+
+	return nil
+}
+
+// A sorted set logs the requests of the last window, scored by their time in milliseconds.
+// Returns allowed, remaining, reset after (ms) and retry after (ms).
+const slidingWindowScript = `
+local now = redis.call("TIME")
+local nowMs = tonumber(now[1]) * 1000 + math.floor(tonumber(now[2]) / 1000)
+local limit = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", nowMs - window)
+local count = redis.call("ZCARD", KEYS[1])
+local allowed = 0
+if count < limit then
+	redis.call("ZADD", KEYS[1], nowMs, ARGV[3])
+	redis.call("PEXPIRE", KEYS[1], window)
+	count = count + 1
+	allowed = 1
+end
+local oldest = redis.call("ZRANGE", KEYS[1], 0, 0, "WITHSCORES")
+local reset = 0
+if oldest[2] then
+	reset = tonumber(oldest[2]) + window - nowMs
+end
+local retry = 0
+if allowed == 0 then
+	retry = reset
+end
+return {allowed, limit - count, reset, retry}
+`
+
+// SlidingWindow allows Limit requests in any rolling Window.
+type SlidingWindow struct {
+	redis  *goredis.Redis
+	opts   Option
+	script *redis.Script
+}
+
+func NewSlidingWindow(rds *goredis.Redis, opts Option) (*SlidingWindow, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+
+	return &SlidingWindow{redis: rds, opts: opts, script: redis.NewScript(slidingWindowScript)}, nil
+}
+
+func (s *SlidingWindow) Allow(ctx context.Context, key string) (*Result, error) {
+	return run(ctx, s.redis, s.script, s.opts, s.opts.Prefix+"sw:"+key, s.opts.Limit, s.opts.Window.Milliseconds(), uuid.NewString())
+}
+
+// The bucket holds up to limit tokens and refills at limit per window. Tokens and the last
+// refill time are kept in a hash. Returns allowed, remaining, reset after (ms) and retry after (ms).
+const tokenBucketScript = `
+local now = redis.call("TIME")
+local nowMs = tonumber(now[1]) * 1000 + math.floor(tonumber(now[2]) / 1000)
+local limit = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local rate = limit / window
+local state = redis.call("HMGET", KEYS[1], "tokens", "ts")
+local tokens = tonumber(state[1])
+local ts = tonumber(state[2])
+if tokens == nil then
+	tokens = limit
+	ts = nowMs
+end
+tokens = math.min(limit, tokens + math.max(0, nowMs - ts) * rate)
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+redis.call("HSET", KEYS[1], "tokens", tostring(tokens), "ts", nowMs)
+redis.call("PEXPIRE", KEYS[1], window)
+local reset = math.ceil((limit - tokens) / rate)
+local retry = 0
+if allowed == 0 then
+	retry = math.ceil((1 - tokens) / rate)
+end
+return {allowed, math.floor(tokens), reset, retry}
+`
+
+// TokenBucket allows bursts of up to Limit requests and refills Limit tokens per Window.
+type TokenBucket struct {
+	redis  *goredis.Redis
+	opts   Option
+	script *redis.Script
+}
+
+func NewTokenBucket(rds *goredis.Redis, opts Option) (*TokenBucket, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+
+	return &TokenBucket{redis: rds, opts: opts, script: redis.NewScript(tokenBucketScript)}, nil
+}
+
+func (t *TokenBucket) Allow(ctx context.Context, key string) (*Result, error) {
+	return run(ctx, t.redis, t.script, t.opts, t.opts.Prefix+"tb:"+key, t.opts.Limit, t.opts.Window.Milliseconds())
+}
+
+func run(
+	ctx context.Context,
+	rds *goredis.Redis,
+	script *redis.Script,
+	opts Option,
+	key string,
+	args ...any,
+) (*Result, error) {
+	values, err := script.Run(ctx, rds, []string{key}, args...).Int64Slice()
+	if err != nil {
+		return nil, err
+	}
+
+	//nolint:mnd
+	if len(values) != 4 {
+		return nil, fmt.Errorf("%w: %v", ErrUnexpectedRes, values)
+	}
+
+	return &Result{
+		Allowed:    values[0] == 1,
+		Limit:      opts.Limit,
+		Remaining:  max(values[1], 0),
+		ResetAfter: time.Duration(values[2]) * time.Millisecond,
+		RetryAfter: time.Duration(values[3]) * time.Millisecond,
+		Window:     opts.Window,
+	}, nil
+}
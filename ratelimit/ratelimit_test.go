@@ -0,0 +1,116 @@
+package ratelimit_test
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/thienhaole92/uframework/goredis"
+	"github.com/thienhaole92/uframework/ratelimit"
+	"github.com/thienhaole92/uframework/testutil"
+)
+
+func newTestRedis(ctx context.Context, t *testing.T) *goredis.Redis {
+	t.Helper()
+
+	container := testutil.SetupRedisContainer(ctx, t)
+
+	port, err := strconv.Atoi(container.Port.Port())
+	require.NoError(t, err)
+
+	return goredis.New(&goredis.Option{
+		Host:             container.Host,
+		Port:             port,
+		Username:         "",
+		Password:         "",
+		DB:               0,
+		TTL:              0,
+		DialTimeout:      5 * time.Second,
+		UseTLS:           false,
+		MaxIdleConns:     5,
+		MinIdleConns:     1,
+		PingTimeout:      2 * time.Second,
+		Mode:             goredis.ModeStandalone,
+		URL:              "",
+		Addrs:            nil,
+		MasterName:       "",
+		SentinelUsername: "",
+		SentinelPassword: "",
+		TLS:              nil,
+	})
+}
+
+func assertLimiter(ctx context.Context, t *testing.T, limiter ratelimit.Limiter) {
+	t.Helper()
+
+	for i := range 3 {
+		res, err := limiter.Allow(ctx, "client")
+		require.NoError(t, err)
+		require.True(t, res.Allowed)
+		require.Equal(t, int64(3), res.Limit)
+		require.Equal(t, int64(2-i), res.Remaining)
+	}
+
+	res, err := limiter.Allow(ctx, "client")
+	require.NoError(t, err)
+	require.False(t, res.Allowed)
+	require.Equal(t, int64(0), res.Remaining)
+	require.Positive(t, res.RetryAfter)
+	require.LessOrEqual(t, res.RetryAfter, time.Second)
+
+	// Other keys have their own quota.
+	res, err = limiter.Allow(ctx, "other")
+	require.NoError(t, err)
+	require.True(t, res.Allowed)
+
+	time.Sleep(time.Second)
+
+	res, err = limiter.Allow(ctx, "client")
+	require.NoError(t, err)
+	require.True(t, res.Allowed)
+}
+
+func TestSlidingWindow(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	limiter, err := ratelimit.NewSlidingWindow(newTestRedis(ctx, t), ratelimit.Option{
+		Limit:  3,
+		Window: time.Second,
+		Prefix: "",
+	})
+	require.NoError(t, err)
+
+	assertLimiter(ctx, t, limiter)
+}
+
+func TestTokenBucket(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	limiter, err := ratelimit.NewTokenBucket(newTestRedis(ctx, t), ratelimit.Option{
+		Limit:  3,
+		Window: time.Second,
+		Prefix: "",
+	})
+	require.NoError(t, err)
+
+	assertLimiter(ctx, t, limiter)
+}
+
+func TestInvalidOption(t *testing.T) {
+	t.Parallel()
+
+	_, err := ratelimit.NewSlidingWindow(nil, ratelimit.Option{Limit: 0, Window: time.Second, Prefix: ""})
+	require.ErrorIs(t, err, ratelimit.ErrInvalidLimit)
+
+	_, err = ratelimit.NewTokenBucket(nil, ratelimit.Option{Limit: 1, Window: 0, Prefix: ""})
+	require.ErrorIs(t, err, ratelimit.ErrInvalidWindow)
+
+	_, err = ratelimit.NewSlidingWindow(nil, ratelimit.Option{Limit: 1, Window: 999 * time.Microsecond, Prefix: ""})
+	require.ErrorIs(t, err, ratelimit.ErrInvalidWindow)
+}
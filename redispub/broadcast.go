@@ -0,0 +1,91 @@
+package redispub
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+var (
+	ErrBroadcastFailed  = errors.New("failed to broadcast messages")
+	ErrInvalidBroadcast = errors.New("invalid broadcast message")
+)
+
+// broadcastMessage is the wire format of messages sent with PUBLISH, the payload is base64 encoded.
+type broadcastMessage struct {
+	UUID     string            `json:"uuid"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	Payload  []byte            `json:"payload"`
+}
+
+// Broadcast sends the messages to every client subscribed to channel with Redis Pub/Sub, such as
+// redissub.BroadcastSubscriber in PubSub mode. Unlike streams nothing is stored, instances that are
+// not connected miss the messages. Headers are added like Publish does.
+func (p *RedisPublisher) Broadcast(ctx context.Context, channel string, messages ...*message.Message) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("%w to channel %s: %w", ErrBroadcastFailed, channel, err)
+	}
+
+	headers := publishHeaders(ctx)
+	cmds := make([]*goredis.IntCmd, 0, len(messages))
+	pipe := p.redisClient.Pipeline()
+
+	for _, msg := range messages {
+		setMissing(msg, headers)
+
+		payload, err := EncodeBroadcast(msg)
+		if err != nil {
+			return fmt.Errorf("%w to channel %s: %w", ErrBroadcastFailed, channel, err)
+		}
+
+		cmds = append(cmds, pipe.Publish(ctx, channel, payload))
+	}
+
+	if pipe.Len() > 0 {
+		// Errors are reported per command below.
+		_, _ = pipe.Exec(ctx)
+	}
+
+	var errs []error
+
+	for i, cmd := range cmds {
+		if err := cmd.Err(); err != nil {
+			errs = append(errs, fmt.Errorf("message %s: %w", messages[i].UUID, err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%w to channel %s: %w", ErrBroadcastFailed, channel, errors.Join(errs...))
+	}
+
+	return nil
+}
+
+// EncodeBroadcast encodes a message, with its metadata, for Redis Pub/Sub.
+func EncodeBroadcast(msg *message.Message) ([]byte, error) {
+	return json.Marshal(broadcastMessage{UUID: msg.UUID, Metadata: msg.Metadata, Payload: msg.Payload})
+}
+
+// DecodeBroadcast decodes a message encoded by EncodeBroadcast.
+func DecodeBroadcast(data []byte) (*message.Message, error) {
+	var wire broadcastMessage
+
+	if err := json.Unmarshal(data, &wire); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidBroadcast, err)
+	}
+
+	if wire.UUID == "" {
+		return nil, fmt.Errorf("%w: missing uuid", ErrInvalidBroadcast)
+	}
+
+	msg := message.NewMessage(wire.UUID, wire.Payload)
+	for key, value := range wire.Metadata {
+		msg.Metadata.Set(key, value)
+	}
+
+	return msg, nil
+}
@@ -0,0 +1,28 @@
+package redispub_test
+
+import (
+	"testing"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/require"
+	"github.com/thienhaole92/uframework/redispub"
+)
+
+func TestEncodeDecodeBroadcast(t *testing.T) {
+	t.Parallel()
+
+	msg := message.NewMessage("id", []byte{0x00, 0xff})
+	msg.Metadata.Set(redispub.MetadataTenant, "acme")
+
+	data, err := redispub.EncodeBroadcast(msg)
+	require.NoError(t, err)
+
+	decoded, err := redispub.DecodeBroadcast(data)
+	require.NoError(t, err)
+	require.Equal(t, "id", decoded.UUID)
+	require.Equal(t, msg.Payload, decoded.Payload)
+	require.Equal(t, "acme", decoded.Metadata.Get(redispub.MetadataTenant))
+
+	_, err = redispub.DecodeBroadcast([]byte(`{"payload":""}`))
+	require.ErrorIs(t, err, redispub.ErrInvalidBroadcast)
+}
@@ -0,0 +1,363 @@
+package redispub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// DefaultDelayedPrefix prefixes the keys of scheduled messages. The hash tag keeps them in one
+	// cluster slot, so the schedule and a message are updated together.
+	DefaultDelayedPrefix = "{redispub:delayed}"
+
+	defaultMoverPollInterval = time.Second
+	defaultMoverBatchSize    = 100
+	defaultMoverRetryDelay   = time.Minute
+
+	// Fields of the hash holding a scheduled message. Stream fields are prefixed to keep them apart.
+	delayedTopicField  = "m:topic"
+	delayedMaxLenField = "m:maxlen"
+	delayedMaxAgeField = "m:maxage"
+	delayedValuePrefix = "f:"
+)
+
+var (
+	ErrScheduleFailed = errors.New("failed to schedule messages")
+	ErrMoveFailed     = errors.New("failed to move due messages")
+	ErrNilRedisClient = errors.New("redis client cannot be nil")
+)
+
+// The schedule is a sorted set of message IDs scored by their due time in milliseconds, each
+// message is a hash holding its topic, trim policy and stream fields. Both keys share the hash tag of
+// the prefix, while streams may live in any cluster slot. A due message is claimed by moving its
+// score ARGV[2] ms ahead, added to its stream, then removed from the schedule. A mover that fails or
+// stops in between leaves the message to be moved again once the claim expires, so it is never lost.
+//
+// claimDueScript claims the message ARGV[1] when due. It returns the claim score and the current time,
+// followed by the fields of the message, or nil when the message is not due or was cancelled.
+const claimDueScript = `
+local now = redis.call("TIME")
+local nowMs = tonumber(now[1]) * 1000 + math.floor(tonumber(now[2]) / 1000)
+local score = redis.call("ZSCORE", KEYS[1], ARGV[1])
+if not score or tonumber(score) > nowMs then
+	return false
+end
+local entry = redis.call("HGETALL", KEYS[2])
+if #entry == 0 then
+	redis.call("ZREM", KEYS[1], ARGV[1])
+	return false
+end
+local claim = nowMs + tonumber(ARGV[2])
+redis.call("ZADD", KEYS[1], claim, ARGV[1])
+table.insert(entry, 1, claim)
+table.insert(entry, 2, nowMs)
+return entry
+`
+
+// removeMovedScript removes the message ARGV[1] moved under the claim score ARGV[2]. A message
+// scheduled again in the meantime has another score and is kept.
+const removeMovedScript = `
+local score = redis.call("ZSCORE", KEYS[1], ARGV[1])
+if score and tonumber(score) == tonumber(ARGV[2]) then
+	redis.call("ZREM", KEYS[1], ARGV[1])
+	redis.call("DEL", KEYS[2])
+end
+return 0
+`
+
+// PublishAfter schedules the messages for delivery to topic once delay has passed.
+func (p *RedisPublisher) PublishAfter(ctx context.Context, topic string, delay time.Duration, messages ...*message.Message) error {
+	return p.PublishAt(ctx, topic, time.Now().Add(delay), messages...)
+}
+
+// PublishAt schedules the messages for delivery to topic at the given time, a DelayedMover using the
+// same prefix adds them to the stream once due. Headers are added like Publish does, the publish time
+// being the due time. Scheduling a message ID again replaces the scheduled message.
+func (p *RedisPublisher) PublishAt(ctx context.Context, topic string, at time.Time, messages ...*message.Message) error {
+	headers := publishHeaders(ctx)
+	headers[MetadataPublishedAt] = strconv.FormatInt(at.UnixMilli(), 10)
+
+	policy := p.policy(topic)
+
+	_, err := p.redisClient.TxPipelined(ctx, func(pipe goredis.Pipeliner) error {
+		for _, msg := range messages {
+			setMissing(msg, headers)
+
+			values, err := p.marshaller.Marshal(topic, msg)
+			if err != nil {
+				return fmt.Errorf("message %s: %w", msg.UUID, err)
+			}
+
+			fields := make([]any, 0, 2*len(values)+6) //nolint:mnd
+			fields = append(fields,
+				delayedTopicField, topic,
+				delayedMaxLenField, policy.MaxLen,
+				delayedMaxAgeField, policy.MaxAge.Milliseconds(),
+			)
+
+			for name, value := range values {
+				fields = append(fields, delayedValuePrefix+name, value)
+			}
+
+			key := p.delayedPrefix + ":message:" + msg.UUID
+
+			pipe.Del(ctx, key)
+			pipe.HSet(ctx, key, fields...)
+			//nolint:exhaustruct
+			pipe.ZAdd(ctx, p.delayedPrefix+":schedule", goredis.Z{Score: float64(at.UnixMilli()), Member: msg.UUID})
+		}
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("%w to topic %s: %w", ErrScheduleFailed, topic, err)
+	}
+
+	return nil
+}
+
+// CancelScheduled removes a scheduled message, and reports false when it was not scheduled, for
+// instance because it has already been delivered.
+func (p *RedisPublisher) CancelScheduled(ctx context.Context, messageID string) (bool, error) {
+	var removed *goredis.IntCmd
+
+	_, err := p.redisClient.TxPipelined(ctx, func(pipe goredis.Pipeliner) error {
+		removed = pipe.ZRem(ctx, p.delayedPrefix+":schedule", messageID)
+		pipe.Del(ctx, p.delayedPrefix+":message:"+messageID)
+
+		return nil
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to cancel scheduled message %s: %w", messageID, err)
+	}
+
+	return removed.Val() > 0, nil
+}
+
+type DelayedMoverOptions struct {
+	// Prefix of the schedule, defaults to DefaultDelayedPrefix. On Redis Cluster it needs a hash tag.
+	Prefix       string
+	PollInterval time.Duration // How often due messages are looked for, defaults to 1s.
+	BatchSize    int           // Due messages fetched at a time, defaults to 100.
+	RetryDelay   time.Duration // Delay before a message that could not be moved is tried again, defaults to 1m.
+}
+
+// DelayedMover adds scheduled messages to their stream once due. It keeps no state, so any number
+// of instances can run it and scheduled messages survive restarts. A mover that stops between adding
+// a message to its stream and removing it from the schedule delivers it again after RetryDelay. It
+// implements runner.AppRunner.
+type DelayedMover struct {
+	redisClient goredis.UniversalClient
+	opts        DelayedMoverOptions
+	claim       *goredis.Script
+	remove      *goredis.Script
+	ctx         context.Context //nolint:containedctx
+	cancel      context.CancelFunc
+	done        sync.WaitGroup
+	stateMux    sync.Mutex // Protects running and the registration of Run
+	running     bool
+}
+
+func NewDelayedMover(redisClient goredis.UniversalClient, opts DelayedMoverOptions) (*DelayedMover, error) {
+	if redisClient == nil {
+		return nil, ErrNilRedisClient
+	}
+
+	if opts.Prefix == "" {
+		opts.Prefix = DefaultDelayedPrefix
+	}
+
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = defaultMoverPollInterval
+	}
+
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultMoverBatchSize
+	}
+
+	if opts.RetryDelay <= 0 {
+		opts.RetryDelay = defaultMoverRetryDelay
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &DelayedMover{
+		redisClient: redisClient,
+		opts:        opts,
+		claim:       goredis.NewScript(claimDueScript),
+		remove:      goredis.NewScript(removeMovedScript),
+		ctx:         ctx,
+		cancel:      cancel,
+		done:        sync.WaitGroup{},
+		stateMux:    sync.Mutex{},
+		running:     false,
+	}, nil
+}
+
+func (m *DelayedMover) Name() string {
+	return "redispub-delayed-mover"
+}
+
+// Run moves due messages every PollInterval until Close is called. It returns right away when the
+// mover already runs or is closed.
+func (m *DelayedMover) Run() {
+	// Registered under the lock so Close either waits for Run or Run never starts.
+	m.stateMux.Lock()
+
+	if m.running || m.ctx.Err() != nil {
+		m.stateMux.Unlock()
+
+		return
+	}
+
+	m.running = true
+	m.done.Add(1)
+	m.stateMux.Unlock()
+
+	defer m.done.Done()
+
+	ticker := time.NewTicker(m.opts.PollInterval)
+	defer ticker.Stop()
+
+	for m.ctx.Err() == nil {
+		if _, err := m.MoveDue(m.ctx); err != nil && m.ctx.Err() == nil {
+			log.Error().Err(err).Msg("Failed to move due messages")
+		}
+
+		select {
+		case <-m.ctx.Done():
+		case <-ticker.C:
+		}
+	}
+}
+
+// MoveDue moves the messages that are due now and returns how many were moved.
+func (m *DelayedMover) MoveDue(ctx context.Context) (int, error) {
+	schedule := m.opts.Prefix + ":schedule"
+	total := 0
+
+	for {
+		ids, err := m.redisClient.ZRangeByScore(ctx, schedule, &goredis.ZRangeBy{
+			Min:    "-inf",
+			Max:    strconv.FormatInt(time.Now().UnixMilli(), 10),
+			Offset: 0,
+			Count:  int64(m.opts.BatchSize),
+		}).Result()
+		if err != nil {
+			return total, fmt.Errorf("%w: %w", ErrMoveFailed, err)
+		}
+
+		moved := 0
+		failures := make([]error, 0)
+
+		for _, id := range ids {
+			ok, err := m.move(ctx, schedule, id)
+			if ok {
+				moved++
+			}
+
+			if err != nil {
+				failures = append(failures, fmt.Errorf("%s: %w", id, err))
+			}
+		}
+
+		total += moved
+
+		if len(failures) > 0 {
+			return total, fmt.Errorf("%w: %w", ErrMoveFailed, errors.Join(failures...))
+		}
+
+		// A full batch means more messages may be due.
+		if len(ids) < m.opts.BatchSize || moved == 0 {
+			return total, nil
+		}
+	}
+}
+
+// move claims the message for RetryDelay, adds it to its stream and removes it from the schedule. It
+// reports false when the message was not due anymore, cancelled, or claimed by another mover.
+func (m *DelayedMover) move(ctx context.Context, schedule, id string) (bool, error) {
+	key := m.opts.Prefix + ":message:" + id
+
+	res, err := m.claim.Run(ctx, m.redisClient, []string{schedule, key}, id, m.opts.RetryDelay.Milliseconds()).Slice()
+	if errors.Is(err, goredis.Nil) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, fmt.Errorf("failed to claim: %w", err)
+	}
+
+	claim, _ := res[0].(int64)
+	now, _ := res[1].(int64)
+
+	// A message without topic is only removed.
+	if args := delayedXAddArgs(res[2:], now); args.Stream != "" {
+		if err := m.redisClient.XAdd(ctx, args).Err(); err != nil {
+			return false, fmt.Errorf("failed to add to stream %s: %w", args.Stream, err)
+		}
+	}
+
+	if err := m.remove.Run(ctx, m.redisClient, []string{schedule, key}, id, claim).Err(); err != nil {
+		return true, fmt.Errorf("failed to remove from schedule: %w", err)
+	}
+
+	return true, nil
+}
+
+// delayedXAddArgs returns the XADD of the scheduled message made of fields, trimmed as of now.
+func delayedXAddArgs(fields []any, now int64) *goredis.XAddArgs {
+	args := &goredis.XAddArgs{
+		Stream:     "",
+		NoMkStream: false,
+		MaxLen:     0,
+		MinID:      "",
+		Approx:     false,
+		Limit:      0,
+		ID:         "",
+		Values:     nil,
+	}
+
+	values := make([]any, 0, len(fields))
+
+	for i := 0; i+1 < len(fields); i += 2 {
+		name, _ := fields[i].(string)
+		value, _ := fields[i+1].(string)
+
+		switch {
+		case name == delayedTopicField:
+			args.Stream = value
+		case name == delayedMaxLenField:
+			args.MaxLen, _ = strconv.ParseInt(value, 10, 64)
+		case name == delayedMaxAgeField:
+			if maxAge, _ := strconv.ParseInt(value, 10, 64); maxAge > 0 {
+				args.MinID = strconv.FormatInt(now-maxAge, 10)
+			}
+		case strings.HasPrefix(name, delayedValuePrefix):
+			values = append(values, strings.TrimPrefix(name, delayedValuePrefix), value)
+		}
+	}
+
+	args.Approx = args.MaxLen > 0 || args.MinID != ""
+	args.Values = values
+
+	return args
+}
+
+// Close stops the mover and waits for the current move to finish.
+func (m *DelayedMover) Close() {
+	m.stateMux.Lock()
+	m.cancel()
+	m.stateMux.Unlock()
+
+	m.done.Wait()
+}
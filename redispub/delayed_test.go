@@ -0,0 +1,128 @@
+package redispub_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill-redisstream/pkg/redisstream"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+	"github.com/thienhaole92/uframework/redispub"
+)
+
+func TestPublishAt(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	rds := newTestRedis(ctx, t)
+
+	publisher, err := redispub.New(rds, redispub.Options{MaxStreamEntries: 0, TopicPolicies: nil, DelayedPrefix: ""})
+	require.NoError(t, err)
+
+	mover, err := redispub.NewDelayedMover(rds, redispub.DelayedMoverOptions{
+		Prefix:       "",
+		PollInterval: time.Second,
+		BatchSize:    1,
+		RetryDelay:   0,
+	})
+	require.NoError(t, err)
+
+	// Payloads are copied byte for byte.
+	due := message.NewMessage("due", []byte{0x00, 0xff})
+	due.Metadata.Set(redispub.MetadataTenant, "acme")
+
+	require.NoError(t, publisher.PublishAt(ctx, "reminders", time.Now().Add(-time.Second),
+		due, message.NewMessage("due-too", []byte("due-too"))))
+	require.NoError(t, publisher.PublishAfter(ctx, "reminders", time.Hour, message.NewMessage("later", []byte("later"))))
+	require.NoError(t, publisher.PublishAfter(ctx, "reminders", time.Hour, message.NewMessage("cancelled", []byte("cancelled"))))
+
+	cancelled, err := publisher.CancelScheduled(ctx, "cancelled")
+	require.NoError(t, err)
+	require.True(t, cancelled)
+
+	// Batches are repeated until no due message is left.
+	moved, err := mover.MoveDue(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 2, moved)
+
+	moved, err = mover.MoveDue(ctx)
+	require.NoError(t, err)
+	require.Zero(t, moved)
+
+	entries, err := rds.XRange(ctx, "reminders", "-", "+").Result()
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+
+	msg, err := redisstream.DefaultMarshallerUnmarshaller{}.Unmarshal(entries[0].Values)
+	require.NoError(t, err)
+	require.Equal(t, "due", msg.UUID)
+	require.Equal(t, []byte{0x00, 0xff}, []byte(msg.Payload))
+	require.Equal(t, "acme", msg.Metadata.Get(redispub.MetadataTenant))
+
+	// Delivered messages cannot be cancelled anymore.
+	cancelled, err = publisher.CancelScheduled(ctx, "due")
+	require.NoError(t, err)
+	require.False(t, cancelled)
+}
+
+func TestDelayedMover_Run(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	rds := newTestRedis(ctx, t)
+
+	publisher, err := redispub.New(rds, redispub.Options{MaxStreamEntries: 0, TopicPolicies: nil, DelayedPrefix: ""})
+	require.NoError(t, err)
+
+	// A key of another type cannot be used as a stream, the message is postponed rather than lost.
+	require.NoError(t, rds.Set(ctx, "broken", "not a stream", 0).Err())
+	require.NoError(t, publisher.PublishAfter(ctx, "broken", 0, message.NewMessage("broken", []byte("broken"))))
+	require.NoError(t, publisher.PublishAfter(ctx, "reminders", 100*time.Millisecond, message.NewMessage("id", []byte("soon"))))
+
+	mover, err := redispub.NewDelayedMover(rds, redispub.DelayedMoverOptions{
+		Prefix:       "",
+		PollInterval: 20 * time.Millisecond,
+		BatchSize:    0,
+		RetryDelay:   time.Hour,
+	})
+	require.NoError(t, err)
+
+	go mover.Run()
+	t.Cleanup(mover.Close)
+
+	require.Eventually(t, func() bool {
+		n, err := rds.XLen(ctx, "reminders").Result()
+
+		return err == nil && n == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	cancelled, err := publisher.CancelScheduled(ctx, "broken")
+	require.NoError(t, err)
+	require.True(t, cancelled)
+}
+
+func TestDelayedMover_CloseBeforeRun(t *testing.T) {
+	t.Parallel()
+
+	//nolint:exhaustruct
+	mover, err := redispub.NewDelayedMover(redis.NewClient(&redis.Options{Addr: "127.0.0.1:0"}), redispub.DelayedMoverOptions{})
+	require.NoError(t, err)
+
+	mover.Close()
+
+	// Run started after Close returns right away instead of running unwaited.
+	done := make(chan struct{})
+
+	go func() {
+		mover.Run()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		require.Fail(t, "Run did not return after Close")
+	}
+}
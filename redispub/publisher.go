@@ -4,55 +4,97 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/ThreeDotsLabs/watermill"
 	"github.com/ThreeDotsLabs/watermill-redisstream/pkg/redisstream"
 	"github.com/ThreeDotsLabs/watermill/message"
 	goredis "github.com/redis/go-redis/v9"
+	"github.com/thienhaole92/uframework/util"
 )
 
 const (
 	defaultPublishTimeout = 5 * time.Second
+
+	// Metadata keys set on published messages.
+	MetadataRequestID   = "request_id"
+	MetadataTraceParent = "traceparent"
+	MetadataTraceState  = "tracestate"
+	MetadataContentType = "content_type"
+	MetadataTenant      = "tenant"
+	// MetadataPublishedAt holds the publish time in Unix milliseconds, consumers use it to measure lag.
+	MetadataPublishedAt = "published_at"
 )
 
+type metadataKey struct{}
+
 var (
 	ErrPublisherInitialization = errors.New("failed to initialize Redis stream publisher")
 	ErrPublishFailed           = errors.New("failed to publish messages")
-	ErrStreamTrimFailed        = errors.New("failed to trim stream")
+	ErrInvalidTrimPolicy       = errors.New("trim policy cannot set both MaxLen and MaxAge")
 )
 
+// TrimPolicy bounds a stream when messages are added. Trimming is approximate, Redis only
+// removes whole macro nodes, which keeps it cheap. At most one of the fields may be set.
+type TrimPolicy struct {
+	MaxLen int64         // Keep about this many entries (XADD MAXLEN ~).
+	MaxAge time.Duration // Drop entries older than this (XADD MINID ~).
+}
+
 type Options struct {
+	// MaxStreamEntries is the MaxLen of topics without a policy in TopicPolicies, zero disables trimming.
 	MaxStreamEntries int64
+	TopicPolicies    map[string]TrimPolicy
+	// DelayedPrefix prefixes the keys of messages scheduled with PublishAt, defaults to DefaultDelayedPrefix.
+	// On Redis Cluster it needs a hash tag, such as the one of the default.
+	DelayedPrefix string
+}
+
+// PublishResult reports the outcome of one message of a batch.
+type PublishResult struct {
+	UUID     string // Watermill UUID of the message.
+	StreamID string // ID of the stream entry, empty when Err is set.
+	Err      error
 }
 
 type RedisPublisher struct {
-	redisStreamPublisher *redisstream.Publisher
-	redisClient          goredis.UniversalClient
-	maxStreamEntries     int64
+	redisClient   goredis.UniversalClient
+	marshaller    redisstream.Marshaller
+	defaultPolicy TrimPolicy
+	topicPolicies map[string]TrimPolicy
+	delayedPrefix string
 }
 
 func New(redisClient goredis.UniversalClient, opts Options) (*RedisPublisher, error) {
-	redisStreamPublisher, err := redisstream.NewPublisher(
-		redisstream.PublisherConfig{
-			Client:        redisClient,
-			Marshaller:    redisstream.DefaultMarshallerUnmarshaller{},
-			Maxlens:       map[string]int64{},
-			DefaultMaxlen: 0,
-		},
-		nil,
-	)
-	if err != nil {
-		return nil, fmt.Errorf("%w: %w", ErrPublisherInitialization, err)
+	if redisClient == nil {
+		return nil, fmt.Errorf("%w: redis client is nil", ErrPublisherInitialization)
+	}
+
+	policies := make(map[string]TrimPolicy, len(opts.TopicPolicies))
+
+	for topic, policy := range opts.TopicPolicies {
+		if policy.MaxLen > 0 && policy.MaxAge > 0 {
+			return nil, fmt.Errorf("%w: %w for topic %s", ErrPublisherInitialization, ErrInvalidTrimPolicy, topic)
+		}
+
+		policies[topic] = policy
+	}
+
+	if opts.DelayedPrefix == "" {
+		opts.DelayedPrefix = DefaultDelayedPrefix
 	}
 
 	return &RedisPublisher{
-		redisStreamPublisher: redisStreamPublisher,
-		redisClient:          redisClient,
-		maxStreamEntries:     opts.MaxStreamEntries,
+		redisClient:   redisClient,
+		marshaller:    redisstream.DefaultMarshallerUnmarshaller{},
+		defaultPolicy: TrimPolicy{MaxLen: opts.MaxStreamEntries, MaxAge: 0},
+		topicPolicies: policies,
+		delayedPrefix: opts.DelayedPrefix,
 	}, nil
 }
 
+// PublishToTopic publishes each content as a message, within a fixed timeout.
 func (p *RedisPublisher) PublishToTopic(topic string, messageContents ...string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), defaultPublishTimeout)
 	defer cancel()
@@ -64,15 +106,156 @@ func (p *RedisPublisher) PublishToTopic(topic string, messageContents ...string)
 		messages = append(messages, msg)
 	}
 
-	if err := p.redisStreamPublisher.Publish(topic, messages...); err != nil {
-		return fmt.Errorf("%w to topic %s: %w", ErrPublishFailed, topic, err)
-	}
+	return p.Publish(ctx, topic, messages...)
+}
 
-	if p.maxStreamEntries > 0 {
-		if err := p.redisClient.XTrimMaxLen(ctx, topic, p.maxStreamEntries).Err(); err != nil {
-			return fmt.Errorf("%w for topic %s: %w", ErrStreamTrimFailed, topic, err)
+// Publish publishes messages with their metadata and fails if any of them could not be published.
+// Headers stored in ctx with ContextWithMetadata, and the request ID of ctx, are added to messages
+// that do not set them.
+func (p *RedisPublisher) Publish(ctx context.Context, topic string, messages ...*message.Message) error {
+	var errs []error
+
+	for _, res := range p.PublishBatch(ctx, topic, messages...) {
+		if res.Err != nil {
+			errs = append(errs, fmt.Errorf("message %s: %w", res.UUID, res.Err))
 		}
 	}
 
+	if len(errs) > 0 {
+		return fmt.Errorf("%w to topic %s: %w", ErrPublishFailed, topic, errors.Join(errs...))
+	}
+
 	return nil
 }
+
+// PublishBatch sends the messages in a single pipeline and reports the outcome of each one, in order.
+// Each XADD trims the stream by the policy of the topic, like watermill's Maxlens does.
+func (p *RedisPublisher) PublishBatch(ctx context.Context, topic string, messages ...*message.Message) []PublishResult {
+	results := make([]PublishResult, len(messages))
+	cmds := make([]*goredis.StringCmd, len(messages))
+	headers := publishHeaders(ctx)
+
+	pipe := p.redisClient.Pipeline()
+
+	for i, msg := range messages {
+		results[i].UUID = msg.UUID
+
+		// The client only honours ctx while waiting for a connection, so a done ctx is checked up front.
+		if err := ctx.Err(); err != nil {
+			results[i].Err = err
+
+			continue
+		}
+
+		setMissing(msg, headers)
+
+		values, err := p.marshaller.Marshal(topic, msg)
+		if err != nil {
+			results[i].Err = err
+
+			continue
+		}
+
+		cmds[i] = pipe.XAdd(ctx, p.xaddArgs(topic, values))
+	}
+
+	if pipe.Len() > 0 {
+		// Errors are reported per command below.
+		_, _ = pipe.Exec(ctx)
+	}
+
+	for i, cmd := range cmds {
+		if cmd == nil {
+			continue
+		}
+
+		results[i].StreamID, results[i].Err = cmd.Result()
+	}
+
+	return results
+}
+
+func (p *RedisPublisher) policy(topic string) TrimPolicy {
+	if policy, ok := p.topicPolicies[topic]; ok {
+		return policy
+	}
+
+	return p.defaultPolicy
+}
+
+func (p *RedisPublisher) xaddArgs(topic string, values map[string]any) *goredis.XAddArgs {
+	policy := p.policy(topic)
+
+	args := &goredis.XAddArgs{
+		Stream:     topic,
+		NoMkStream: false,
+		MaxLen:     policy.MaxLen,
+		MinID:      "",
+		Approx:     policy.MaxLen > 0 || policy.MaxAge > 0,
+		Limit:      0,
+		ID:         "",
+		Values:     values,
+	}
+
+	if policy.MaxAge > 0 {
+		args.MinID = strconv.FormatInt(time.Now().Add(-policy.MaxAge).UnixMilli(), 10)
+	}
+
+	return args
+}
+
+// publishHeaders returns the headers of ctx, with its request ID and the publish time.
+func publishHeaders(ctx context.Context) message.Metadata {
+	headers := MetadataFromContext(ctx)
+
+	if requestID := util.RequestIDFromContext(ctx); requestID != "" {
+		headers[MetadataRequestID] = requestID
+	}
+
+	headers[MetadataPublishedAt] = strconv.FormatInt(time.Now().UnixMilli(), 10)
+
+	return headers
+}
+
+// AddHeaders adds the headers Publish would add, those of ctx, its request ID and the publish time,
+// to the messages that do not set them. It lets other brokers publish the same headers.
+func AddHeaders(ctx context.Context, messages ...*message.Message) {
+	headers := publishHeaders(ctx)
+
+	for _, msg := range messages {
+		setMissing(msg, headers)
+	}
+}
+
+// setMissing sets the headers the message does not set itself.
+func setMissing(msg *message.Message, headers message.Metadata) {
+	for key, value := range headers {
+		if msg.Metadata.Get(key) == "" {
+			msg.Metadata.Set(key, value)
+		}
+	}
+}
+
+// ContextWithMetadata adds headers, such as the tenant or trace context, that Publish sets on
+// every message published with the returned context.
+func ContextWithMetadata(ctx context.Context, metadata message.Metadata) context.Context {
+	merged := MetadataFromContext(ctx)
+	for key, value := range metadata {
+		merged[key] = value
+	}
+
+	return context.WithValue(ctx, metadataKey{}, merged)
+}
+
+// MetadataFromContext returns a copy of the headers stored with ContextWithMetadata.
+func MetadataFromContext(ctx context.Context) message.Metadata {
+	metadata := make(message.Metadata)
+
+	if stored, ok := ctx.Value(metadataKey{}).(message.Metadata); ok {
+		for key, value := range stored {
+			metadata[key] = value
+		}
+	}
+
+	return metadata
+}
@@ -0,0 +1,163 @@
+package redispub_test
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill-redisstream/pkg/redisstream"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+	"github.com/thienhaole92/uframework/goredis"
+	"github.com/thienhaole92/uframework/redispub"
+	"github.com/thienhaole92/uframework/testutil"
+	"github.com/thienhaole92/uframework/util"
+)
+
+func newTestRedis(ctx context.Context, t *testing.T) *goredis.Redis {
+	t.Helper()
+
+	container := testutil.SetupRedisContainer(ctx, t)
+
+	port, err := strconv.Atoi(container.Port.Port())
+	require.NoError(t, err)
+
+	return goredis.New(&goredis.Option{
+		Host:             container.Host,
+		Port:             port,
+		Username:         "",
+		Password:         "",
+		DB:               0,
+		DialTimeout:      5 * time.Second,
+		UseTLS:           false,
+		MaxIdleConns:     5,
+		MinIdleConns:     1,
+		PingTimeout:      2 * time.Second,
+		TTL:              time.Minute,
+		Mode:             goredis.ModeStandalone,
+		URL:              "",
+		Addrs:            nil,
+		MasterName:       "",
+		SentinelUsername: "",
+		SentinelPassword: "",
+		TLS:              nil,
+	})
+}
+
+func TestPublishBatch(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	rds := newTestRedis(ctx, t)
+
+	publisher, err := redispub.New(rds, redispub.Options{MaxStreamEntries: 0, TopicPolicies: nil, DelayedPrefix: ""})
+	require.NoError(t, err)
+
+	// The UUID metadata key is reserved by watermill, so the second message cannot be marshalled.
+	invalid := message.NewMessage("invalid", []byte("invalid"))
+	invalid.Metadata.Set(redisstream.UUIDHeaderKey, "reserved")
+
+	pubCtx := util.ContextWithRequestID(ctx, "request-1")
+	pubCtx = redispub.ContextWithMetadata(pubCtx, message.Metadata{redispub.MetadataTenant: "acme"})
+
+	results := publisher.PublishBatch(pubCtx, "orders",
+		message.NewMessage("first", []byte("first")),
+		invalid,
+		message.NewMessage("third", []byte("third")),
+	)
+	require.Len(t, results, 3)
+	require.NoError(t, results[0].Err)
+	require.NotEmpty(t, results[0].StreamID)
+	require.Error(t, results[1].Err)
+	require.Empty(t, results[1].StreamID)
+	require.NoError(t, results[2].Err)
+	require.Equal(t, "third", results[2].UUID)
+
+	entries, err := rds.XRange(ctx, "orders", "-", "+").Result()
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+
+	msg, err := redisstream.DefaultMarshallerUnmarshaller{}.Unmarshal(entries[0].Values)
+	require.NoError(t, err)
+	require.Equal(t, "request-1", msg.Metadata.Get(redispub.MetadataRequestID))
+	require.Equal(t, "acme", msg.Metadata.Get(redispub.MetadataTenant))
+
+	err = publisher.Publish(ctx, "orders", invalid)
+	require.ErrorIs(t, err, redispub.ErrPublishFailed)
+}
+
+func TestPublish_TopicPolicies(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	rds := newTestRedis(ctx, t)
+
+	publisher, err := redispub.New(rds, redispub.Options{
+		MaxStreamEntries: 0,
+		TopicPolicies: map[string]redispub.TrimPolicy{
+			"bounded": {MaxLen: 10, MaxAge: 0},
+		},
+		DelayedPrefix: "",
+	})
+	require.NoError(t, err)
+
+	for range 10 {
+		contents := make([]string, 100)
+		for i := range contents {
+			contents[i] = strconv.Itoa(i)
+		}
+
+		require.NoError(t, publisher.PublishToTopic("bounded", contents...))
+		require.NoError(t, publisher.PublishToTopic("unbounded", contents...))
+	}
+
+	// Trimming is approximate, whole macro nodes are removed once they are past the limit.
+	bounded, err := rds.XLen(ctx, "bounded").Result()
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, bounded, int64(10))
+	require.Less(t, bounded, int64(1000))
+
+	unbounded, err := rds.XLen(ctx, "unbounded").Result()
+	require.NoError(t, err)
+	require.Equal(t, int64(1000), unbounded)
+}
+
+func TestPublish_Context(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	rds := newTestRedis(ctx, t)
+
+	publisher, err := redispub.New(rds, redispub.Options{MaxStreamEntries: 0, TopicPolicies: nil, DelayedPrefix: ""})
+	require.NoError(t, err)
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+
+	err = publisher.Publish(canceled, "orders", message.NewMessage("id", []byte("order")))
+	require.ErrorIs(t, err, redispub.ErrPublishFailed)
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+func TestNew_InvalidTrimPolicy(t *testing.T) {
+	t.Parallel()
+
+	_, err := redispub.New(nil, redispub.Options{MaxStreamEntries: 0, TopicPolicies: nil, DelayedPrefix: ""})
+	require.ErrorIs(t, err, redispub.ErrPublisherInitialization)
+
+	// No connection is made until a command is sent.
+	//nolint:exhaustruct
+	client := redis.NewClient(&redis.Options{Addr: "localhost:0"})
+	t.Cleanup(func() { _ = client.Close() })
+
+	_, err = redispub.New(client, redispub.Options{
+		MaxStreamEntries: 0,
+		TopicPolicies: map[string]redispub.TrimPolicy{
+			"orders": {MaxLen: 10, MaxAge: time.Hour},
+		},
+		DelayedPrefix: "",
+	})
+	require.ErrorIs(t, err, redispub.ErrInvalidTrimPolicy)
+}
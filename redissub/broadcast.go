@@ -0,0 +1,228 @@
+package redissub
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill-redisstream/pkg/redisstream"
+	"github.com/ThreeDotsLabs/watermill/message"
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+	"github.com/thienhaole92/uframework/redispub"
+)
+
+// BroadcastMode selects how every instance receives every message.
+type BroadcastMode int
+
+const (
+	// BroadcastStream reads the stream without a consumer group, so messages published with
+	// redispub.RedisPublisher.Publish are delivered to every instance. Messages published while an
+	// instance is down are not replayed to it, unless OldestID points before them.
+	BroadcastStream BroadcastMode = iota
+	// BroadcastPubSub subscribes to a Redis Pub/Sub channel, for messages sent with
+	// redispub.RedisPublisher.Broadcast. Nothing is stored, disconnected instances miss messages.
+	BroadcastPubSub
+)
+
+type BroadcastOptions struct {
+	Mode BroadcastMode
+	// Middlewares wrap the message handler, the first one being the outermost. See Chain.
+	Middlewares []Middleware
+	// OldestID is where BroadcastStream starts reading, StartFromLatest by default.
+	OldestID string
+	// BlockTime is how long a BroadcastStream read waits for new messages, defaults to 100ms.
+	BlockTime time.Duration
+}
+
+// BroadcastSubscriber delivers every message of a topic to this instance, for example to invalidate
+// a local cache or push to connected websockets. Delivery is at most once: a message the handler
+// fails is logged and dropped, there are no retries or dead-letter topic.
+type BroadcastSubscriber struct {
+	redisClient    goredis.UniversalClient
+	stream         *redisstream.Subscriber
+	topic          string
+	opts           BroadcastOptions
+	messageHandler MessageHandler
+	ctx            context.Context //nolint:containedctx
+	cancel         context.CancelFunc
+	pubsub         *goredis.PubSub
+	stateMux       sync.Mutex // Protects pubsub and closed
+	closed         bool
+}
+
+func NewBroadcastSubscriber(
+	redisClient goredis.UniversalClient,
+	topic string,
+	messageHandler MessageHandler,
+	opts BroadcastOptions,
+) (*BroadcastSubscriber, error) {
+	if redisClient == nil {
+		return nil, ErrNilRedisClient
+	}
+
+	if topic == "" {
+		return nil, ErrEmptyTopicName
+	}
+
+	if messageHandler == nil {
+		return nil, ErrNilMessageHandler
+	}
+
+	if opts.OldestID == "" {
+		opts.OldestID = StartFromLatest
+	}
+
+	var stream *redisstream.Subscriber
+
+	if opts.Mode == BroadcastStream {
+		var err error
+
+		//nolint:exhaustruct
+		stream, err = redisstream.NewSubscriber(
+			redisstream.SubscriberConfig{
+				Client:         redisClient,
+				Unmarshaller:   poisonTolerantUnmarshaller{Unmarshaller: redisstream.DefaultMarshallerUnmarshaller{}},
+				ConsumerGroup:  "", // Without a group every instance reads every message
+				BlockTime:      opts.BlockTime,
+				FanOutOldestId: opts.OldestID,
+			},
+			nil,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create Redis broadcast subscriber: %w", err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &BroadcastSubscriber{
+		redisClient:    redisClient,
+		stream:         stream,
+		topic:          topic,
+		opts:           opts,
+		messageHandler: Chain(messageHandler, opts.Middlewares...),
+		ctx:            ctx,
+		cancel:         cancel,
+		pubsub:         nil,
+		stateMux:       sync.Mutex{},
+		closed:         false,
+	}, nil
+}
+
+func (s *BroadcastSubscriber) Topic() string {
+	return s.topic
+}
+
+// Start receives messages and blocks until Close is called. It returns an error when the topic
+// cannot be subscribed.
+func (s *BroadcastSubscriber) Start() error {
+	log.Info().Str("topic", s.topic).Msg("Starting broadcast subscription")
+
+	var err error
+
+	if s.opts.Mode == BroadcastPubSub {
+		err = s.receivePubSub()
+	} else {
+		err = s.receiveStream()
+	}
+
+	if err != nil {
+		return fmt.Errorf("%w %s: %w", ErrSubscribeFailed, s.topic, err)
+	}
+
+	log.Info().Str("topic", s.topic).Msg("Broadcast subscription stopped")
+
+	return nil
+}
+
+func (s *BroadcastSubscriber) receiveStream() error {
+	msgChan, err := s.stream.Subscribe(s.ctx, s.topic)
+	if err != nil {
+		return err
+	}
+
+	for msg := range msgChan {
+		if reason := msg.Metadata.Get(MetadataPoison); reason != "" {
+			log.Error().Str("topic", s.topic).Str("message_id", msg.UUID).Str("reason", reason).
+				Msg("Dropping malformed broadcast message")
+		} else {
+			s.handle(msg)
+		}
+
+		ack(msg)
+	}
+
+	return nil
+}
+
+func (s *BroadcastSubscriber) receivePubSub() error {
+	s.stateMux.Lock()
+	if s.closed {
+		s.stateMux.Unlock()
+
+		return nil
+	}
+
+	s.pubsub = s.redisClient.Subscribe(s.ctx, s.topic)
+	pubsub := s.pubsub
+	s.stateMux.Unlock()
+
+	// Waits for the subscription to be confirmed, so errors are returned rather than retried forever.
+	if _, err := pubsub.Receive(s.ctx); err != nil {
+		s.stateMux.Lock()
+		s.pubsub = nil
+		s.stateMux.Unlock()
+
+		_ = pubsub.Close()
+
+		if s.ctx.Err() != nil {
+			return nil
+		}
+
+		return err
+	}
+
+	// The channel is closed by Close, go-redis reconnects and subscribes again on network errors.
+	for payload := range pubsub.Channel() {
+		msg, err := redispub.DecodeBroadcast([]byte(payload.Payload))
+		if err != nil {
+			log.Error().Err(err).Str("topic", s.topic).Msg("Dropping malformed broadcast message")
+
+			continue
+		}
+
+		s.handle(msg)
+	}
+
+	return nil
+}
+
+func (s *BroadcastSubscriber) handle(msg *message.Message) {
+	// Not derived from s.ctx, so Close lets the message being handled finish.
+	if err := s.messageHandler(HandlerContext(context.Background(), s.topic, msg), msg); err != nil {
+		log.Error().Err(err).Str("topic", s.topic).Str("message_id", msg.UUID).Msg("Failed to handle broadcast message")
+	}
+}
+
+// Close stops receiving messages. The redis client is shared, so it is not closed.
+func (s *BroadcastSubscriber) Close() error {
+	s.stateMux.Lock()
+	defer s.stateMux.Unlock()
+
+	if s.closed {
+		return nil
+	}
+
+	s.closed = true
+	s.cancel()
+
+	if s.pubsub != nil {
+		if err := s.pubsub.Close(); err != nil {
+			return fmt.Errorf("failed to close broadcast subscription of topic %s: %w", s.topic, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,100 @@
+package redissub_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/require"
+	"github.com/thienhaole92/uframework/goredis"
+	"github.com/thienhaole92/uframework/redispub"
+	"github.com/thienhaole92/uframework/redissub"
+)
+
+func startBroadcastSubscriber(
+	t *testing.T,
+	rds *goredis.Redis,
+	mode redissub.BroadcastMode,
+	received chan<- string,
+) {
+	t.Helper()
+
+	subscriber, err := redissub.NewBroadcastSubscriber(rds, "cache", func(ctx context.Context, msg *message.Message) error {
+		// Messages sent while waiting for both instances are dropped, so Close never waits on a send.
+		select {
+		case received <- redissub.TopicFromContext(ctx) + "/" + string(msg.Payload) + "/" + msg.Metadata.Get(redispub.MetadataTenant):
+		default:
+		}
+
+		return nil
+	}, redissub.BroadcastOptions{Mode: mode, Middlewares: nil, OldestID: "", BlockTime: 0})
+	require.NoError(t, err)
+
+	started := make(chan error, 1)
+
+	go func() {
+		started <- subscriber.Start()
+	}()
+
+	t.Cleanup(func() {
+		require.NoError(t, subscriber.Close())
+		require.NoError(t, <-started)
+	})
+}
+
+func TestBroadcastSubscriber(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		mode    redissub.BroadcastMode
+		publish func(ctx context.Context, publisher *redispub.RedisPublisher, msg *message.Message) error
+	}{
+		{
+			name: "stream",
+			mode: redissub.BroadcastStream,
+			publish: func(ctx context.Context, publisher *redispub.RedisPublisher, msg *message.Message) error {
+				return publisher.Publish(ctx, "cache", msg)
+			},
+		},
+		{
+			name: "pubsub",
+			mode: redissub.BroadcastPubSub,
+			publish: func(ctx context.Context, publisher *redispub.RedisPublisher, msg *message.Message) error {
+				return publisher.Broadcast(ctx, "cache", msg)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			rds := newTestRedis(ctx, t)
+
+			// Every instance receives every message, unlike subscribers sharing a consumer group.
+			first := make(chan string, 1)
+			second := make(chan string, 1)
+
+			startBroadcastSubscriber(t, rds, tt.mode, first)
+			startBroadcastSubscriber(t, rds, tt.mode, second)
+
+			publisher, err := redispub.New(rds, redispub.Options{MaxStreamEntries: 0})
+			require.NoError(t, err)
+
+			pubCtx := redispub.ContextWithMetadata(ctx, message.Metadata{redispub.MetadataTenant: "acme"})
+
+			// Subscriptions start asynchronously, so messages are sent until both instances got one.
+			require.Eventually(t, func() bool {
+				require.NoError(t, tt.publish(pubCtx, publisher, message.NewMessage("id", []byte("invalidate"))))
+
+				return len(first) == 1 && len(second) == 1
+			}, 5*time.Second, 50*time.Millisecond)
+
+			require.Equal(t, "cache/invalidate/acme", <-first)
+			require.Equal(t, "cache/invalidate/acme", <-second)
+		})
+	}
+}
@@ -0,0 +1,257 @@
+package redissub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"strconv"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/prometheus/client_golang/prometheus"
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog"
+	"github.com/thienhaole92/uframework/metricserver"
+	"github.com/thienhaole92/uframework/redispub"
+	"github.com/thienhaole92/uframework/util"
+)
+
+const (
+	defaultDedupPrefix      = "redissub:dedup:"
+	defaultDedupTTL         = 24 * time.Hour
+	defaultDedupInFlightTTL = defaultMaxIdleTime
+
+	// Values of the dedup keys.
+	dedupInFlight = "in-flight"
+	dedupHandled  = "handled"
+)
+
+var (
+	ErrHandlerPanic   = errors.New("message handler panicked")
+	ErrHandlerTimeout = errors.New("message handler timed out")
+	// ErrMessageInFlight reports a message skipped by Dedup while another delivery of it is handled.
+	// Subscribers redeliver it after RetryPolicy.MaxBackoff without counting a failed delivery.
+	ErrMessageInFlight = errors.New("message is being handled by another delivery")
+)
+
+type topicKey struct{}
+
+// Middleware wraps a MessageHandler, like echo middleware wraps HTTP handlers.
+type Middleware func(next MessageHandler) MessageHandler
+
+// Chain wraps handler with middlewares, the first one being the outermost.
+func Chain(handler MessageHandler, middlewares ...Middleware) MessageHandler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+
+	return handler
+}
+
+// TopicFromContext returns the topic of the message being handled.
+func TopicFromContext(ctx context.Context) string {
+	topic, _ := ctx.Value(topicKey{}).(string)
+
+	return topic
+}
+
+// Recoverer turns a panic in the handler into an error, so the message follows the retry policy.
+func Recoverer() Middleware {
+	return func(next MessageHandler) MessageHandler {
+		return func(ctx context.Context, msg *message.Message) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					err = fmt.Errorf("%w: %v\n%s", ErrHandlerPanic, r, debug.Stack())
+				}
+			}()
+
+			return next(ctx, msg)
+		}
+	}
+}
+
+// Logger logs every handled message with its ID, topic, request ID and duration.
+func Logger(log zerolog.Logger) Middleware {
+	return func(next MessageHandler) MessageHandler {
+		return func(ctx context.Context, msg *message.Message) error {
+			start := time.Now()
+
+			err := next(ctx, msg)
+
+			event := log.Info()
+			if err != nil {
+				event = log.Error().Err(err)
+			}
+
+			event.
+				Str("topic", TopicFromContext(ctx)).
+				Str("message_id", msg.UUID).
+				Str("request_id", util.RequestIDFromContext(ctx)).
+				Str("attempt", msg.Metadata.Get(MetadataDeliveryAttempt)).
+				Str("latency", time.Since(start).String()).
+				Msg("Message handled")
+
+			return err
+		}
+	}
+}
+
+// Metrics records processed and failed messages, handling latency and the lag between publishing
+// and handling. Lag is only known for messages carrying redispub.MetadataPublishedAt.
+func Metrics(reg prometheus.Registerer) (Middleware, error) {
+	if reg == nil {
+		reg = prometheus.DefaultRegisterer
+	}
+
+	//nolint:exhaustruct
+	processed, err := metricserver.Register(reg, prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "redissub_messages_processed_total",
+		Help: "Number of messages handled successfully per topic.",
+	}, []string{"topic"}))
+	if err != nil {
+		return nil, err
+	}
+
+	//nolint:exhaustruct
+	failed, err := metricserver.Register(reg, prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "redissub_messages_failed_total",
+		Help: "Number of failed message deliveries per topic.",
+	}, []string{"topic"}))
+	if err != nil {
+		return nil, err
+	}
+
+	//nolint:exhaustruct
+	latency, err := metricserver.Register(reg, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "redissub_message_processing_seconds",
+		Help:    "Time spent handling a message per topic.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"topic"}))
+	if err != nil {
+		return nil, err
+	}
+
+	//nolint:exhaustruct
+	lag, err := metricserver.Register(reg, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "redissub_message_lag_seconds",
+		Help:    "Time between publishing and handling a message per topic.",
+		Buckets: prometheus.ExponentialBuckets(0.01, 4, 10), //nolint:mnd
+	}, []string{"topic"}))
+	if err != nil {
+		return nil, err
+	}
+
+	return func(next MessageHandler) MessageHandler {
+		return func(ctx context.Context, msg *message.Message) error {
+			topic := TopicFromContext(ctx)
+			start := time.Now()
+
+			if publishedAt, err := strconv.ParseInt(msg.Metadata.Get(redispub.MetadataPublishedAt), 10, 64); err == nil {
+				lag.WithLabelValues(topic).Observe(start.Sub(time.UnixMilli(publishedAt)).Seconds())
+			}
+
+			err := next(ctx, msg)
+
+			latency.WithLabelValues(topic).Observe(time.Since(start).Seconds())
+
+			if err != nil {
+				failed.WithLabelValues(topic).Inc()
+			} else {
+				processed.WithLabelValues(topic).Inc()
+			}
+
+			return err
+		}
+	}, nil
+}
+
+// Timeout bounds the time a handler may spend on a message. The handler must honour its context.
+func Timeout(timeout time.Duration) Middleware {
+	return func(next MessageHandler) MessageHandler {
+		return func(ctx context.Context, msg *message.Message) error {
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			err := next(ctx, msg)
+			if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return fmt.Errorf("%w after %s: %w", ErrHandlerTimeout, timeout, err)
+			}
+
+			return err
+		}
+	}
+}
+
+type DedupOption struct {
+	TTL time.Duration // How long a handled message ID is remembered, defaults to 24h.
+	// InFlightTTL is how long a message being handled keeps its ID claimed, defaults to 60s. It
+	// should be at least the MaxIdleTime of the subscriber, so a message claimed by another
+	// consumer while still being handled is not handled twice.
+	InFlightTTL time.Duration
+	Prefix      string // Prefix of the Redis keys, defaults to "redissub:dedup:".
+}
+
+// Dedup skips messages whose ID was already handled within TTL, such as a message published twice
+// by a retrying producer. The ID is claimed for InFlightTTL before the handler runs, remembered for
+// TTL once it succeeds and released when it fails, so redeliveries of a failed message are still
+// handled. A message whose ID is claimed by a handler still running fails with ErrMessageInFlight
+// and waits for the outcome, without using its deliveries. The claim of a handler that crashed
+// expires after InFlightTTL.
+func Dedup(client goredis.UniversalClient, opts DedupOption) Middleware {
+	if opts.TTL <= 0 {
+		opts.TTL = defaultDedupTTL
+	}
+
+	if opts.InFlightTTL <= 0 {
+		opts.InFlightTTL = defaultDedupInFlightTTL
+	}
+
+	if opts.Prefix == "" {
+		opts.Prefix = defaultDedupPrefix
+	}
+
+	return func(next MessageHandler) MessageHandler {
+		return func(ctx context.Context, msg *message.Message) error {
+			key := opts.Prefix + TopicFromContext(ctx) + ":" + msg.UUID
+
+			claimed, err := client.SetNX(ctx, key, dedupInFlight, opts.InFlightTTL).Result()
+			if err != nil {
+				return fmt.Errorf("failed to check message %s for duplicates: %w", msg.UUID, err)
+			}
+
+			if !claimed {
+				return dedupClaimed(ctx, client, key, msg.UUID)
+			}
+
+			if err := next(ctx, msg); err != nil {
+				if delErr := client.Del(context.WithoutCancel(ctx), key).Err(); delErr != nil {
+					return errors.Join(err, delErr)
+				}
+
+				return err
+			}
+
+			if err := client.Set(context.WithoutCancel(ctx), key, dedupHandled, opts.TTL).Err(); err != nil {
+				return fmt.Errorf("failed to remember message %s as handled: %w", msg.UUID, err)
+			}
+
+			return nil
+		}
+	}
+}
+
+// dedupClaimed returns nil when the message was already handled, or ErrMessageInFlight when it
+// is still being handled, or was until the claim just expired.
+func dedupClaimed(ctx context.Context, client goredis.UniversalClient, key, id string) error {
+	state, err := client.Get(ctx, key).Result()
+	if err != nil && !errors.Is(err, goredis.Nil) {
+		return fmt.Errorf("failed to check message %s for duplicates: %w", id, err)
+	}
+
+	if state == dedupHandled {
+		return nil
+	}
+
+	return fmt.Errorf("%w: %s", ErrMessageInFlight, id)
+}
@@ -0,0 +1,228 @@
+package redissub_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/prometheus/client_golang/prometheus"
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"github.com/thienhaole92/uframework/redispub"
+	"github.com/thienhaole92/uframework/redissub"
+)
+
+func TestChain_Order(t *testing.T) {
+	t.Parallel()
+
+	var calls []string
+
+	trace := func(name string) redissub.Middleware {
+		return func(next redissub.MessageHandler) redissub.MessageHandler {
+			return func(ctx context.Context, msg *message.Message) error {
+				calls = append(calls, name)
+
+				return next(ctx, msg)
+			}
+		}
+	}
+
+	handler := redissub.Chain(func(context.Context, *message.Message) error {
+		calls = append(calls, "handler")
+
+		return nil
+	}, trace("first"), trace("second"))
+
+	require.NoError(t, handler(context.Background(), message.NewMessage("id", nil)))
+	require.Equal(t, []string{"first", "second", "handler"}, calls)
+}
+
+func TestRecoverer(t *testing.T) {
+	t.Parallel()
+
+	handler := redissub.Chain(func(context.Context, *message.Message) error {
+		panic("boom")
+	}, redissub.Recoverer())
+
+	err := handler(context.Background(), message.NewMessage("id", nil))
+	require.ErrorIs(t, err, redissub.ErrHandlerPanic)
+	require.ErrorContains(t, err, "boom")
+}
+
+func TestTimeout(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		err     error
+	}{
+		{name: "expired", timeout: 10 * time.Millisecond, err: redissub.ErrHandlerTimeout},
+		{name: "in time", timeout: time.Second, err: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			handler := redissub.Chain(func(ctx context.Context, _ *message.Message) error {
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-time.After(100 * time.Millisecond):
+					return nil
+				}
+			}, redissub.Timeout(tt.timeout))
+
+			err := handler(context.Background(), message.NewMessage("id", nil))
+			if tt.err == nil {
+				require.NoError(t, err)
+			} else {
+				require.ErrorIs(t, err, tt.err)
+				require.ErrorIs(t, err, context.DeadlineExceeded)
+			}
+		})
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	t.Parallel()
+
+	reg := prometheus.NewRegistry()
+
+	metrics, err := redissub.Metrics(reg)
+	require.NoError(t, err)
+
+	// Registering again reuses the collectors.
+	_, err = redissub.Metrics(reg)
+	require.NoError(t, err)
+
+	handler := redissub.Chain(func(_ context.Context, msg *message.Message) error {
+		if string(msg.Payload) == "fail" {
+			return errHandler
+		}
+
+		return nil
+	}, metrics)
+
+	published := message.NewMessage("id", []byte("ok"))
+	published.Metadata.Set(redispub.MetadataPublishedAt, "1")
+
+	require.NoError(t, handler(context.Background(), published))
+	require.ErrorIs(t, handler(context.Background(), message.NewMessage("id", []byte("fail"))), errHandler)
+
+	count, err := promtestutil.GatherAndCount(reg,
+		"redissub_messages_processed_total",
+		"redissub_messages_failed_total",
+		"redissub_message_processing_seconds",
+		"redissub_message_lag_seconds",
+	)
+	require.NoError(t, err)
+	require.Equal(t, 4, count)
+}
+
+func TestSubscriber_Middlewares(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	rds := newTestRedis(ctx, t)
+
+	received := make(chan string, 2)
+
+	opts := testOptions()
+	opts.Middlewares = []redissub.Middleware{
+		redissub.Recoverer(),
+		redissub.Dedup(rds, redissub.DedupOption{TTL: time.Minute, InFlightTTL: 0, Prefix: ""}),
+	}
+
+	startSubscriber(t, rds, "orders", func(ctx context.Context, msg *message.Message) error {
+		received <- redissub.TopicFromContext(ctx) + "/" + msg.UUID
+
+		return nil
+	}, opts)
+
+	publisher, err := redispub.New(rds, redispub.Options{MaxStreamEntries: 0})
+	require.NoError(t, err)
+
+	// A producer retrying a publish sends the same message twice.
+	msg := message.NewMessage("order-1", []byte("order"))
+	require.NoError(t, publisher.Publish(ctx, "orders", msg, msg))
+
+	select {
+	case value := <-received:
+		require.Equal(t, "orders/order-1", value)
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "message not received")
+	}
+
+	require.Never(t, func() bool { return len(received) > 0 }, 500*time.Millisecond, 50*time.Millisecond)
+}
+
+func TestDedup_InFlight(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	rds := newTestRedis(ctx, t)
+
+	handled := 0
+	handler := redissub.Chain(func(context.Context, *message.Message) error {
+		handled++
+
+		return nil
+	}, redissub.Dedup(rds, redissub.DedupOption{TTL: time.Minute, InFlightTTL: time.Second, Prefix: "dedup:"}))
+
+	// A consumer crashed while handling the message, leaving its claim behind.
+	require.NoError(t, rds.Set(ctx, "dedup::order-1", "in-flight", time.Second).Err())
+
+	msg := message.NewMessage("order-1", nil)
+	require.ErrorIs(t, handler(ctx, msg), redissub.ErrMessageInFlight)
+	require.Equal(t, 0, handled)
+
+	// The claim expires, so the redelivery is handled, and only once.
+	require.Eventually(t, func() bool { return handler(ctx, msg) == nil }, 5*time.Second, 100*time.Millisecond)
+	require.NoError(t, handler(ctx, msg))
+	require.Equal(t, 1, handled)
+
+	ttl, err := rds.TTL(ctx, "dedup::order-1").Result()
+	require.NoError(t, err)
+	require.Greater(t, ttl, 50*time.Second)
+}
+
+func TestDedup_DuplicateNotDeadLettered(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	rds := newTestRedis(ctx, t)
+
+	var calls atomic.Int32
+
+	opts := testOptions()
+	opts.Concurrency = 2
+	opts.Middlewares = []redissub.Middleware{
+		redissub.Dedup(rds, redissub.DedupOption{TTL: time.Minute, InFlightTTL: time.Minute, Prefix: "dedup:"}),
+	}
+
+	// The first delivery outlasts every retry of the duplicate.
+	startSubscriber(t, rds, "orders", func(context.Context, *message.Message) error {
+		calls.Add(1)
+		time.Sleep(time.Second)
+
+		return nil
+	}, opts)
+
+	publisher, err := redispub.New(rds, redispub.Options{MaxStreamEntries: 0, TopicPolicies: nil, DelayedPrefix: ""})
+	require.NoError(t, err)
+	require.NoError(t, publisher.Publish(ctx, "orders",
+		message.NewMessage("order-1", []byte("order")), message.NewMessage("order-1", []byte("order"))))
+
+	require.Eventually(t, func() bool {
+		pending, err := rds.XPending(ctx, "orders", "group").Result()
+
+		return err == nil && pending.Count == 0 && calls.Load() == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	require.Empty(t, deadLetters(ctx, t, rds, "orders.dlq"))
+	require.Equal(t, int32(1), calls.Load())
+}
@@ -1,35 +1,92 @@
 package redissub
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	goredis "github.com/redis/go-redis/v9"
 	"github.com/thienhaole92/uframework/notifylog"
 )
 
+const (
+	scanCount        = 100
+	errorChannelSize = 64
+)
+
 var (
 	ErrEmptyTopic         = errors.New("topic cannot be empty")
+	ErrEmptyPattern       = errors.New("pattern cannot be empty")
 	ErrSubscriberCreation = errors.New("failed to create subscriber")
 	ErrClosingSubcribers  = errors.New("errors while closing subscribers")
+	ErrAlreadySubscribed  = errors.New("already subscribed")
+	ErrNotSubscribed      = errors.New("not subscribed")
+	ErrTopicScan          = errors.New("failed to scan topics")
+	ErrSubscriberClosed   = errors.New("multi subscriber is closed")
+	ErrUnhealthy          = errors.New("subscriptions keep failing")
 )
 
+// SubscriptionInfo describes a subscription and the state of its consumer group.
+type SubscriptionInfo struct {
+	Topic         string
+	ConsumerGroup string
+	Consumer      string
+	Pattern       string // Pattern that added the topic, empty when subscribed directly.
+	Consumers     int64  // Consumers in the group, including other instances.
+	Pending       int64  // Messages delivered to the group but not acknowledged yet.
+	Lag           int64  // Messages not delivered to the group yet, zero when Redis cannot tell.
+}
+
+// SubscriptionError reports a subscription that failed and will be restarted.
+type SubscriptionError struct {
+	Topic    string
+	Err      error
+	Failures int // Consecutive failures, including this one.
+}
+
+type subscription struct {
+	subscriber *Subscriber
+	pattern    string
+	stopped    chan struct{} // Closed when the subscriber stopped
+	failures   atomic.Int64  // Consecutive failures
+}
+
+type patternWatch struct {
+	handler MessageHandler
+	stop    chan struct{}
+}
+
 type MultiSubscriber struct {
 	redisClient    goredis.UniversalClient
 	consumerGroup  string
-	subscribers    []*Subscriber
+	opts           Options // Applied to every subscription
+	subscriptions  map[string]*subscription
+	patterns       map[string]*patternWatch
+	errs           chan SubscriptionError
+	closed         bool
 	logger         notifylog.NotifyLog
-	waitGroup      sync.WaitGroup // WaitGroup to wait for all subscribers to stop
-	subscribersMux sync.Mutex     // Mutex to protect the subscribers slice
+	waitGroup      sync.WaitGroup // WaitGroup to wait for all subscribers and pattern watchers to stop
+	subscribersMux sync.Mutex     // Mutex to protect subscriptions and patterns
 }
 
-func NewMultiSubscriber(redisClient goredis.UniversalClient, consumerGroup string) *MultiSubscriber {
+// NewMultiSubscriber creates subscribers of a consumer group. A subscription that fails is restarted
+// with backoff according to opts.Restart, and reported on Errors and by Healthy.
+func NewMultiSubscriber(redisClient goredis.UniversalClient, consumerGroup string, opts Options) *MultiSubscriber {
+	opts.Restart.setDefaults()
+
 	return &MultiSubscriber{
 		redisClient:    redisClient,
 		consumerGroup:  consumerGroup,
-		subscribers:    make([]*Subscriber, 0),
+		opts:           opts,
+		subscriptions:  make(map[string]*subscription),
+		patterns:       make(map[string]*patternWatch),
+		errs:           make(chan SubscriptionError, errorChannelSize),
+		closed:         false,
 		logger:         notifylog.New("multisub", notifylog.JSON),
 		waitGroup:      sync.WaitGroup{},
 		subscribersMux: sync.Mutex{},
@@ -45,37 +102,354 @@ func (m *MultiSubscriber) Subscribe(topic string, messageHandler MessageHandler)
 		return ErrNilMessageHandler
 	}
 
-	subscriber, err := NewSubscriber(m.redisClient, m.consumerGroup, topic, messageHandler)
+	m.subscribersMux.Lock()
+	defer m.subscribersMux.Unlock()
+
+	return m.subscribe(topic, "", messageHandler)
+}
+
+// subscribe starts a subscriber of topic, the caller must hold subscribersMux.
+func (m *MultiSubscriber) subscribe(topic, pattern string, messageHandler MessageHandler) error {
+	if m.closed {
+		return ErrSubscriberClosed
+	}
+
+	if _, ok := m.subscriptions[topic]; ok {
+		return fmt.Errorf("%w to topic %s", ErrAlreadySubscribed, topic)
+	}
+
+	subscriber, err := NewSubscriber(m.redisClient, m.consumerGroup, topic, messageHandler, m.opts)
 	if err != nil {
 		return fmt.Errorf("%w for topic %s: %w", ErrSubscriberCreation, topic, err)
 	}
 
+	sub := &subscription{
+		subscriber: subscriber,
+		pattern:    pattern,
+		stopped:    make(chan struct{}),
+		failures:   atomic.Int64{},
+	}
+	m.subscriptions[topic] = sub
+
+	m.waitGroup.Add(1)
+
+	go func() {
+		defer m.waitGroup.Done()
+		defer close(sub.stopped)
+		m.supervise(sub)
+	}()
+
+	m.logger.Info().Str("topic", topic).Str("pattern", pattern).Msg("Successfully subscribed to topic")
+
+	return nil
+}
+
+// supervise runs the subscriber until it is closed, restarting it with backoff when it fails.
+func (m *MultiSubscriber) supervise(sub *subscription) {
+	subscriber := sub.subscriber
+
+	for {
+		began := time.Now()
+
+		stop, err := subscriber.start()
+		if err == nil {
+			err = subscriber.wait(stop)
+			if err == nil {
+				return
+			}
+		}
+
+		if time.Since(began) >= m.opts.Restart.MaxBackoff {
+			sub.failures.Store(0)
+		}
+
+		failures := int(sub.failures.Add(1))
+		delay := m.opts.Restart.backoff(failures)
+
+		m.logger.Error().Err(err).Str("topic", subscriber.Topic()).Int("failures", failures).
+			Dur("retry_in", delay).Msg("Subscription failed, restarting")
+
+		// Reported without blocking, a full channel means nobody keeps up with the errors.
+		select {
+		case m.errs <- SubscriptionError{Topic: subscriber.Topic(), Err: err, Failures: failures}:
+		default:
+		}
+
+		select {
+		case <-subscriber.shutdownSignal:
+			return
+		case <-time.After(delay):
+		}
+	}
+}
+
+// Errors reports subscriptions that failed. Errors are dropped while the channel is full, and the
+// channel is closed by Close.
+func (m *MultiSubscriber) Errors() <-chan SubscriptionError {
+	return m.errs
+}
+
+// Healthy returns an error naming the subscriptions that failed UnhealthyAfter times in a row,
+// it can be registered with runner.WithHealthCheck.
+func (m *MultiSubscriber) Healthy() error {
 	m.subscribersMux.Lock()
-	m.subscribers = append(m.subscribers, subscriber)
+	defer m.subscribersMux.Unlock()
+
+	var failing []string
+
+	for topic, sub := range m.subscriptions {
+		if sub.failures.Load() >= int64(m.opts.Restart.UnhealthyAfter) {
+			failing = append(failing, topic)
+		}
+	}
+
+	if len(failing) > 0 {
+		slices.Sort(failing)
+
+		return fmt.Errorf("%w: %s", ErrUnhealthy, strings.Join(failing, ", "))
+	}
+
+	return nil
+}
+
+// Unsubscribe stops the subscription of topic, waiting for its in-flight messages like Close does.
+// The consumer group is kept, so subscribing again resumes where it stopped. A message read while
+// stopping stays pending and is claimed once it has been idle for MaxIdleTime. A topic added by a
+// pattern is subscribed again on its next refresh, use UnsubscribePattern to stop all of them.
+func (m *MultiSubscriber) Unsubscribe(topic string) error {
+	m.subscribersMux.Lock()
+
+	sub, ok := m.subscriptions[topic]
+	if !ok {
+		m.subscribersMux.Unlock()
+
+		return fmt.Errorf("%w to topic %s", ErrNotSubscribed, topic)
+	}
+
+	delete(m.subscriptions, topic)
 	m.subscribersMux.Unlock()
 
+	return m.stop(sub)
+}
+
+func (m *MultiSubscriber) stop(sub *subscription) error {
+	if err := sub.subscriber.Close(); err != nil {
+		return fmt.Errorf("failed to close subscriber of topic %s: %w", sub.subscriber.Topic(), err)
+	}
+
+	<-sub.stopped
+
+	m.logger.Info().Str("topic", sub.subscriber.Topic()).Msg("Unsubscribed from topic")
+
+	return nil
+}
+
+// SubscribePattern subscribes to every stream matching pattern, such as "orders:*" for per-tenant
+// streams. The pattern uses the glob syntax of SCAN and is checked again every PatternRefreshInterval,
+// so streams created later are subscribed too. Dead-letter topics are never matched.
+func (m *MultiSubscriber) SubscribePattern(ctx context.Context, pattern string, messageHandler MessageHandler) error {
+	if pattern == "" {
+		return ErrEmptyPattern
+	}
+
+	if messageHandler == nil {
+		return ErrNilMessageHandler
+	}
+
+	watch := &patternWatch{handler: messageHandler, stop: make(chan struct{})}
+
+	m.subscribersMux.Lock()
+	if m.closed {
+		m.subscribersMux.Unlock()
+
+		return ErrSubscriberClosed
+	}
+
+	if _, ok := m.patterns[pattern]; ok {
+		m.subscribersMux.Unlock()
+
+		return fmt.Errorf("%w to pattern %s", ErrAlreadySubscribed, pattern)
+	}
+
+	m.patterns[pattern] = watch
+	// Added under the lock so Close waits for the watcher.
 	m.waitGroup.Add(1)
+	m.subscribersMux.Unlock()
+
+	if err := m.refreshPattern(ctx, pattern, watch); err != nil {
+		m.waitGroup.Done()
+
+		m.subscribersMux.Lock()
+		delete(m.patterns, pattern)
+		m.subscribersMux.Unlock()
+
+		return errors.Join(err, m.unsubscribePatternTopics(pattern))
+	}
 
 	go func() {
 		defer m.waitGroup.Done()
-		subscriber.Start()
+		m.watchPattern(pattern, watch)
 	}()
 
-	m.logger.Info().Str("topic", topic).Msg("Successfully subscribed to topic")
-
 	return nil
 }
 
+// UnsubscribePattern stops looking for streams matching pattern and unsubscribes the topics it added.
+func (m *MultiSubscriber) UnsubscribePattern(pattern string) error {
+	m.subscribersMux.Lock()
+
+	watch, ok := m.patterns[pattern]
+	if !ok {
+		m.subscribersMux.Unlock()
+
+		return fmt.Errorf("%w to pattern %s", ErrNotSubscribed, pattern)
+	}
+
+	delete(m.patterns, pattern)
+	close(watch.stop)
+	m.subscribersMux.Unlock()
+
+	return m.unsubscribePatternTopics(pattern)
+}
+
+func (m *MultiSubscriber) unsubscribePatternTopics(pattern string) error {
+	m.subscribersMux.Lock()
+
+	var subs []*subscription
+
+	for topic, sub := range m.subscriptions {
+		if sub.pattern == pattern {
+			subs = append(subs, sub)
+			delete(m.subscriptions, topic)
+		}
+	}
+	m.subscribersMux.Unlock()
+
+	var errs []error
+
+	for _, sub := range subs {
+		if err := m.stop(sub); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (m *MultiSubscriber) watchPattern(pattern string, watch *patternWatch) {
+	ticker := time.NewTicker(m.opts.patternRefreshInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-watch.stop:
+			return
+		case <-ticker.C:
+			if err := m.refreshPattern(context.Background(), pattern, watch); err != nil {
+				m.logger.Error().Err(err).Str("pattern", pattern).Msg("Failed to refresh pattern subscription")
+			}
+		}
+	}
+}
+
+// refreshPattern subscribes to the streams matching pattern that are not subscribed yet.
+func (m *MultiSubscriber) refreshPattern(ctx context.Context, pattern string, watch *patternWatch) error {
+	topics, err := scanStreams(ctx, m.redisClient, pattern)
+	if err != nil {
+		return fmt.Errorf("%w matching %s: %w", ErrTopicScan, pattern, err)
+	}
+
+	m.subscribersMux.Lock()
+	defer m.subscribersMux.Unlock()
+
+	// The pattern may have been unsubscribed while scanning.
+	if m.patterns[pattern] != watch {
+		return nil
+	}
+
+	var errs []error
+
+	for _, topic := range topics {
+		if _, ok := m.subscriptions[topic]; ok || m.isDeadLetterTopic(topic) {
+			continue
+		}
+
+		if err := m.subscribe(topic, pattern, watch.handler); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (m *MultiSubscriber) isDeadLetterTopic(topic string) bool {
+	if m.opts.DeadLetterTopic != "" {
+		return topic == m.opts.DeadLetterTopic
+	}
+
+	return strings.HasSuffix(topic, defaultDeadLetterSuffix)
+}
+
+// List describes the active subscriptions, ordered by topic.
+func (m *MultiSubscriber) List(ctx context.Context) ([]SubscriptionInfo, error) {
+	m.subscribersMux.Lock()
+
+	subs := make([]*subscription, 0, len(m.subscriptions))
+	for _, sub := range m.subscriptions {
+		subs = append(subs, sub)
+	}
+	m.subscribersMux.Unlock()
+
+	slices.SortFunc(subs, func(a, b *subscription) int {
+		return strings.Compare(a.subscriber.Topic(), b.subscriber.Topic())
+	})
+
+	infos := make([]SubscriptionInfo, 0, len(subs))
+
+	for _, sub := range subs {
+		info, err := sub.subscriber.Info(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		info.Pattern = sub.pattern
+		infos = append(infos, info)
+	}
+
+	return infos, nil
+}
+
 func (m *MultiSubscriber) Close() error {
 	m.logger.Info().Msg("Initiating shutdown of all subscribers")
 
 	// Collect errors during closing
 	var errorMessages []string
 
+	// The lock is released before waiting, pattern watchers take it while refreshing.
 	m.subscribersMux.Lock()
-	defer m.subscribersMux.Unlock()
 
-	for _, subscriber := range m.subscribers {
+	if m.closed {
+		m.subscribersMux.Unlock()
+
+		return nil
+	}
+
+	m.closed = true
+
+	for pattern, watch := range m.patterns {
+		close(watch.stop)
+		delete(m.patterns, pattern)
+	}
+
+	subs := make([]*subscription, 0, len(m.subscriptions))
+	for topic, sub := range m.subscriptions {
+		subs = append(subs, sub)
+		delete(m.subscriptions, topic)
+	}
+	m.subscribersMux.Unlock()
+
+	for _, sub := range subs {
+		subscriber := sub.subscriber
 		if err := subscriber.Close(); err != nil {
 			errorMessages = append(
 				errorMessages,
@@ -90,6 +464,7 @@ func (m *MultiSubscriber) Close() error {
 
 	// Wait for all subscribers to stop
 	m.waitGroup.Wait()
+	close(m.errs)
 
 	if len(errorMessages) > 0 {
 		return fmt.Errorf("%w: %s", ErrClosingSubcribers, strings.Join(errorMessages, ", "))
@@ -99,3 +474,48 @@ func (m *MultiSubscriber) Close() error {
 
 	return nil
 }
+
+// scanStreams returns the streams matching pattern. Every master is scanned on a cluster.
+func scanStreams(ctx context.Context, client goredis.UniversalClient, pattern string) ([]string, error) {
+	if wrapper, ok := client.(interface {
+		Unwrap() goredis.UniversalClient
+	}); ok {
+		client = wrapper.Unwrap()
+	}
+
+	cluster, ok := client.(*goredis.ClusterClient)
+	if !ok {
+		return scanNode(ctx, client, pattern)
+	}
+
+	var (
+		mux    sync.Mutex
+		topics []string
+	)
+
+	err := cluster.ForEachMaster(ctx, func(ctx context.Context, node *goredis.Client) error {
+		found, err := scanNode(ctx, node, pattern)
+		if err != nil {
+			return err
+		}
+
+		mux.Lock()
+		topics = append(topics, found...)
+		mux.Unlock()
+
+		return nil
+	})
+
+	return topics, err
+}
+
+func scanNode(ctx context.Context, client goredis.Cmdable, pattern string) ([]string, error) {
+	var topics []string
+
+	iter := client.ScanType(ctx, 0, pattern, scanCount, "stream").Iterator()
+	for iter.Next(ctx) {
+		topics = append(topics, iter.Val())
+	}
+
+	return topics, iter.Err()
+}
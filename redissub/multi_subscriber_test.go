@@ -0,0 +1,186 @@
+package redissub_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/require"
+	"github.com/thienhaole92/uframework/goredis"
+	"github.com/thienhaole92/uframework/redissub"
+)
+
+func newMultiSubscriber(t *testing.T, rds *goredis.Redis, opts redissub.Options) *redissub.MultiSubscriber {
+	t.Helper()
+
+	subscriber := redissub.NewMultiSubscriber(rds, "group", opts)
+	t.Cleanup(func() {
+		require.NoError(t, subscriber.Close())
+	})
+
+	return subscriber
+}
+
+// topicRecorder records the topics of handled messages.
+type topicRecorder struct {
+	mux    sync.Mutex
+	topics map[string]int
+}
+
+func (r *topicRecorder) handle(ctx context.Context, _ *message.Message) error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	r.topics[redissub.TopicFromContext(ctx)]++
+
+	return nil
+}
+
+func (r *topicRecorder) count(topic string) int {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	return r.topics[topic]
+}
+
+func TestMultiSubscriber_Unsubscribe(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	rds := newTestRedis(ctx, t)
+	// A read still in progress when unsubscribing leaves its message pending until it is claimed.
+	opts := testOptions()
+	opts.ClaimInterval = 50 * time.Millisecond
+	opts.MaxIdleTime = 200 * time.Millisecond
+
+	subscriber := newMultiSubscriber(t, rds, opts)
+	recorder := &topicRecorder{mux: sync.Mutex{}, topics: make(map[string]int)}
+
+	require.NoError(t, subscriber.Subscribe("orders", recorder.handle))
+	require.ErrorIs(t, subscriber.Subscribe("orders", recorder.handle), redissub.ErrAlreadySubscribed)
+
+	publish(t, rds, "orders", "first")
+	require.Eventually(t, func() bool { return recorder.count("orders") == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, subscriber.Unsubscribe("orders"))
+	require.ErrorIs(t, subscriber.Unsubscribe("orders"), redissub.ErrNotSubscribed)
+
+	publish(t, rds, "orders", "second")
+	require.Never(t, func() bool { return recorder.count("orders") > 1 }, 300*time.Millisecond, 10*time.Millisecond)
+
+	// The group kept its position, so subscribing again handles the message published meanwhile.
+	require.NoError(t, subscriber.Subscribe("orders", recorder.handle))
+	require.Eventually(t, func() bool { return recorder.count("orders") == 2 }, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestMultiSubscriber_List(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	rds := newTestRedis(ctx, t)
+	subscriber := newMultiSubscriber(t, rds, testOptions())
+
+	block := make(chan struct{})
+	t.Cleanup(func() { close(block) })
+
+	started := make(chan struct{}, 1)
+
+	require.NoError(t, subscriber.Subscribe("payments", func(context.Context, *message.Message) error {
+		started <- struct{}{}
+		<-block
+
+		return nil
+	}))
+	require.NoError(t, subscriber.Subscribe("invoices", func(context.Context, *message.Message) error {
+		return nil
+	}))
+
+	publish(t, rds, "payments", "first", "second")
+
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "message not received")
+	}
+
+	infos, err := subscriber.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, infos, 2)
+
+	require.Equal(t, "invoices", infos[0].Topic)
+	require.Equal(t, "payments", infos[1].Topic)
+	require.Equal(t, "group", infos[1].ConsumerGroup)
+	require.NotEmpty(t, infos[1].Consumer)
+	require.Equal(t, int64(1), infos[1].Consumers)
+	// Neither message is acknowledged, whether the second one was read ahead depends on timing.
+	require.Equal(t, int64(2), infos[1].Pending+infos[1].Lag)
+	require.GreaterOrEqual(t, infos[1].Pending, int64(1))
+}
+
+func TestMultiSubscriber_SubscribePattern(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	rds := newTestRedis(ctx, t)
+	subscriber := newMultiSubscriber(t, rds, testOptions())
+	recorder := &topicRecorder{mux: sync.Mutex{}, topics: make(map[string]int)}
+
+	publish(t, rds, "tenant:acme:orders", "acme")
+	publish(t, rds, "tenant:acme:orders.dlq", "dead")
+	publish(t, rds, "other", "other")
+
+	require.NoError(t, subscriber.SubscribePattern(ctx, "tenant:*:orders*", recorder.handle))
+	require.ErrorIs(t, subscriber.SubscribePattern(ctx, "tenant:*:orders*", recorder.handle), redissub.ErrAlreadySubscribed)
+
+	// Streams created later are found by the next refresh.
+	publish(t, rds, "tenant:globex:orders", "globex")
+
+	require.Eventually(t, func() bool {
+		return recorder.count("tenant:acme:orders") == 1 && recorder.count("tenant:globex:orders") == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	infos, err := subscriber.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, infos, 2)
+	require.Equal(t, "tenant:*:orders*", infos[0].Pattern)
+
+	require.NoError(t, subscriber.UnsubscribePattern("tenant:*:orders*"))
+
+	infos, err = subscriber.List(ctx)
+	require.NoError(t, err)
+	require.Empty(t, infos)
+	require.Zero(t, recorder.count("tenant:acme:orders.dlq"))
+}
+
+func TestMultiSubscriber_Restart(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	rds := newTestRedis(ctx, t)
+	subscriber := newMultiSubscriber(t, rds, testOptions())
+	recorder := &topicRecorder{mux: sync.Mutex{}, topics: make(map[string]int)}
+
+	require.NoError(t, rds.Set(ctx, "orders", "not a stream", 0).Err())
+	require.NoError(t, subscriber.Subscribe("orders", recorder.handle))
+
+	select {
+	case failure := <-subscriber.Errors():
+		require.Equal(t, "orders", failure.Topic)
+		require.ErrorIs(t, failure.Err, redissub.ErrSubscribeFailed)
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "failure not reported")
+	}
+
+	require.Eventually(t, func() bool {
+		return errors.Is(subscriber.Healthy(), redissub.ErrUnhealthy)
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Once the topic is usable the subscription is restarted.
+	require.NoError(t, rds.Del(ctx, "orders").Err())
+	publish(t, rds, "orders", "order")
+
+	require.Eventually(t, func() bool { return recorder.count("orders") == 1 }, 5*time.Second, 10*time.Millisecond)
+}
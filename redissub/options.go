@@ -0,0 +1,206 @@
+package redissub
+
+import (
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/jpillora/backoff"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+const (
+	// StartFromOldest makes a new consumer group read the whole stream.
+	StartFromOldest = "0"
+	// StartFromLatest makes a new consumer group read only messages added after it is created.
+	StartFromLatest = "$"
+
+	defaultConcurrency  = 1
+	defaultDrainTimeout = 30 * time.Second
+
+	defaultPatternRefreshInterval = 30 * time.Second
+
+	defaultRestartMinBackoff = time.Second
+	defaultRestartMaxBackoff = time.Minute
+	defaultUnhealthyAfter    = 3
+
+	defaultBlockTime              = 100 * time.Millisecond
+	defaultClaimInterval          = 5 * time.Second
+	defaultClaimBatchSize         = 100
+	defaultMaxIdleTime            = 60 * time.Second
+	defaultCheckConsumersInterval = 300 * time.Second
+	defaultConsumerTimeout        = 600 * time.Second
+)
+
+// PartitionKeyFunc returns the key of a message. Messages with the same key are handled one at a time, in order.
+type PartitionKeyFunc func(msg *message.Message) string
+
+// RestartPolicy controls how MultiSubscriber restarts a subscription that failed.
+type RestartPolicy struct {
+	MinBackoff time.Duration // Delay before the first restart, defaults to 1s.
+	MaxBackoff time.Duration // Upper bound of the delay, defaults to 1m.
+	Factor     float64       // Growth of the delay per failure, defaults to 2.
+	// UnhealthyAfter is how many consecutive failures make MultiSubscriber.Healthy report the
+	// subscription, defaults to 3. Failures are no longer consecutive once a run lasts MaxBackoff.
+	UnhealthyAfter int
+}
+
+func (p *RestartPolicy) setDefaults() {
+	if p.MinBackoff <= 0 {
+		p.MinBackoff = defaultRestartMinBackoff
+	}
+
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = defaultRestartMaxBackoff
+	}
+
+	if p.Factor <= 0 {
+		p.Factor = defaultBackoffFactor
+	}
+
+	if p.UnhealthyAfter <= 0 {
+		p.UnhealthyAfter = defaultUnhealthyAfter
+	}
+}
+
+func (p RestartPolicy) backoff(failures int) time.Duration {
+	bkf := &backoff.Backoff{
+		Min:    p.MinBackoff,
+		Max:    p.MaxBackoff,
+		Factor: p.Factor,
+		Jitter: true,
+	}
+
+	return bkf.ForAttempt(float64(failures - 1))
+}
+
+type Options struct {
+	Retry RetryPolicy
+	// Restart applies to subscriptions of a MultiSubscriber.
+	Restart RestartPolicy
+	// DeadLetterTopic receives messages that exhausted their deliveries or failed permanently,
+	// defaults to the topic suffixed with ".dlq".
+	DeadLetterTopic string
+	// Concurrency is how many messages of the topic are handled at the same time, defaults to 1.
+	// A single reader hands messages to Concurrency workers, and stops reading while that many
+	// messages are not acknowledged yet.
+	Concurrency int
+	// PartitionKey, when set, handles messages sharing a key one at a time in stream order. Keys are
+	// hashed onto Concurrency lanes, each a queue of one worker, so unrelated keys may also wait for
+	// each other. A failed message is retried before the next messages of its lane.
+	PartitionKey PartitionKeyFunc
+	// DrainTimeout bounds how long Close waits for in-flight messages, defaults to 30s.
+	DrainTimeout time.Duration
+	// Middlewares wrap the message handler, the first one being the outermost. See Chain.
+	Middlewares []Middleware
+	// PatternRefreshInterval is how often MultiSubscriber.SubscribePattern looks for new streams, defaults to 30s.
+	PatternRefreshInterval time.Duration
+
+	// The fields below tune the reading of the stream.
+
+	// Consumer names this subscriber within the group, defaults to a random ID. A stable name,
+	// such as the pod name, keeps restarts from leaving idle consumers behind in the group.
+	Consumer string
+	// BlockTime is how long a read waits for new messages, defaults to 100ms.
+	BlockTime time.Duration
+	// ReadBatchSize is how many new messages are read at most per round trip, defaults to Concurrency.
+	// A read never takes more messages than there are idle workers.
+	ReadBatchSize int64
+	// ClaimInterval is how often pending messages of other consumers are checked, defaults to 5s.
+	ClaimInterval time.Duration
+	// ClaimBatchSize is how many pending messages are claimed at most per ClaimInterval, defaults to 100.
+	ClaimBatchSize int64
+	// MaxIdleTime is how long a message stays pending before another consumer claims it, defaults to 60s.
+	// It must be longer than the slowest handler plus its retry backoff.
+	MaxIdleTime time.Duration
+	// CheckConsumersInterval is how often idle consumers are looked for, defaults to 300s.
+	CheckConsumersInterval time.Duration
+	// ConsumerTimeout is how long a consumer without pending messages may be idle before it is
+	// removed from the group, defaults to 600s.
+	ConsumerTimeout time.Duration
+	// OldestID is where a new consumer group starts reading, StartFromOldest by default.
+	OldestID string
+	// ShouldClaimPendingMessage, when set, decides whether a pending message idle for MaxIdleTime is claimed.
+	ShouldClaimPendingMessage func(goredis.XPendingExt) bool
+	// ShouldStopOnReadErrors, when set, decides whether a read error stops the subscription.
+	ShouldStopOnReadErrors func(error) bool
+}
+
+// SetDefaults fills the zero fields with the defaults of a subscriber of topic.
+func (o *Options) SetDefaults(topic string) {
+	if o.Retry.MaxDeliveries <= 0 {
+		o.Retry.MaxDeliveries = defaultMaxDeliveries
+	}
+
+	if o.Retry.MinBackoff <= 0 {
+		o.Retry.MinBackoff = defaultMinBackoff
+	}
+
+	if o.Retry.MaxBackoff <= 0 {
+		o.Retry.MaxBackoff = defaultMaxBackoff
+	}
+
+	if o.Retry.Factor <= 0 {
+		o.Retry.Factor = defaultBackoffFactor
+	}
+
+	if o.DeadLetterTopic == "" {
+		o.DeadLetterTopic = topic + defaultDeadLetterSuffix
+	}
+
+	if o.Concurrency <= 0 {
+		o.Concurrency = defaultConcurrency
+	}
+
+	if o.DrainTimeout <= 0 {
+		o.DrainTimeout = defaultDrainTimeout
+	}
+
+	if o.Consumer == "" {
+		o.Consumer = watermill.NewShortUUID()
+	}
+
+	o.setReadDefaults()
+}
+
+func (o *Options) setReadDefaults() {
+	if o.BlockTime <= 0 {
+		o.BlockTime = defaultBlockTime
+	}
+
+	if o.ReadBatchSize <= 0 {
+		o.ReadBatchSize = int64(o.Concurrency)
+	}
+
+	if o.ClaimInterval <= 0 {
+		o.ClaimInterval = defaultClaimInterval
+	}
+
+	if o.ClaimBatchSize <= 0 {
+		o.ClaimBatchSize = defaultClaimBatchSize
+	}
+
+	if o.MaxIdleTime <= 0 {
+		o.MaxIdleTime = defaultMaxIdleTime
+	}
+
+	if o.CheckConsumersInterval <= 0 {
+		o.CheckConsumersInterval = defaultCheckConsumersInterval
+	}
+
+	if o.ConsumerTimeout <= 0 {
+		o.ConsumerTimeout = defaultConsumerTimeout
+	}
+
+	if o.OldestID == "" {
+		o.OldestID = StartFromOldest
+	}
+}
+
+func (o Options) patternRefreshInterval() time.Duration {
+	if o.PatternRefreshInterval <= 0 {
+		return defaultPatternRefreshInterval
+	}
+
+	return o.PatternRefreshInterval
+}
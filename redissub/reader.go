@@ -0,0 +1,408 @@
+package redissub
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill-redisstream/pkg/redisstream"
+	"github.com/ThreeDotsLabs/watermill/message"
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	readErrorBackoff = 500 * time.Millisecond
+	ackRetryInterval = 100 * time.Millisecond
+
+	// newEntriesID reads the entries never delivered to the group.
+	newEntriesID = ">"
+)
+
+// entry is a message read from the stream, with the ID to acknowledge it.
+type entry struct {
+	id  string
+	msg *message.Message
+}
+
+// dispatcher hands the entries of the single stream reader to the workers. Without a partition key
+// every worker takes from one shared lane. With it each worker owns a lane, and entries sharing a
+// key are queued on the same lane in stream order.
+type dispatcher struct {
+	lanes        []chan entry
+	partitionKey PartitionKeyFunc
+	// slots bounds the entries read but not yet acknowledged, so each lane can queue all of them.
+	slots       chan struct{}
+	inFlight    map[string]struct{} // IDs of the slotted entries, which the claim loop skips
+	inFlightMux sync.Mutex
+}
+
+func newDispatcher(concurrency int, partitionKey PartitionKeyFunc) *dispatcher {
+	lanes := make([]chan entry, 1)
+	if partitionKey != nil {
+		lanes = make([]chan entry, concurrency)
+	}
+
+	for i := range lanes {
+		lanes[i] = make(chan entry, concurrency)
+	}
+
+	return &dispatcher{
+		lanes:        lanes,
+		partitionKey: partitionKey,
+		slots:        make(chan struct{}, concurrency),
+		inFlight:     make(map[string]struct{}, concurrency),
+		inFlightMux:  sync.Mutex{},
+	}
+}
+
+// lane returns the lane of the i-th worker.
+func (d *dispatcher) lane(i int) <-chan entry {
+	return d.lanes[i%len(d.lanes)]
+}
+
+// acquire waits for a free slot, it returns false when ctx is done first.
+func (d *dispatcher) acquire(ctx context.Context) bool {
+	select {
+	case d.slots <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// acquireFree takes up to n slots without waiting, and returns how many it took.
+func (d *dispatcher) acquireFree(n int64) int64 {
+	for i := range n {
+		select {
+		case d.slots <- struct{}{}:
+		default:
+			return i
+		}
+	}
+
+	return n
+}
+
+// release frees the slot of an entry that was handled, or that was not dispatched when id is empty.
+func (d *dispatcher) release(id string) {
+	if id != "" {
+		d.inFlightMux.Lock()
+		delete(d.inFlight, id)
+		d.inFlightMux.Unlock()
+	}
+
+	<-d.slots
+}
+
+func (d *dispatcher) isInFlight(id string) bool {
+	d.inFlightMux.Lock()
+	defer d.inFlightMux.Unlock()
+
+	_, ok := d.inFlight[id]
+
+	return ok
+}
+
+// dispatch queues the stream message, in the slot acquired for it, on the lane of its key. deliveries
+// is how many times the group delivered the entry before, it carries the attempts of consumers that
+// crashed or lost the entry over to this one.
+func (d *dispatcher) dispatch(xm goredis.XMessage, deliveries int64) {
+	msg, _ := poisonTolerantUnmarshaller{Unmarshaller: redisstream.DefaultMarshallerUnmarshaller{}}.Unmarshal(xm.Values)
+
+	if attempts := int(deliveries); attempts > deliveryAttempt(msg) {
+		msg.Metadata.Set(MetadataDeliveryAttempt, strconv.Itoa(attempts))
+	}
+
+	d.inFlightMux.Lock()
+	d.inFlight[xm.ID] = struct{}{}
+	d.inFlightMux.Unlock()
+
+	lane := d.lanes[0]
+	if d.partitionKey != nil {
+		hash := fnv.New32a()
+		_, _ = hash.Write([]byte(d.partitionKey(msg)))
+
+		lane = d.lanes[hash.Sum32()%uint32(len(d.lanes))] //nolint:gosec
+	}
+
+	lane <- entry{id: xm.ID, msg: msg}
+}
+
+// close ends the lanes once nothing dispatches anymore, so the workers stop after the queued entries.
+func (d *dispatcher) close() {
+	for _, lane := range d.lanes {
+		close(lane)
+	}
+}
+
+// read runs the only reader of this consumer: new entries, pending entries claimed from idle
+// consumers, and the removal of consumers idle for ConsumerTimeout. It returns when ctx is done or
+// ShouldStopOnReadErrors gives up on a read error.
+func (s *Subscriber) read(ctx context.Context, d *dispatcher) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var loops sync.WaitGroup
+
+	loops.Add(2)
+
+	go func() {
+		defer loops.Done()
+		s.claimLoop(ctx, d)
+	}()
+
+	go func() {
+		defer loops.Done()
+		s.checkConsumersLoop(ctx)
+	}()
+
+	s.readNew(ctx, d)
+	cancel()
+	loops.Wait()
+}
+
+// readNew reads up to ReadBatchSize new entries at a time, as many as there are free slots.
+func (s *Subscriber) readNew(ctx context.Context, d *dispatcher) {
+	for d.acquire(ctx) {
+		slots := 1 + d.acquireFree(s.opts.ReadBatchSize-1)
+
+		streams, err := s.redisClient.XReadGroup(ctx, &goredis.XReadGroupArgs{
+			Group:    s.consumerGroup,
+			Consumer: s.opts.Consumer,
+			Streams:  []string{s.topic, newEntriesID},
+			Count:    slots,
+			Block:    s.opts.BlockTime,
+			NoAck:    false,
+		}).Result()
+
+		var entries []goredis.XMessage
+		if err == nil && len(streams) > 0 {
+			entries = streams[0].Messages
+		}
+
+		for range slots - int64(len(entries)) {
+			d.release("")
+		}
+
+		switch {
+		case errors.Is(err, goredis.Nil):
+		case err != nil:
+			if ctx.Err() != nil {
+				return
+			}
+
+			if s.opts.ShouldStopOnReadErrors != nil && s.opts.ShouldStopOnReadErrors(err) {
+				log.Error().Err(err).Str("topic", s.topic).Msg("Stopped reading after error")
+
+				return
+			}
+
+			log.Error().Err(err).Str("topic", s.topic).Msg("Failed to read messages")
+			sleep(ctx, readErrorBackoff)
+		default:
+			for _, xm := range entries {
+				d.dispatch(xm, 0)
+			}
+		}
+	}
+}
+
+// claimLoop claims the entries pending for MaxIdleTime, such as the ones of a consumer that
+// crashed, every ClaimInterval and once right away.
+func (s *Subscriber) claimLoop(ctx context.Context, d *dispatcher) {
+	ticker := time.NewTicker(s.opts.ClaimInterval)
+	defer ticker.Stop()
+
+	for {
+		s.claim(ctx, d)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Subscriber) claim(ctx context.Context, d *dispatcher) {
+	pending, err := s.redisClient.XPendingExt(ctx, &goredis.XPendingExtArgs{
+		Stream:   s.topic,
+		Group:    s.consumerGroup,
+		Idle:     s.opts.MaxIdleTime,
+		Start:    "-",
+		End:      "+",
+		Count:    s.opts.ClaimBatchSize,
+		Consumer: "",
+	}).Result()
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Error().Err(err).Str("topic", s.topic).Msg("Failed to list pending messages")
+		}
+
+		return
+	}
+
+	for _, xp := range pending {
+		if d.isInFlight(xp.ID) {
+			continue
+		}
+
+		if s.opts.ShouldClaimPendingMessage != nil && !s.opts.ShouldClaimPendingMessage(xp) {
+			continue
+		}
+
+		if !d.acquire(ctx) {
+			return
+		}
+
+		claimed, err := s.redisClient.XClaim(ctx, &goredis.XClaimArgs{
+			Stream:   s.topic,
+			Group:    s.consumerGroup,
+			Consumer: s.opts.Consumer,
+			// Another consumer claiming the entry at the same time resets its idle time, so only one wins.
+			MinIdle:  s.opts.MaxIdleTime,
+			Messages: []string{xp.ID},
+		}).Result()
+		// The entry was trimmed from the stream while pending.
+		if errors.Is(err, goredis.Nil) {
+			d.release("")
+			s.redisClient.XAck(ctx, s.topic, s.consumerGroup, xp.ID)
+
+			continue
+		}
+
+		if err != nil || len(claimed) == 0 {
+			d.release("")
+
+			if err != nil && ctx.Err() == nil {
+				log.Error().Err(err).Str("topic", s.topic).Str("entry_id", xp.ID).Msg("Failed to claim message")
+			}
+
+			continue
+		}
+
+		// RetryCount is the number of deliveries before this claim.
+		d.dispatch(claimed[0], xp.RetryCount)
+	}
+}
+
+// checkConsumersLoop removes the consumers of the group without pending entries that have been
+// idle for ConsumerTimeout, every CheckConsumersInterval.
+func (s *Subscriber) checkConsumersLoop(ctx context.Context) {
+	ticker := time.NewTicker(s.opts.CheckConsumersInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		consumers, err := s.redisClient.XInfoConsumers(ctx, s.topic, s.consumerGroup).Result()
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Error().Err(err).Str("topic", s.topic).Msg("Failed to list consumers")
+			}
+
+			continue
+		}
+
+		for _, consumer := range consumers {
+			if consumer.Pending > 0 || consumer.Idle < s.opts.ConsumerTimeout {
+				continue
+			}
+
+			if err := s.redisClient.XGroupDelConsumer(ctx, s.topic, s.consumerGroup, consumer.Name).Err(); err != nil {
+				log.Error().Err(err).Str("topic", s.topic).Str("consumer", consumer.Name).Msg("Failed to remove idle consumer")
+			}
+		}
+	}
+}
+
+// createGroup creates the consumer group, and the stream when missing.
+func (s *Subscriber) createGroup(ctx context.Context) error {
+	err := s.redisClient.XGroupCreateMkStream(ctx, s.topic, s.consumerGroup, s.opts.OldestID).Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return err //nolint:wrapcheck
+	}
+
+	return nil
+}
+
+// deliver hands the entry to the handler until it is acknowledged, or left pending on shutdown.
+// A nacked message is redelivered right away by this worker, so the next entries of its lane
+// never overtake it.
+func (s *Subscriber) deliver(e entry) {
+	msg := e.msg
+
+	for {
+		ctx, cancel := context.WithCancel(s.ctx)
+		msg.SetContext(ctx)
+
+		// Cancels the message context once the outcome is known, which ack waits for.
+		go func() {
+			defer cancel()
+
+			select {
+			case <-msg.Acked():
+				s.xack(e.id)
+			case <-msg.Nacked():
+			case <-ctx.Done():
+			}
+		}()
+
+		if err := s.handleMessage(context.Background(), msg); err != nil {
+			log.Error().Err(err).Str("topic", s.Topic()).Str("message_id", msg.UUID).Msg("Failed to process message")
+		}
+
+		select {
+		case <-msg.Nacked():
+			<-ctx.Done()
+		default:
+			// Acknowledged, or left pending on shutdown.
+			return
+		}
+
+		select {
+		case <-s.shutdownSignal:
+			return
+		default:
+			msg = msg.Copy()
+		}
+	}
+}
+
+// xack acknowledges the entry, retrying until it succeeds or the subscriber is stopped.
+func (s *Subscriber) xack(id string) {
+	for {
+		err := s.redisClient.XAck(s.ctx, s.topic, s.consumerGroup, id).Err()
+		if err == nil {
+			return
+		}
+
+		log.Error().Err(err).Str("topic", s.topic).Str("entry_id", id).Msg("Failed to acknowledge message")
+
+		if !sleep(s.ctx, ackRetryInterval) {
+			return
+		}
+	}
+}
+
+// sleep waits for d, it returns false when ctx is done first.
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,204 @@
+package redissub
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-redisstream/pkg/redisstream"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/jpillora/backoff"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+const (
+	// MetadataDeliveryAttempt holds how many times the message has been handed to the handler.
+	MetadataDeliveryAttempt = "delivery_attempt"
+	// MetadataErrorHistory holds the JSON encoded []DeliveryFailure of the failed attempts.
+	MetadataErrorHistory = "error_history"
+	// MetadataPoison is set on messages that could not be decoded from the stream.
+	MetadataPoison = "poison"
+
+	MetadataDeadLetterTopic     = "dead_letter_topic"
+	MetadataDeadLetterMessageID = "dead_letter_message_id"
+	MetadataDeadLetterError     = "dead_letter_error"
+	MetadataDeadLetterAttempts  = "dead_letter_attempts"
+	MetadataDeadLetterAt        = "dead_letter_at"
+
+	defaultMaxDeliveries    = 5
+	defaultMinBackoff       = 100 * time.Millisecond
+	defaultMaxBackoff       = 10 * time.Second
+	defaultBackoffFactor    = 2
+	defaultDeadLetterSuffix = ".dlq"
+)
+
+var (
+	ErrMalformedMessage = errors.New("malformed stream message")
+	ErrDeadLetterFailed = errors.New("failed to publish message to dead-letter topic")
+	// ErrDeliveriesExhausted is the dead-letter error of a message that reached MaxDeliveries
+	// without a recorded failure, such as one whose consumers crashed while handling it.
+	ErrDeliveriesExhausted = errors.New("message deliveries exhausted")
+)
+
+// RetryPolicy controls how failed messages are redelivered before they are dead-lettered.
+type RetryPolicy struct {
+	MaxDeliveries int           // Deliveries before a message is dead-lettered, defaults to 5.
+	MinBackoff    time.Duration // Delay before the first redelivery, defaults to 100ms.
+	MaxBackoff    time.Duration // Upper bound of the delay, defaults to 10s.
+	Factor        float64       // Growth of the delay per attempt, defaults to 2.
+}
+
+// Backoff returns the delay before redelivering a message that failed its attempt-th delivery.
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	bkf := &backoff.Backoff{
+		Min:    p.MinBackoff,
+		Max:    p.MaxBackoff,
+		Factor: p.Factor,
+		Jitter: true,
+	}
+
+	return bkf.ForAttempt(float64(attempt - 1))
+}
+
+// DeliveryFailure records one failed attempt to handle a message.
+type DeliveryFailure struct {
+	Attempt int       `json:"attempt"`
+	Error   string    `json:"error"`
+	At      time.Time `json:"at"`
+}
+
+// ErrorHistory returns the failed attempts recorded on a message, such as one read from a dead-letter topic.
+func ErrorHistory(msg *message.Message) []DeliveryFailure {
+	var history []DeliveryFailure
+
+	if raw := msg.Metadata.Get(MetadataErrorHistory); raw != "" {
+		_ = json.Unmarshal([]byte(raw), &history)
+	}
+
+	return history
+}
+
+func deliveryAttempt(msg *message.Message) int {
+	attempt, _ := strconv.Atoi(msg.Metadata.Get(MetadataDeliveryAttempt))
+
+	return attempt
+}
+
+// RecordFailure sets the delivery attempt of the message and adds err to its error history.
+func RecordFailure(msg *message.Message, attempt int, err error) {
+	history := append(ErrorHistory(msg), DeliveryFailure{Attempt: attempt, Error: err.Error(), At: time.Now().UTC()})
+
+	raw, _ := json.Marshal(history)
+
+	msg.Metadata.Set(MetadataDeliveryAttempt, strconv.Itoa(attempt))
+	msg.Metadata.Set(MetadataErrorHistory, string(raw))
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent marks a handler error as not worth retrying, the message is dead-lettered right away.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return &permanentError{err: err}
+}
+
+// IsPermanent reports whether err was marked with Permanent.
+func IsPermanent(err error) bool {
+	var permanent *permanentError
+
+	return errors.As(err, &permanent)
+}
+
+// deadLetter appends a copy of the message, with the failure attached, to the dead-letter topic.
+// The stream format is the one of redisstream so the topic can be consumed by a Subscriber.
+func deadLetter(
+	ctx context.Context,
+	client goredis.UniversalClient,
+	topic, dlqTopic string,
+	msg *message.Message,
+	attempts int,
+	cause error,
+) error {
+	dead := DeadLetterMessage(topic, msg, attempts, cause)
+
+	values, err := redisstream.DefaultMarshallerUnmarshaller{}.Marshal(dlqTopic, dead)
+	if err != nil {
+		return fmt.Errorf("%w %s: %w", ErrDeadLetterFailed, dlqTopic, err)
+	}
+
+	//nolint:exhaustruct
+	if err := client.XAdd(ctx, &goredis.XAddArgs{Stream: dlqTopic, Values: values}).Err(); err != nil {
+		return fmt.Errorf("%w %s: %w", ErrDeadLetterFailed, dlqTopic, err)
+	}
+
+	return nil
+}
+
+// DeadLetterMessage returns a copy of the message, read from topic, with the failure attached.
+func DeadLetterMessage(topic string, msg *message.Message, attempts int, cause error) *message.Message {
+	dead := message.NewMessage(watermill.NewUUID(), msg.Payload)
+	for key, value := range msg.Metadata {
+		dead.Metadata.Set(key, value)
+	}
+
+	dead.Metadata.Set(MetadataDeadLetterTopic, topic)
+	dead.Metadata.Set(MetadataDeadLetterMessageID, msg.UUID)
+	dead.Metadata.Set(MetadataDeadLetterError, cause.Error())
+	dead.Metadata.Set(MetadataDeadLetterAttempts, strconv.Itoa(attempts))
+	dead.Metadata.Set(MetadataDeadLetterAt, time.Now().UTC().Format(time.RFC3339Nano))
+
+	return dead
+}
+
+// poisonTolerantUnmarshaller turns entries the wrapped unmarshaller rejects into messages marked
+// with MetadataPoison. Watermill stops the subscription on unmarshal errors, so a single bad
+// entry would otherwise block the topic.
+type poisonTolerantUnmarshaller struct {
+	redisstream.Unmarshaller
+}
+
+func (u poisonTolerantUnmarshaller) Unmarshal(values map[string]any) (msg *message.Message, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			msg, err = poisonMessage(values, fmt.Errorf("%w: %v", ErrMalformedMessage, r)), nil
+		}
+	}()
+
+	msg, err = u.Unmarshaller.Unmarshal(values)
+	if err != nil {
+		return poisonMessage(values, fmt.Errorf("%w: %w", ErrMalformedMessage, err)), nil
+	}
+
+	if msg.UUID == "" {
+		return poisonMessage(values, fmt.Errorf("%w: missing message uuid", ErrMalformedMessage)), nil
+	}
+
+	return msg, nil
+}
+
+// poisonMessage keeps the raw stream entry as the payload so it can be inspected from the dead-letter topic.
+func poisonMessage(values map[string]any, cause error) *message.Message {
+	payload, _ := json.Marshal(values)
+
+	msg := message.NewMessage(watermill.NewUUID(), payload)
+	msg.Metadata.Set(MetadataPoison, cause.Error())
+
+	return msg
+}
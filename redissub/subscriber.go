@@ -4,11 +4,15 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
+	"sync"
+	"time"
 
-	"github.com/ThreeDotsLabs/watermill-redisstream/pkg/redisstream"
 	"github.com/ThreeDotsLabs/watermill/message"
 	goredis "github.com/redis/go-redis/v9"
 	"github.com/rs/zerolog/log"
+	"github.com/thienhaole92/uframework/redispub"
+	"github.com/thienhaole92/uframework/util"
 )
 
 var (
@@ -17,23 +21,37 @@ var (
 	ErrEmptyTopicName           = errors.New("topic name cannot be empty")
 	ErrNilMessageHandler        = errors.New("message handler cannot be nil")
 	ErrMessageHandlerNotDefined = errors.New("message handler is not defined")
+	ErrSubscribeFailed          = errors.New("failed to subscribe to topic")
+	ErrSubscriptionStopped      = errors.New("subscription stopped unexpectedly")
 )
 
-type MessageHandler func(ctx context.Context, payload message.Payload) error
+// MessageHandler handles a message, including its metadata. The subscriber acknowledges the message
+// when the handler returns nil, handlers must not ack or nack it themselves.
+type MessageHandler func(ctx context.Context, msg *message.Message) error
 
 type Subscriber struct {
-	*redisstream.Subscriber
+	redisClient    goredis.UniversalClient
 	topic          string
 	consumerGroup  string
+	opts           Options
+	ctx            context.Context //nolint:containedctx
+	cancel         context.CancelFunc
 	shutdownSignal chan struct{} // Channel to signal shutdown
 	messageHandler MessageHandler
+	workers        sync.WaitGroup // Reader and workers still running
+	stateMux       sync.Mutex     // Protects closed and the start of workers
+	closed         bool
 }
 
+// NewSubscriber creates a subscriber of topic within consumerGroup. Messages the handler fails are
+// redelivered with backoff according to opts.Retry, and moved to opts.DeadLetterTopic once their
+// deliveries are exhausted or the handler returns a Permanent error.
 func NewSubscriber(
 	redisClient goredis.UniversalClient,
 	consumerGroup,
 	topic string,
 	messageHandler MessageHandler,
+	opts Options,
 ) (*Subscriber, error) {
 	if redisClient == nil {
 		return nil, ErrNilRedisClient
@@ -51,44 +69,55 @@ func NewSubscriber(
 		return nil, ErrNilMessageHandler
 	}
 
-	redisSubscriber, err := redisstream.NewSubscriber(
-		redisstream.SubscriberConfig{
-			Client:                    redisClient,
-			Unmarshaller:              redisstream.DefaultMarshallerUnmarshaller{},
-			ConsumerGroup:             consumerGroup,
-			Consumer:                  "",
-			NackResendSleep:           0,
-			BlockTime:                 0,
-			ClaimInterval:             0,
-			ClaimBatchSize:            0,
-			MaxIdleTime:               0,
-			CheckConsumersInterval:    0,
-			ConsumerTimeout:           0,
-			OldestId:                  "",
-			FanOutOldestId:            "",
-			ShouldClaimPendingMessage: nil,
-			ShouldStopOnReadErrors:    nil,
-		},
-		nil,
-	)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create Redis subscriber: %w", err)
-	}
+	opts.SetDefaults(topic)
+
+	ctx, cancel := context.WithCancel(context.Background())
 
 	return &Subscriber{
+		redisClient:    redisClient,
 		topic:          topic,
 		consumerGroup:  consumerGroup,
-		Subscriber:     redisSubscriber,
-		messageHandler: messageHandler,
+		opts:           opts,
+		ctx:            ctx,
+		cancel:         cancel,
+		messageHandler: Chain(messageHandler, opts.Middlewares...),
 		shutdownSignal: make(chan struct{}), // Initialize the shutdown signal channel
+		workers:        sync.WaitGroup{},
+		stateMux:       sync.Mutex{},
+		closed:         false,
 	}, nil
 }
 
+// Close stops reading new messages and waits up to DrainTimeout for the in-flight ones to be handled.
+// The redis client is shared and stays open. Messages that were not acknowledged stay pending and
+// are claimed again later.
 func (s *Subscriber) Close() error {
-	if s.shutdownSignal != nil {
-		close(s.shutdownSignal) // Signal shutdown
+	s.stateMux.Lock()
+	if s.closed {
+		s.stateMux.Unlock()
+
+		return nil
+	}
+
+	s.closed = true
+	close(s.shutdownSignal) // Signal shutdown
+	s.stateMux.Unlock()
+
+	drained := make(chan struct{})
+
+	go func() {
+		s.workers.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+	case <-time.After(s.opts.DrainTimeout):
+		log.Warn().Str("topic", s.Topic()).Dur("timeout", s.opts.DrainTimeout).Msg("Timed out draining in-flight messages")
 	}
 
+	s.cancel()
+
 	return nil
 }
 
@@ -100,53 +129,259 @@ func (s *Subscriber) Topic() string {
 	return s.topic
 }
 
-func (s *Subscriber) Start() {
-	log.Info().Str("topic", s.Topic()).Msg("Starting subscription")
+// Consumer returns the name of this subscriber within its consumer group.
+func (s *Subscriber) Consumer() string {
+	return s.opts.Consumer
+}
+
+// Info reports the consumer group of the subscription. Counts are zero until the group is created
+// by the first read.
+func (s *Subscriber) Info(ctx context.Context) (SubscriptionInfo, error) {
+	info := SubscriptionInfo{
+		Topic:         s.topic,
+		ConsumerGroup: s.consumerGroup,
+		Consumer:      s.opts.Consumer,
+		Pattern:       "",
+		Consumers:     0,
+		Pending:       0,
+		Lag:           0,
+	}
+
+	groups, err := s.redisClient.XInfoGroups(ctx, s.topic).Result()
+	if err != nil {
+		// Redis has no error code for a missing stream.
+		if strings.Contains(err.Error(), "no such key") {
+			return info, nil
+		}
+
+		return info, fmt.Errorf("failed to describe consumer groups of topic %s: %w", s.topic, err)
+	}
+
+	for _, group := range groups {
+		if group.Name == s.consumerGroup {
+			info.Consumers = group.Consumers
+			info.Pending = group.Pending
+			info.Lag = group.Lag
+		}
+	}
+
+	return info, nil
+}
 
-	msgChan, err := s.Subscriber.Subscribe(context.Background(), s.Topic())
+// Start reads the topic and hands its messages to Concurrency workers, and blocks until they stop.
+// It returns nil once Close is called, or an error when the topic cannot be subscribed or the
+// subscription stops on its own, such as when ShouldStopOnReadErrors gives up. A subscriber that
+// failed may be started again.
+func (s *Subscriber) Start() error {
+	stop, err := s.start()
 	if err != nil {
-		log.Panic().Err(err).Str("topic", s.Topic()).Msg("Failed to subscribe to topic")
+		return err
+	}
+
+	return s.wait(stop)
+}
+
+// start creates the consumer group, then runs the single reader of the topic and the workers.
+func (s *Subscriber) start() (context.CancelFunc, error) {
+	log.Info().Str("topic", s.Topic()).Int("concurrency", s.opts.Concurrency).Msg("Starting subscription")
+
+	// Cancelled on Close or when the reader stops on its own, so the whole run stops and can be restarted.
+	ctx, stop := context.WithCancel(s.ctx)
+
+	if err := s.createGroup(ctx); err != nil {
+		stop()
+
+		return nil, fmt.Errorf("%w %s: %w", ErrSubscribeFailed, s.Topic(), err)
+	}
+
+	// Registered under the lock so Close either waits for the run or the run is never started.
+	s.stateMux.Lock()
+	defer s.stateMux.Unlock()
+
+	if s.closed {
+		return stop, nil
+	}
+
+	dispatcher := newDispatcher(s.opts.Concurrency, s.opts.PartitionKey)
+
+	s.workers.Add(s.opts.Concurrency + 1)
+
+	go func() {
+		defer s.workers.Done()
+
+		go func() {
+			select {
+			case <-s.shutdownSignal:
+				stop()
+			case <-ctx.Done():
+			}
+		}()
+
+		s.read(ctx, dispatcher)
+		stop()
+		dispatcher.close()
+	}()
+
+	for i := range s.opts.Concurrency {
+		go func() {
+			defer s.workers.Done()
+			s.work(dispatcher, i)
+		}()
+	}
+
+	return stop, nil
+}
+
+// wait blocks until the workers stopped, and reports whether they stopped because of Close.
+func (s *Subscriber) wait(stop context.CancelFunc) error {
+	s.workers.Wait()
+	stop()
 
-		return
+	s.stateMux.Lock()
+	closed := s.closed
+	s.stateMux.Unlock()
+
+	if !closed {
+		return fmt.Errorf("%w %s", ErrSubscriptionStopped, s.Topic())
 	}
 
+	log.Info().Str("topic", s.Topic()).Msg("Subscription stopped")
+
+	return nil
+}
+
+// work handles the messages of the i-th lane one at a time, each until it is acknowledged. It
+// returns on Close, or once the reader stopped and the lane is drained.
+func (s *Subscriber) work(d *dispatcher, i int) {
 	for {
 		select {
 		case <-s.shutdownSignal:
-			log.Info().Str("topic", s.Topic()).Msg("Subscription stopped")
-
 			return
-		case msg := <-msgChan:
-			if msg == nil || msg.UUID == "" {
-				log.Debug().Str("topic", s.Topic()).Msg("Received empty message")
+		case e, ok := <-d.lane(i):
+			if !ok {
+				log.Debug().Str("topic", s.Topic()).Msg("Subscription reader stopped")
 
-				continue
+				return
 			}
 
-			if err := s.handleMessage(context.Background(), msg); err != nil {
-				log.Error().Err(err).Str("topic", s.Topic()).Str("message_id", msg.UUID).Msg("Failed to process message")
-			}
+			s.deliver(e)
+			d.release(e.id)
 		}
 	}
 }
 
-// handleMessage processes a single message using the provided message handler.
+// handleMessage processes a single message using the provided message handler. A failed message is
+// nacked after a backoff to be redelivered, with the attempt and error recorded in its metadata. A
+// message in flight elsewhere is nacked after MaxBackoff without recording an attempt.
 func (s *Subscriber) handleMessage(ctx context.Context, msg *message.Message) error {
 	if s.messageHandler == nil {
 		return ErrMessageHandlerNotDefined
 	}
 
-	// Process the message payload
-	if err := s.messageHandler(ctx, msg.Payload); err != nil {
-		return fmt.Errorf("message handler failed: %w", err)
+	if reason := msg.Metadata.Get(MetadataPoison); reason != "" {
+		return s.deadLetter(msg, 0, errors.New(reason))
 	}
 
-	// Acknowledge the message
-	if !msg.Ack() {
-		log.Debug().Str("message_id", msg.UUID).Msg("Message already acknowledged")
-	} else {
-		log.Debug().Str("message_id", msg.UUID).Msg("Message acknowledged successfully")
+	attempt := deliveryAttempt(msg) + 1
+
+	// Earlier deliveries, possibly to consumers that crashed, already used every attempt.
+	if attempt > s.opts.Retry.MaxDeliveries {
+		return s.deadLetter(msg, attempt-1, fmt.Errorf("%w after %d deliveries", ErrDeliveriesExhausted, attempt-1))
 	}
 
+	err := s.messageHandler(HandlerContext(ctx, s.topic, msg), msg)
+	if err == nil {
+		// Acknowledge the message
+		if !ack(msg) {
+			log.Debug().Str("message_id", msg.UUID).Msg("Message already acknowledged")
+		} else {
+			log.Debug().Str("message_id", msg.UUID).Msg("Message acknowledged successfully")
+		}
+
+		return nil
+	}
+
+	// The message is not failing, another delivery of it is still being handled.
+	if errors.Is(err, ErrMessageInFlight) {
+		s.nackAfter(msg, s.opts.Retry.MaxBackoff)
+
+		return fmt.Errorf("%w, retrying in %s", err, s.opts.Retry.MaxBackoff)
+	}
+
+	err = fmt.Errorf("message handler failed: %w", err)
+	RecordFailure(msg, attempt, err)
+
+	if IsPermanent(err) || attempt >= s.opts.Retry.MaxDeliveries {
+		if dlqErr := s.deadLetter(msg, attempt, err); dlqErr != nil {
+			return errors.Join(err, dlqErr)
+		}
+
+		return err
+	}
+
+	delay := s.opts.Retry.Backoff(attempt)
+	s.nackAfter(msg, delay)
+
+	return fmt.Errorf("%w, attempt %d of %d, retrying in %s", err, attempt, s.opts.Retry.MaxDeliveries, delay)
+}
+
+// deadLetter moves the message to the dead-letter topic and acknowledges it. When the dead-letter topic
+// cannot be written the message is nacked so it is not lost.
+func (s *Subscriber) deadLetter(msg *message.Message, attempts int, cause error) error {
+	if err := deadLetter(s.ctx, s.redisClient, s.topic, s.opts.DeadLetterTopic, msg, attempts, cause); err != nil {
+		s.nackAfter(msg, s.opts.Retry.MaxBackoff)
+
+		return err
+	}
+
+	ack(msg)
+
+	log.Warn().
+		Err(cause).
+		Str("topic", s.topic).
+		Str("dead_letter_topic", s.opts.DeadLetterTopic).
+		Str("message_id", msg.UUID).
+		Int("attempts", attempts).
+		Msg("Message moved to dead-letter topic")
+
 	return nil
 }
+
+// nackAfter nacks the message once delay has passed. On shutdown the message is left pending instead,
+// it is claimed again once a subscriber of the group is back.
+func (s *Subscriber) nackAfter(msg *message.Message, delay time.Duration) {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		msg.Nack()
+	case <-s.shutdownSignal:
+	}
+}
+
+// HandlerContext carries the topic and the request ID of the message to the handler. Subscribers of
+// other brokers use it so handlers and middlewares work the same on every broker.
+func HandlerContext(ctx context.Context, topic string, msg *message.Message) context.Context {
+	ctx = context.WithValue(ctx, topicKey{}, topic)
+
+	if requestID := msg.Metadata.Get(redispub.MetadataRequestID); requestID != "" {
+		ctx = util.ContextWithRequestID(ctx, requestID)
+	}
+
+	return ctx
+}
+
+// ack acknowledges the message and waits for watermill to send XACK. Watermill cancels the message
+// context once it is done with the message, so Close does not cancel the subscription mid-ack.
+func ack(msg *message.Message) bool {
+	if !msg.Ack() {
+		return false
+	}
+
+	if done := msg.Context().Done(); done != nil {
+		<-done
+	}
+
+	return true
+}
@@ -0,0 +1,606 @@
+package redissub_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill-redisstream/pkg/redisstream"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+	"github.com/thienhaole92/uframework/goredis"
+	"github.com/thienhaole92/uframework/redispub"
+	"github.com/thienhaole92/uframework/redissub"
+	"github.com/thienhaole92/uframework/testutil"
+	"github.com/thienhaole92/uframework/util"
+)
+
+var errHandler = errors.New("handler failed")
+
+func newTestRedis(ctx context.Context, t *testing.T) *goredis.Redis {
+	t.Helper()
+
+	container := testutil.SetupRedisContainer(ctx, t)
+
+	port, err := strconv.Atoi(container.Port.Port())
+	require.NoError(t, err)
+
+	return goredis.New(&goredis.Option{
+		Host:             container.Host,
+		Port:             port,
+		Username:         "",
+		Password:         "",
+		DB:               0,
+		DialTimeout:      5 * time.Second,
+		UseTLS:           false,
+		MaxIdleConns:     5,
+		MinIdleConns:     1,
+		PingTimeout:      2 * time.Second,
+		TTL:              time.Minute,
+		Mode:             goredis.ModeStandalone,
+		URL:              "",
+		Addrs:            nil,
+		MasterName:       "",
+		SentinelUsername: "",
+		SentinelPassword: "",
+		TLS:              nil,
+	})
+}
+
+// trackConcurrency returns a handler that sleeps and records the most calls seen at once per key.
+func trackConcurrency(key func(message.Payload) string) (redissub.MessageHandler, func(string) int32) {
+	var (
+		mux     sync.Mutex
+		running = map[string]int32{}
+		peak    = map[string]int32{}
+	)
+
+	handler := func(_ context.Context, msg *message.Message) error {
+		k := key(msg.Payload)
+
+		mux.Lock()
+		running[k]++
+		peak[k] = max(peak[k], running[k])
+		mux.Unlock()
+
+		time.Sleep(50 * time.Millisecond)
+
+		mux.Lock()
+		running[k]--
+		mux.Unlock()
+
+		return nil
+	}
+
+	return handler, func(k string) int32 {
+		mux.Lock()
+		defer mux.Unlock()
+
+		return peak[k]
+	}
+}
+
+func testOptions() redissub.Options {
+	return redissub.Options{
+		Retry: redissub.RetryPolicy{
+			MaxDeliveries: 3,
+			MinBackoff:    10 * time.Millisecond,
+			MaxBackoff:    50 * time.Millisecond,
+			Factor:        2,
+		},
+		DeadLetterTopic:        "",
+		Concurrency:            1,
+		PartitionKey:           nil,
+		DrainTimeout:           time.Second,
+		Middlewares:            nil,
+		PatternRefreshInterval: 100 * time.Millisecond,
+		// Keep the defaults.
+		Consumer:                  "",
+		BlockTime:                 0,
+		ReadBatchSize:             0,
+		ClaimInterval:             0,
+		ClaimBatchSize:            0,
+		MaxIdleTime:               0,
+		CheckConsumersInterval:    0,
+		ConsumerTimeout:           0,
+		OldestID:                  "",
+		ShouldClaimPendingMessage: nil,
+		ShouldStopOnReadErrors:    nil,
+	}
+}
+
+func startSubscriber(
+	t *testing.T,
+	rds *goredis.Redis,
+	topic string,
+	handler redissub.MessageHandler,
+	opts redissub.Options,
+) *redissub.Subscriber {
+	t.Helper()
+
+	subscriber, err := redissub.NewSubscriber(rds, "group", topic, handler, opts)
+	require.NoError(t, err)
+
+	started := make(chan error, 1)
+
+	go func() {
+		started <- subscriber.Start()
+	}()
+
+	t.Cleanup(func() {
+		require.NoError(t, subscriber.Close())
+		require.NoError(t, <-started)
+	})
+
+	return subscriber
+}
+
+func publish(t *testing.T, rds *goredis.Redis, topic string, contents ...string) {
+	t.Helper()
+
+	publisher, err := redispub.New(rds, redispub.Options{MaxStreamEntries: 0})
+	require.NoError(t, err)
+	require.NoError(t, publisher.PublishToTopic(topic, contents...))
+}
+
+func deadLetters(ctx context.Context, t *testing.T, rds *goredis.Redis, topic string) []*message.Message {
+	t.Helper()
+
+	entries, err := rds.XRange(ctx, topic, "-", "+").Result()
+	require.NoError(t, err)
+
+	messages := make([]*message.Message, 0, len(entries))
+
+	for _, entry := range entries {
+		msg, err := redisstream.DefaultMarshallerUnmarshaller{}.Unmarshal(entry.Values)
+		require.NoError(t, err)
+
+		messages = append(messages, msg)
+	}
+
+	return messages
+}
+
+func TestSubscriber_RetryThenSucceed(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	rds := newTestRedis(ctx, t)
+
+	var calls atomic.Int32
+
+	startSubscriber(t, rds, "orders", func(context.Context, *message.Message) error {
+		if calls.Add(1) < 3 {
+			return errHandler
+		}
+
+		return nil
+	}, testOptions())
+
+	publish(t, rds, "orders", "order")
+
+	require.Eventually(t, func() bool { return calls.Load() == 3 }, 5*time.Second, 10*time.Millisecond)
+
+	time.Sleep(100 * time.Millisecond)
+	require.Equal(t, int32(3), calls.Load())
+	require.Empty(t, deadLetters(ctx, t, rds, "orders.dlq"))
+}
+
+func TestSubscriber_DeadLetter(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	rds := newTestRedis(ctx, t)
+
+	var calls atomic.Int32
+
+	startSubscriber(t, rds, "orders", func(context.Context, *message.Message) error {
+		calls.Add(1)
+
+		return errHandler
+	}, testOptions())
+
+	publish(t, rds, "orders", "order")
+
+	require.Eventually(t, func() bool {
+		return len(deadLetters(ctx, t, rds, "orders.dlq")) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	dead := deadLetters(ctx, t, rds, "orders.dlq")[0]
+	require.Equal(t, "order", string(dead.Payload))
+	require.Equal(t, "orders", dead.Metadata.Get(redissub.MetadataDeadLetterTopic))
+	require.Equal(t, "3", dead.Metadata.Get(redissub.MetadataDeadLetterAttempts))
+	require.Contains(t, dead.Metadata.Get(redissub.MetadataDeadLetterError), errHandler.Error())
+	require.Len(t, redissub.ErrorHistory(dead), 3)
+	require.Equal(t, int32(3), calls.Load())
+}
+
+func TestSubscriber_PermanentError(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	rds := newTestRedis(ctx, t)
+
+	var calls atomic.Int32
+
+	startSubscriber(t, rds, "orders", func(context.Context, *message.Message) error {
+		calls.Add(1)
+
+		return redissub.Permanent(errHandler)
+	}, testOptions())
+
+	publish(t, rds, "orders", "order")
+
+	require.Eventually(t, func() bool {
+		return len(deadLetters(ctx, t, rds, "orders.dlq")) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, int32(1), calls.Load())
+}
+
+func TestSubscriber_ClaimExhausted(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	rds := newTestRedis(ctx, t)
+
+	publish(t, rds, "orders", "order")
+
+	// A consumer that crashes every time it handles the message, as many times as deliveries allow.
+	require.NoError(t, rds.XGroupCreateMkStream(ctx, "orders", "group", "0").Err())
+
+	streams, err := rds.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    "group",
+		Consumer: "crashed",
+		Streams:  []string{"orders", ">"},
+		Count:    1,
+		Block:    0,
+		NoAck:    false,
+	}).Result()
+	require.NoError(t, err)
+
+	id := streams[0].Messages[0].ID
+
+	for range testOptions().Retry.MaxDeliveries - 1 {
+		require.NoError(t, rds.XClaim(ctx, &redis.XClaimArgs{
+			Stream:   "orders",
+			Group:    "group",
+			Consumer: "crashed",
+			MinIdle:  0,
+			Messages: []string{id},
+		}).Err())
+	}
+
+	var calls atomic.Int32
+
+	opts := testOptions()
+	opts.ClaimInterval = 50 * time.Millisecond
+	opts.MaxIdleTime = 10 * time.Millisecond
+
+	startSubscriber(t, rds, "orders", func(context.Context, *message.Message) error {
+		calls.Add(1)
+
+		return nil
+	}, opts)
+
+	require.Eventually(t, func() bool {
+		return len(deadLetters(ctx, t, rds, "orders.dlq")) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	dead := deadLetters(ctx, t, rds, "orders.dlq")[0]
+	require.Equal(t, "3", dead.Metadata.Get(redissub.MetadataDeadLetterAttempts))
+	require.Contains(t, dead.Metadata.Get(redissub.MetadataDeadLetterError), redissub.ErrDeliveriesExhausted.Error())
+	require.Equal(t, int32(0), calls.Load())
+}
+
+func TestSubscriber_PoisonMessage(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	rds := newTestRedis(ctx, t)
+
+	var calls atomic.Int32
+
+	startSubscriber(t, rds, "orders", func(context.Context, *message.Message) error {
+		calls.Add(1)
+
+		return nil
+	}, testOptions())
+
+	// Not written by a watermill publisher, the message UUID is missing.
+	//nolint:exhaustruct
+	require.NoError(t, rds.XAdd(ctx, &redis.XAddArgs{Stream: "orders", Values: map[string]any{"foo": "bar"}}).Err())
+	publish(t, rds, "orders", "order")
+
+	require.Eventually(t, func() bool { return calls.Load() == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	dead := deadLetters(ctx, t, rds, "orders.dlq")
+	require.Len(t, dead, 1)
+	require.NotEmpty(t, dead[0].Metadata.Get(redissub.MetadataPoison))
+}
+
+func TestSubscriber_Concurrency(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	rds := newTestRedis(ctx, t)
+
+	handler, peak := trackConcurrency(func(message.Payload) string { return "" })
+
+	opts := testOptions()
+	opts.Concurrency = 4
+
+	startSubscriber(t, rds, "orders", handler, opts)
+	publish(t, rds, "orders", "1", "2", "3", "4", "5", "6", "7", "8")
+
+	require.Eventually(t, func() bool {
+		pending, err := rds.XPending(ctx, "orders", "group").Result()
+
+		return err == nil && pending.Count == 0 && peak("") > 1
+	}, 5*time.Second, 10*time.Millisecond)
+	require.LessOrEqual(t, peak(""), int32(4))
+}
+
+func TestSubscriber_ReadBatchSize(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	rds := newTestRedis(ctx, t)
+
+	publish(t, rds, "orders", "1", "2", "3", "4", "5", "6", "7", "8")
+
+	release := make(chan struct{})
+
+	var handled atomic.Int32
+
+	opts := testOptions()
+	opts.Concurrency = 4
+	opts.ReadBatchSize = 10
+
+	startSubscriber(t, rds, "orders", func(context.Context, *message.Message) error {
+		<-release
+		handled.Add(1)
+
+		return nil
+	}, opts)
+
+	pending := func() int64 {
+		summary, err := rds.XPending(ctx, "orders", "group").Result()
+		if err != nil {
+			return -1
+		}
+
+		return summary.Count
+	}
+
+	// Reads take no more messages than there are idle workers.
+	require.Eventually(t, func() bool { return pending() == 4 }, 5*time.Second, 10*time.Millisecond)
+	time.Sleep(200 * time.Millisecond)
+	require.Equal(t, int64(4), pending())
+
+	close(release)
+
+	require.Eventually(t, func() bool {
+		return handled.Load() == 8 && pending() == 0
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestSubscriber_PartitionKey(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	rds := newTestRedis(ctx, t)
+
+	partition := func(payload message.Payload) string { return string(payload[:1]) }
+	handler, peak := trackConcurrency(partition)
+
+	opts := testOptions()
+	opts.Concurrency = 4
+	opts.PartitionKey = func(msg *message.Message) string { return partition(msg.Payload) }
+
+	startSubscriber(t, rds, "orders", handler, opts)
+	publish(t, rds, "orders", "a1", "a2", "a3", "a4", "b1", "b2", "b3", "b4")
+
+	require.Eventually(t, func() bool {
+		pending, err := rds.XPending(ctx, "orders", "group").Result()
+
+		return err == nil && pending.Count == 0 && peak("a") == 1 && peak("b") == 1
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestSubscriber_PartitionKeyOrder(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	rds := newTestRedis(ctx, t)
+
+	var (
+		mux     sync.Mutex
+		handled []string
+		failed  bool
+	)
+
+	opts := testOptions()
+	opts.Concurrency = 4
+	opts.PartitionKey = func(msg *message.Message) string { return string(msg.Payload[:1]) }
+
+	startSubscriber(t, rds, "orders", func(_ context.Context, msg *message.Message) error {
+		mux.Lock()
+		defer mux.Unlock()
+
+		// The retry of a1 must still come before a2.
+		if string(msg.Payload) == "a1" && !failed {
+			failed = true
+
+			return errHandler
+		}
+
+		handled = append(handled, string(msg.Payload))
+
+		return nil
+	}, opts)
+	publish(t, rds, "orders", "a1", "a2", "b1", "a3", "b2")
+
+	require.Eventually(t, func() bool {
+		mux.Lock()
+		defer mux.Unlock()
+
+		return len(handled) == 5
+	}, 5*time.Second, 10*time.Millisecond)
+
+	var ofA []string
+
+	for _, payload := range handled {
+		if payload[0] == 'a' {
+			ofA = append(ofA, payload)
+		}
+	}
+
+	require.Equal(t, []string{"a1", "a2", "a3"}, ofA)
+}
+
+func TestSubscriber_DrainOnClose(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	rds := newTestRedis(ctx, t)
+
+	started := make(chan struct{})
+
+	var handled atomic.Bool
+
+	subscriber := startSubscriber(t, rds, "orders", func(context.Context, *message.Message) error {
+		close(started)
+		time.Sleep(200 * time.Millisecond)
+		handled.Store(true)
+
+		return nil
+	}, testOptions())
+
+	publish(t, rds, "orders", "order")
+	<-started
+
+	require.NoError(t, subscriber.Close())
+	require.True(t, handled.Load())
+
+	pending, err := rds.XPending(ctx, "orders", "group").Result()
+	require.NoError(t, err)
+	require.Zero(t, pending.Count)
+}
+
+func TestSubscriber_ConsumerOptions(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	rds := newTestRedis(ctx, t)
+
+	publish(t, rds, "orders", "old")
+
+	var (
+		mux      sync.Mutex
+		payloads []string
+	)
+
+	opts := testOptions()
+	opts.Consumer = "pod-1"
+	opts.OldestID = redissub.StartFromLatest
+
+	startSubscriber(t, rds, "orders", func(_ context.Context, msg *message.Message) error {
+		mux.Lock()
+		defer mux.Unlock()
+
+		payloads = append(payloads, string(msg.Payload))
+
+		return nil
+	}, opts)
+
+	require.Eventually(t, func() bool {
+		groups, err := rds.XInfoGroups(ctx, "orders").Result()
+
+		return err == nil && len(groups) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	publish(t, rds, "orders", "new")
+
+	require.Eventually(t, func() bool {
+		mux.Lock()
+		defer mux.Unlock()
+
+		return len(payloads) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, []string{"new"}, payloads)
+
+	consumers, err := rds.XInfoConsumers(ctx, "orders", "group").Result()
+	require.NoError(t, err)
+	require.Len(t, consumers, 1)
+	require.Equal(t, "pod-1", consumers[0].Name)
+}
+
+func TestSubscriber_Metadata(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	rds := newTestRedis(ctx, t)
+
+	received := make(chan string, 1)
+
+	startSubscriber(t, rds, "orders", func(ctx context.Context, msg *message.Message) error {
+		received <- msg.Metadata.Get(redispub.MetadataTenant) + "/" + util.RequestIDFromContext(ctx)
+
+		return nil
+	}, testOptions())
+
+	publisher, err := redispub.New(rds, redispub.Options{MaxStreamEntries: 0})
+	require.NoError(t, err)
+
+	pubCtx := util.ContextWithRequestID(ctx, "request-1")
+	pubCtx = redispub.ContextWithMetadata(pubCtx, message.Metadata{redispub.MetadataTenant: "acme"})
+	require.NoError(t, publisher.Publish(pubCtx, "orders", message.NewMessage("id", []byte("order"))))
+
+	select {
+	case value := <-received:
+		require.Equal(t, "acme/request-1", value)
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "message not received")
+	}
+}
+
+func TestSubscriber_StartError(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	rds := newTestRedis(ctx, t)
+
+	// A key of another type cannot be used as a stream.
+	require.NoError(t, rds.Set(ctx, "orders", "not a stream", 0).Err())
+
+	subscriber, err := redissub.NewSubscriber(rds, "group", "orders", func(context.Context, *message.Message) error {
+		return nil
+	}, testOptions())
+	require.NoError(t, err)
+
+	require.ErrorIs(t, subscriber.Start(), redissub.ErrSubscribeFailed)
+
+	// The subscriber can be started again once the topic is usable.
+	require.NoError(t, rds.Del(ctx, "orders").Err())
+
+	started := make(chan error, 1)
+
+	go func() {
+		started <- subscriber.Start()
+	}()
+
+	publish(t, rds, "orders", "order")
+	require.Eventually(t, func() bool {
+		infos, err := rds.XInfoGroups(ctx, "orders").Result()
+
+		return err == nil && len(infos) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, subscriber.Close())
+	require.NoError(t, <-started)
+}
@@ -1,8 +1,11 @@
 package runner
 
 import (
+	"errors"
+	"fmt"
 	"os"
 	"os/signal"
+	"slices"
 	"syscall"
 
 	"github.com/rs/zerolog/log"
@@ -22,28 +25,92 @@ type AppRunner interface {
 	Name() string
 }
 
+// HealthChecker reports whether a component still works, such as a subscriber that keeps failing.
+type HealthChecker interface {
+	Healthy() error
+}
+
+// healthReporter is implemented by servers exposing the health of the service, like metricserver.
+type healthReporter interface {
+	SetHealthCheck(check func() error)
+}
+
 type Runner struct {
-	container *container.Container
-	servers   []Server
-	runners   []AppRunner
+	container    *container.Container
+	servers      []Server
+	runners      []AppRunner
+	healthChecks map[string]HealthChecker
 }
 
 type Option func(*Runner)
 
 func New(opts ...Option) *Runner {
 	rnn := &Runner{
-		container: container.New(),
-		servers:   []Server{},
-		runners:   []AppRunner{},
+		container:    container.New(),
+		servers:      []Server{},
+		runners:      []AppRunner{},
+		healthChecks: map[string]HealthChecker{},
 	}
 
 	for _, opt := range opts {
 		opt(rnn)
 	}
 
+	for _, svr := range rnn.servers {
+		if reporter, ok := svr.(healthReporter); ok {
+			reporter.SetHealthCheck(rnn.Healthy)
+		}
+	}
+
 	return rnn
 }
 
+// Healthy returns the errors of the registered health checks, and of servers and app runners that
+// implement HealthChecker.
+func (r *Runner) Healthy() error {
+	var errs []error
+
+	names := make([]string, 0, len(r.healthChecks))
+	for name := range r.healthChecks {
+		names = append(names, name)
+	}
+
+	slices.Sort(names)
+
+	for _, name := range names {
+		if err := r.healthChecks[name].Healthy(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+
+	for _, svr := range r.servers {
+		if checker, ok := svr.(HealthChecker); ok {
+			if err := checker.Healthy(); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", serverName(svr), err))
+			}
+		}
+	}
+
+	for _, rnn := range r.runners {
+		if checker, ok := rnn.(HealthChecker); ok {
+			if err := checker.Healthy(); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", rnn.Name(), err))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// serverName names the server in health errors, by its Name method or else by its type.
+func serverName(svr Server) string {
+	if named, ok := svr.(interface{ Name() string }); ok {
+		return named.Name()
+	}
+
+	return fmt.Sprintf("%T", svr)
+}
+
 func (r *Runner) Run() {
 	for _, svr := range r.servers {
 		go svr.Run()
@@ -96,6 +163,16 @@ func WithAppRunner(svr AppRunner, name string) Option {
 	}
 }
 
+// WithHealthCheck makes the service unhealthy while check reports an error, for example a
+// redissub.MultiSubscriber whose subscriptions keep failing.
+func WithHealthCheck(check HealthChecker, name string) Option {
+	return func(r *Runner) {
+		r.healthChecks[name] = check
+
+		log.Info().Msgf("%s health check registered", name)
+	}
+}
+
 func WithHTTPServer(hook func(*container.Container) *httpserver.Server) Option {
 	return func(r *Runner) {
 		svr := hook(r.container)
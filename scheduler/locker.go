@@ -0,0 +1,86 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
+	"github.com/thienhaole92/uframework/goredis"
+	"github.com/thienhaole92/uframework/postgres"
+)
+
+const defaultLockTable = "scheduler_locks"
+
+// Locker claims the ticks of tasks, so that one replica runs each tick. A claim is never released,
+// it expires with ttl once the tick has passed, which keeps a replica whose clock is late from
+// running the tick again.
+type Locker interface {
+	// Claim reports whether the caller claimed key, false meaning another replica holds it.
+	Claim(ctx context.Context, key string, ttl time.Duration) (bool, error)
+}
+
+// RedisLocker claims ticks with SET NX.
+type RedisLocker struct {
+	redis *goredis.Redis
+}
+
+func NewRedisLocker(rds *goredis.Redis) *RedisLocker {
+	return &RedisLocker{redis: rds}
+}
+
+func (l *RedisLocker) Claim(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	claimed, err := l.redis.SetNX(ctx, key, time.Now().UnixMilli(), ttl).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to claim %s: %w", key, err)
+	}
+
+	return claimed, nil
+}
+
+// PostgresLocker claims ticks with rows of a table, expired rows being taken over.
+type PostgresLocker struct {
+	db    postgres.PgxIface
+	table string
+}
+
+// NewPostgresLocker creates the lock table when it does not exist, table defaults to scheduler_locks.
+func NewPostgresLocker(ctx context.Context, db postgres.PgxIface, table string) (*PostgresLocker, error) {
+	if table == "" {
+		table = defaultLockTable
+	}
+
+	table = pgx.Identifier{table}.Sanitize()
+
+	_, err := db.Exec(ctx, `CREATE TABLE IF NOT EXISTS `+table+` (
+		key TEXT PRIMARY KEY,
+		expires_at TIMESTAMPTZ NOT NULL
+	)`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create lock table %s: %w", table, err)
+	}
+
+	return &PostgresLocker{db: db, table: table}, nil
+}
+
+func (l *PostgresLocker) Claim(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	// Expired rows are left behind by ticks that passed, they are removed as other keys are claimed.
+	tag, err := l.db.Exec(ctx, `INSERT INTO `+l.table+` (key, expires_at)
+		VALUES ($1, now() + $2 * interval '1 millisecond')
+		ON CONFLICT (key) DO UPDATE SET expires_at = EXCLUDED.expires_at
+		WHERE `+l.table+`.expires_at < now()`, key, ttl.Milliseconds())
+	if err != nil {
+		return false, fmt.Errorf("failed to claim %s: %w", key, err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return false, nil
+	}
+
+	if _, err := l.db.Exec(ctx, `DELETE FROM `+l.table+` WHERE expires_at < now()`); err != nil {
+		log.Warn().Err(err).Str("table", l.table).Msg("Failed to remove expired claims")
+	}
+
+	return true, nil
+}
@@ -0,0 +1,114 @@
+package scheduler_test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/tracelog"
+	"github.com/stretchr/testify/require"
+	"github.com/thienhaole92/uframework/goredis"
+	"github.com/thienhaole92/uframework/postgres"
+	"github.com/thienhaole92/uframework/scheduler"
+	"github.com/thienhaole92/uframework/testutil"
+)
+
+func newTestRedis(ctx context.Context, t *testing.T) *goredis.Redis {
+	t.Helper()
+
+	container := testutil.SetupRedisContainer(ctx, t)
+
+	port, err := strconv.Atoi(container.Port.Port())
+	require.NoError(t, err)
+
+	return goredis.New(&goredis.Option{
+		Host:             container.Host,
+		Port:             port,
+		Username:         "",
+		Password:         "",
+		DB:               0,
+		DialTimeout:      5 * time.Second,
+		UseTLS:           false,
+		MaxIdleConns:     5,
+		MinIdleConns:     1,
+		PingTimeout:      2 * time.Second,
+		TTL:              time.Minute,
+		Mode:             goredis.ModeStandalone,
+		URL:              "",
+		Addrs:            nil,
+		MasterName:       "",
+		SentinelUsername: "",
+		SentinelPassword: "",
+		TLS:              nil,
+	})
+}
+
+func newTestPostgres(ctx context.Context, t *testing.T) *postgres.Postgres {
+	t.Helper()
+
+	container := testutil.SetupPostgresContainer(ctx, t)
+
+	pg := postgres.New(ctx, &postgres.Option{
+		URL: fmt.Sprintf("postgres://%s:%s@%s/%s?sslmode=disable",
+			container.User,
+			container.Password,
+			net.JoinHostPort(container.Host, container.Port.Port()),
+			container.Database,
+		),
+		MaxConnection:         5,
+		MinConnection:         1,
+		MaxConnectionIdleTime: time.Minute,
+		PingTimeout:           10 * time.Second,
+		LogLevel:              tracelog.LogLevelError,
+		TLS:                   nil,
+	})
+	t.Cleanup(pg.Close)
+
+	return pg
+}
+
+func TestLockers(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	pgLocker, err := scheduler.NewPostgresLocker(ctx, newTestPostgres(ctx, t), "")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		locker scheduler.Locker
+	}{
+		{"redis", scheduler.NewRedisLocker(newTestRedis(ctx, t))},
+		{"postgres", pgLocker},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			claimed, err := tt.locker.Claim(ctx, "scheduler:sync:1", 200*time.Millisecond)
+			require.NoError(t, err)
+			require.True(t, claimed)
+
+			claimed, err = tt.locker.Claim(ctx, "scheduler:sync:1", 200*time.Millisecond)
+			require.NoError(t, err)
+			require.False(t, claimed)
+
+			// Other ticks are claimed independently.
+			claimed, err = tt.locker.Claim(ctx, "scheduler:sync:2", 200*time.Millisecond)
+			require.NoError(t, err)
+			require.True(t, claimed)
+
+			// An expired claim can be taken again.
+			require.Eventually(t, func() bool {
+				claimed, err := tt.locker.Claim(ctx, "scheduler:sync:1", time.Minute)
+
+				return err == nil && claimed
+			}, 5*time.Second, 50*time.Millisecond)
+		})
+	}
+}
@@ -0,0 +1,329 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/robfig/cron/v3"
+	"github.com/rs/zerolog/log"
+	"github.com/thienhaole92/uframework/metricserver"
+)
+
+const (
+	defaultPrefix = "scheduler"
+
+	resultSuccess = "success"
+	resultFailure = "failure"
+	resultSkipped = "skipped"
+)
+
+var (
+	ErrEmptyTaskName   = errors.New("task name cannot be empty")
+	ErrNilTask         = errors.New("task cannot be nil")
+	ErrDuplicateTask   = errors.New("a task with the same name is scheduled")
+	ErrInvalidSchedule = errors.New("invalid schedule")
+	ErrSchedulerClosed = errors.New("scheduler is closed")
+	ErrTaskPanic       = errors.New("task panicked")
+)
+
+// Task is run on every tick of its schedule. Its context is cancelled when the scheduler is closed.
+type Task func(ctx context.Context) error
+
+type Options struct {
+	// Prefix prefixes the keys claimed with Locker, defaults to "scheduler".
+	Prefix string
+	// Locker lets one replica run each tick. Without it every replica runs every tick.
+	Locker Locker
+	// Location is the time zone of cron expressions without CRON_TZ, defaults to UTC.
+	Location   *time.Location
+	Registerer prometheus.Registerer
+}
+
+func (o *Options) setDefaults() {
+	if o.Prefix == "" {
+		o.Prefix = defaultPrefix
+	}
+
+	if o.Location == nil {
+		o.Location = time.UTC
+	}
+
+	if o.Registerer == nil {
+		o.Registerer = prometheus.DefaultRegisterer
+	}
+}
+
+// interval ticks at the multiples of its duration, so that replicas agree on the ticks.
+type interval time.Duration
+
+func (i interval) Next(t time.Time) time.Time {
+	return t.Truncate(time.Duration(i)).Add(time.Duration(i))
+}
+
+type task struct {
+	name     string
+	schedule cron.Schedule
+	run      Task
+}
+
+type metrics struct {
+	runs     *prometheus.CounterVec
+	lastRun  *prometheus.GaugeVec
+	duration *prometheus.GaugeVec
+	lastErr  *prometheus.GaugeVec
+}
+
+// Scheduler runs tasks on cron expressions or fixed intervals. A task runs once at a time: ticks
+// that pass while it runs are skipped. It implements runner.AppRunner.
+type Scheduler struct {
+	opts    Options
+	metrics metrics
+	tasks   map[string]*task
+	taskMux sync.Mutex // Protects tasks and running
+	running bool
+	ctx     context.Context //nolint:containedctx
+	cancel  context.CancelFunc
+	done    sync.WaitGroup
+}
+
+func New(opts Options) (*Scheduler, error) {
+	opts.setDefaults()
+
+	runs, err := metricserver.Register(opts.Registerer, prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name:        "scheduler_task_runs_total",
+		Help:        "Number of ticks per task and result, skipped ticks being run by another replica.",
+		Namespace:   "",
+		Subsystem:   "",
+		ConstLabels: nil,
+	}, []string{"task", "result"}))
+	if err != nil {
+		return nil, err
+	}
+
+	lastRun, err := registerGauge(opts.Registerer,
+		"scheduler_task_last_run_timestamp_seconds", "Unix time of the last run of a task.")
+	if err != nil {
+		return nil, err
+	}
+
+	duration, err := registerGauge(opts.Registerer,
+		"scheduler_task_last_duration_seconds", "Duration of the last run of a task.")
+	if err != nil {
+		return nil, err
+	}
+
+	lastErr, err := registerGauge(opts.Registerer,
+		"scheduler_task_last_error", "Whether the last run of a task failed.")
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &Scheduler{
+		opts: opts,
+		metrics: metrics{
+			runs:     runs,
+			lastRun:  lastRun,
+			duration: duration,
+			lastErr:  lastErr,
+		},
+		tasks:   make(map[string]*task),
+		taskMux: sync.Mutex{},
+		running: false,
+		ctx:     ctx,
+		cancel:  cancel,
+		done:    sync.WaitGroup{},
+	}, nil
+}
+
+func registerGauge(reg prometheus.Registerer, name, help string) (*prometheus.GaugeVec, error) {
+	return metricserver.Register(reg, prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name:        name,
+		Help:        help,
+		Namespace:   "",
+		Subsystem:   "",
+		ConstLabels: nil,
+	}, []string{"task"}))
+}
+
+// Cron runs task on a standard cron expression, such as "*/5 * * * *" or "@daily". The time zone
+// can be set with a CRON_TZ= prefix. "@every" expressions tick at the multiples of their duration.
+func (s *Scheduler) Cron(name, spec string, task Task) error {
+	schedule, err := cron.ParseStandard(spec)
+	if err != nil {
+		return fmt.Errorf("%w %q: %w", ErrInvalidSchedule, spec, err)
+	}
+
+	if delay, ok := schedule.(cron.ConstantDelaySchedule); ok {
+		schedule = interval(delay.Delay)
+	}
+
+	return s.add(name, schedule, task)
+}
+
+// Every runs task at the multiples of every, for example on the minute for time.Minute.
+func (s *Scheduler) Every(name string, every time.Duration, task Task) error {
+	if every <= 0 {
+		return fmt.Errorf("%w: interval must be positive", ErrInvalidSchedule)
+	}
+
+	return s.add(name, interval(every), task)
+}
+
+func (s *Scheduler) add(name string, schedule cron.Schedule, run Task) error {
+	if name == "" {
+		return ErrEmptyTaskName
+	}
+
+	if run == nil {
+		return ErrNilTask
+	}
+
+	s.taskMux.Lock()
+	defer s.taskMux.Unlock()
+
+	if s.ctx.Err() != nil {
+		return ErrSchedulerClosed
+	}
+
+	if _, ok := s.tasks[name]; ok {
+		return fmt.Errorf("%w: %s", ErrDuplicateTask, name)
+	}
+
+	tsk := &task{name: name, schedule: schedule, run: run}
+	s.tasks[name] = tsk
+
+	// Tasks added while running start right away.
+	if s.running {
+		s.start(tsk)
+	}
+
+	return nil
+}
+
+func (s *Scheduler) Name() string {
+	return "scheduler"
+}
+
+// Run runs the tasks until Close is called.
+func (s *Scheduler) Run() {
+	s.taskMux.Lock()
+
+	if s.running || s.ctx.Err() != nil {
+		s.taskMux.Unlock()
+
+		return
+	}
+
+	s.running = true
+
+	for _, tsk := range s.tasks {
+		s.start(tsk)
+	}
+
+	log.Info().Int("tasks", len(s.tasks)).Msg("Scheduler started")
+	s.taskMux.Unlock()
+
+	<-s.ctx.Done()
+}
+
+func (s *Scheduler) start(tsk *task) {
+	s.done.Add(1)
+
+	go func() {
+		defer s.done.Done()
+
+		s.loop(tsk)
+	}()
+}
+
+func (s *Scheduler) loop(tsk *task) {
+	for {
+		tick := tsk.schedule.Next(time.Now().In(s.opts.Location))
+		if tick.IsZero() {
+			log.Warn().Str("task", tsk.name).Msg("Task has no future ticks")
+
+			return
+		}
+
+		timer := time.NewTimer(time.Until(tick))
+
+		select {
+		case <-s.ctx.Done():
+			timer.Stop()
+
+			return
+		case <-timer.C:
+		}
+
+		s.runTick(tsk, tick)
+	}
+}
+
+func (s *Scheduler) runTick(tsk *task, tick time.Time) {
+	logger := log.With().Str("task", tsk.name).Time("tick", tick).Logger()
+
+	if s.opts.Locker != nil {
+		// The claim outlives the tick until the next one, so it cannot be claimed twice.
+		key := s.opts.Prefix + ":" + tsk.name + ":" + strconv.FormatInt(tick.UnixMilli(), 10)
+
+		claimed, err := s.opts.Locker.Claim(s.ctx, key, tsk.schedule.Next(tick).Sub(tick))
+		if err != nil {
+			if s.ctx.Err() == nil {
+				logger.Error().Err(err).Msg("Failed to claim tick, skipping it")
+			}
+
+			return
+		}
+
+		if !claimed {
+			s.metrics.runs.WithLabelValues(tsk.name, resultSkipped).Inc()
+
+			return
+		}
+	}
+
+	start := time.Now()
+	err := s.call(tsk)
+
+	s.metrics.lastRun.WithLabelValues(tsk.name).Set(float64(start.Unix()))
+	s.metrics.duration.WithLabelValues(tsk.name).Set(time.Since(start).Seconds())
+
+	if err != nil {
+		logger.Error().Err(err).Dur("duration", time.Since(start)).Msg("Task failed")
+		s.metrics.runs.WithLabelValues(tsk.name, resultFailure).Inc()
+		s.metrics.lastErr.WithLabelValues(tsk.name).Set(1)
+
+		return
+	}
+
+	s.metrics.runs.WithLabelValues(tsk.name, resultSuccess).Inc()
+	s.metrics.lastErr.WithLabelValues(tsk.name).Set(0)
+}
+
+func (s *Scheduler) call(tsk *task) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%w: %v", ErrTaskPanic, r)
+		}
+	}()
+
+	return tsk.run(s.ctx)
+}
+
+// Close cancels running tasks and waits for them to return.
+func (s *Scheduler) Close() {
+	s.taskMux.Lock()
+	s.cancel()
+	s.taskMux.Unlock()
+
+	s.done.Wait()
+
+	log.Info().Msg("Scheduler stopped")
+}
@@ -0,0 +1,201 @@
+package scheduler_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+	"github.com/thienhaole92/uframework/scheduler"
+)
+
+var errTask = errors.New("task error")
+
+// memoryLocker claims keys in process, standing in for Redis shared by replicas.
+type memoryLocker struct {
+	mux    sync.Mutex
+	claims map[string]time.Duration
+}
+
+func newMemoryLocker() *memoryLocker {
+	return &memoryLocker{mux: sync.Mutex{}, claims: make(map[string]time.Duration)}
+}
+
+func (l *memoryLocker) Claim(_ context.Context, key string, ttl time.Duration) (bool, error) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	if _, ok := l.claims[key]; ok {
+		return false, nil
+	}
+
+	l.claims[key] = ttl
+
+	return true, nil
+}
+
+func (l *memoryLocker) count() int {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	return len(l.claims)
+}
+
+func newScheduler(t *testing.T, locker scheduler.Locker, reg prometheus.Registerer) *scheduler.Scheduler {
+	t.Helper()
+
+	sched, err := scheduler.New(scheduler.Options{Prefix: "", Locker: locker, Location: nil, Registerer: reg})
+	require.NoError(t, err)
+
+	return sched
+}
+
+func TestScheduler_SingleReplica(t *testing.T) {
+	t.Parallel()
+
+	locker := newMemoryLocker()
+	reg := prometheus.NewRegistry()
+
+	var runs atomic.Int64
+
+	replicas := []*scheduler.Scheduler{newScheduler(t, locker, reg), newScheduler(t, locker, reg)}
+	for _, replica := range replicas {
+		require.NoError(t, replica.Every("sync", 50*time.Millisecond, func(context.Context) error {
+			runs.Add(1)
+
+			return nil
+		}))
+
+		go replica.Run()
+	}
+
+	require.Eventually(t, func() bool { return runs.Load() >= 3 }, 5*time.Second, 10*time.Millisecond)
+
+	for _, replica := range replicas {
+		replica.Close()
+	}
+
+	// Each tick was claimed once and run by the replica that claimed it.
+	require.Equal(t, int64(locker.count()), runs.Load())
+
+	// Labels are sorted by name: result, then task.
+	require.InDelta(t, float64(runs.Load()), metricValue(t, reg, "scheduler_task_runs_total", "success", "sync"), 0)
+	require.Positive(t, metricValue(t, reg, "scheduler_task_runs_total", "skipped", "sync"))
+}
+
+// metricValue returns the value of the counter or gauge name with the given label values.
+func metricValue(t *testing.T, reg *prometheus.Registry, name string, labels ...string) float64 {
+	t.Helper()
+
+	families, err := reg.Gather()
+	require.NoError(t, err)
+
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+
+		for _, metric := range family.GetMetric() {
+			values := make([]string, 0, len(metric.GetLabel()))
+			for _, label := range metric.GetLabel() {
+				values = append(values, label.GetValue())
+			}
+
+			if slices.Equal(values, labels) {
+				return metric.GetCounter().GetValue() + metric.GetGauge().GetValue()
+			}
+		}
+	}
+
+	return 0
+}
+
+func TestScheduler_Failure(t *testing.T) {
+	t.Parallel()
+
+	reg := prometheus.NewRegistry()
+	sched := newScheduler(t, nil, reg)
+
+	var runs atomic.Int64
+
+	require.NoError(t, sched.Every("fail", 20*time.Millisecond, func(context.Context) error {
+		if runs.Add(1) == 1 {
+			panic("boom")
+		}
+
+		return errTask
+	}))
+
+	go sched.Run()
+
+	require.Eventually(t, func() bool { return runs.Load() >= 2 }, 5*time.Second, 10*time.Millisecond)
+	sched.Close()
+
+	require.InDelta(t, float64(runs.Load()), metricValue(t, reg, "scheduler_task_runs_total", "failure", "fail"), 0)
+	require.InDelta(t, 1, metricValue(t, reg, "scheduler_task_last_error", "fail"), 0)
+	require.Positive(t, metricValue(t, reg, "scheduler_task_last_run_timestamp_seconds", "fail"))
+}
+
+func TestScheduler_CloseCancelsTasks(t *testing.T) {
+	t.Parallel()
+
+	sched := newScheduler(t, nil, prometheus.NewRegistry())
+
+	started := make(chan struct{}, 1)
+	stopped := make(chan error, 1)
+
+	require.NoError(t, sched.Every("block", 10*time.Millisecond, func(ctx context.Context) error {
+		started <- struct{}{}
+		<-ctx.Done()
+		stopped <- ctx.Err()
+
+		return ctx.Err()
+	}))
+
+	go sched.Run()
+
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "task not started")
+	}
+
+	sched.Close()
+	require.ErrorIs(t, <-stopped, context.Canceled)
+
+	require.ErrorIs(t, sched.Every("late", time.Second, func(context.Context) error { return nil }),
+		scheduler.ErrSchedulerClosed)
+}
+
+func TestScheduler_Add(t *testing.T) {
+	t.Parallel()
+
+	sched := newScheduler(t, nil, prometheus.NewRegistry())
+	t.Cleanup(sched.Close)
+
+	task := func(context.Context) error { return nil }
+
+	tests := []struct {
+		name    string
+		add     func() error
+		wantErr error
+	}{
+		{"cron", func() error { return sched.Cron("report", "CRON_TZ=Asia/Ho_Chi_Minh 0 8 * * *", task) }, nil},
+		{"descriptor", func() error { return sched.Cron("cleanup", "@hourly", task) }, nil},
+		{"every", func() error { return sched.Cron("refresh", "@every 5m", task) }, nil},
+		{"duplicate", func() error { return sched.Every("report", time.Minute, task) }, scheduler.ErrDuplicateTask},
+		{"invalid cron", func() error { return sched.Cron("bad", "61 * * * *", task) }, scheduler.ErrInvalidSchedule},
+		{"invalid interval", func() error { return sched.Every("bad", 0, task) }, scheduler.ErrInvalidSchedule},
+		{"empty name", func() error { return sched.Every("", time.Minute, task) }, scheduler.ErrEmptyTaskName},
+		{"nil task", func() error { return sched.Every("nil", time.Minute, nil) }, scheduler.ErrNilTask},
+	}
+
+	for _, tt := range tests {
+		require.ErrorIs(t, tt.add(), tt.wantErr, tt.name)
+	}
+}
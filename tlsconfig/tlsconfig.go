@@ -0,0 +1,282 @@
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrCertKeyPair     = errors.New("certificate and key files must be set together")
+	ErrLoadCertKey     = errors.New("failed to load certificate key pair")
+	ErrLoadCA          = errors.New("failed to load CA bundle")
+	ErrNoCertificates  = errors.New("no PEM certificates found in CA bundle")
+	ErrMissingCert     = errors.New("server TLS requires a certificate and key")
+	ErrMissingClientCA = errors.New("client authentication requires a CA bundle")
+	ErrVerifyPeer      = errors.New("failed to verify peer certificate")
+)
+
+// Option describes the TLS material of a client or server. Paths point to PEM files.
+type Option struct {
+	CAFile             string        // CA bundle used to verify the peer, the system pool is used when empty.
+	CertFile           string        // Certificate presented to the peer, the client certificate for mTLS.
+	KeyFile            string        // Private key of CertFile.
+	ServerName         string        // Overrides the name used to verify the server certificate.
+	InsecureSkipVerify bool          // Disables peer verification, only meant for local development.
+	MinVersion         uint16        // Minimum TLS version, defaults to TLS 1.2.
+	ClientAuth         bool          // Server side: require and verify client certificates against CAFile, which must be set.
+	ReloadInterval     time.Duration // How often the files are checked for rotation, zero disables reloading.
+}
+
+// NewClientConfig builds a tls.Config for outgoing connections.
+func NewClientConfig(opts *Option) (*tls.Config, error) {
+	rld, err := newReloader(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := baseConfig(opts)
+	cfg.ServerName = opts.ServerName
+	cfg.RootCAs = rld.pool
+	//nolint:gosec
+	cfg.InsecureSkipVerify = opts.InsecureSkipVerify
+
+	if rld.cert != nil {
+		cfg.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return rld.certificate(), nil
+		}
+	}
+
+	if opts.ReloadInterval > 0 && opts.CAFile != "" && !opts.InsecureSkipVerify {
+		// RootCAs cannot be swapped on a live config, so verification is done by hand
+		// against the most recently loaded bundle.
+		//nolint:gosec
+		cfg.InsecureSkipVerify = true
+		cfg.VerifyConnection = func(state tls.ConnectionState) error {
+			return verifyServer(state, rld.rootCAs(), opts.ServerName)
+		}
+	}
+
+	return cfg, nil
+}
+
+// NewServerConfig builds a tls.Config for listeners. CertFile and KeyFile are required, and so is
+// CAFile with ClientAuth, since client certificates would otherwise pass against the system pool.
+func NewServerConfig(opts *Option) (*tls.Config, error) {
+	if opts.CertFile == "" {
+		return nil, ErrMissingCert
+	}
+
+	if opts.ClientAuth && opts.CAFile == "" {
+		return nil, ErrMissingClientCA
+	}
+
+	rld, err := newReloader(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := baseConfig(opts)
+	cfg.GetCertificate = func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+		return rld.certificate(), nil
+	}
+
+	if opts.ClientAuth {
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+		cfg.ClientCAs = rld.pool
+		cfg.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			clone := cfg.Clone()
+			clone.ClientCAs = rld.rootCAs()
+			clone.GetConfigForClient = nil
+
+			return clone, nil
+		}
+	}
+
+	return cfg, nil
+}
+
+func baseConfig(opts *Option) *tls.Config {
+	minVersion := opts.MinVersion
+	if minVersion == 0 {
+		minVersion = tls.VersionTLS12
+	}
+
+	cfg := new(tls.Config)
+	cfg.MinVersion = minVersion
+
+	return cfg
+}
+
+func verifyServer(state tls.ConnectionState, roots *x509.CertPool, serverName string) error {
+	if len(state.PeerCertificates) == 0 {
+		return ErrVerifyPeer
+	}
+
+	if serverName == "" {
+		serverName = state.ServerName
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range state.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	var verifyOpts x509.VerifyOptions
+	verifyOpts.DNSName = serverName
+	verifyOpts.Roots = roots
+	verifyOpts.Intermediates = intermediates
+
+	if _, err := state.PeerCertificates[0].Verify(verifyOpts); err != nil {
+		return fmt.Errorf("%w: %w", ErrVerifyPeer, err)
+	}
+
+	return nil
+}
+
+// reloader keeps the certificate and CA bundle in memory and re-reads them when
+// their files change, checking at most once per interval.
+type reloader struct {
+	opts     *Option
+	cert     *tls.Certificate
+	pool     *x509.CertPool
+	modTimes map[string]time.Time
+	checked  time.Time
+	mux      sync.Mutex
+}
+
+func newReloader(opts *Option) (*reloader, error) {
+	if (opts.CertFile == "") != (opts.KeyFile == "") {
+		return nil, ErrCertKeyPair
+	}
+
+	rld := &reloader{
+		opts:     opts,
+		cert:     nil,
+		pool:     nil,
+		modTimes: map[string]time.Time{},
+		checked:  time.Now(),
+		mux:      sync.Mutex{},
+	}
+
+	if err := rld.load(); err != nil {
+		return nil, err
+	}
+
+	return rld, nil
+}
+
+func (r *reloader) certificate() *tls.Certificate {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	r.maybeReload()
+
+	return r.cert
+}
+
+func (r *reloader) rootCAs() *x509.CertPool {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	r.maybeReload()
+
+	return r.pool
+}
+
+func (r *reloader) maybeReload() {
+	if r.opts.ReloadInterval <= 0 || time.Since(r.checked) < r.opts.ReloadInterval {
+		return
+	}
+
+	r.checked = time.Now()
+
+	if !r.changed() {
+		return
+	}
+
+	if err := r.load(); err != nil {
+		log.Error().Err(err).Msg("Failed to reload TLS files, keeping the previous ones")
+
+		return
+	}
+
+	log.Info().Str("cert_file", r.opts.CertFile).Str("ca_file", r.opts.CAFile).Msg("TLS files reloaded")
+}
+
+func (r *reloader) changed() bool {
+	for _, file := range r.files() {
+		info, err := os.Stat(file)
+		if err != nil {
+			continue
+		}
+
+		if !info.ModTime().Equal(r.modTimes[file]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r *reloader) files() []string {
+	files := make([]string, 0, 3)
+
+	for _, file := range []string{r.opts.CertFile, r.opts.KeyFile, r.opts.CAFile} {
+		if file != "" {
+			files = append(files, file)
+		}
+	}
+
+	return files
+}
+
+func (r *reloader) load() error {
+	modTimes := make(map[string]time.Time, len(r.files()))
+
+	for _, file := range r.files() {
+		info, err := os.Stat(file)
+		if err != nil {
+			return err
+		}
+
+		modTimes[file] = info.ModTime()
+	}
+
+	cert := r.cert
+	pool := r.pool
+
+	if r.opts.CertFile != "" {
+		pair, err := tls.LoadX509KeyPair(r.opts.CertFile, r.opts.KeyFile)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrLoadCertKey, err)
+		}
+
+		cert = &pair
+	}
+
+	if r.opts.CAFile != "" {
+		pem, err := os.ReadFile(r.opts.CAFile)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrLoadCA, err)
+		}
+
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("%w: %s", ErrNoCertificates, r.opts.CAFile)
+		}
+	}
+
+	// Only swap once every file loaded, a half-written rotation keeps the previous material.
+	r.cert = cert
+	r.pool = pool
+	r.modTimes = modTimes
+
+	return nil
+}
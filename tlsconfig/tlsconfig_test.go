@@ -0,0 +1,282 @@
+package tlsconfig_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/thienhaole92/uframework/tlsconfig"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	//nolint:exhaustruct
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	//nolint:exhaustruct
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue writes a leaf certificate signed by the CA and returns the cert and key paths.
+func (ca *testCA) issue(t *testing.T, dir, name string) (string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	//nolint:exhaustruct
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certFile := filepath.Join(dir, name+".crt")
+	keyFile := filepath.Join(dir, name+".key")
+
+	//nolint:exhaustruct
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	//nolint:exhaustruct
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+
+	return certFile, keyFile
+}
+
+func handshake(t *testing.T, clientCfg, serverCfg *tls.Config) (*tls.ConnectionState, error) {
+	t.Helper()
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", serverCfg)
+	require.NoError(t, err)
+
+	defer listener.Close()
+
+	serverErr := make(chan error, 1)
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			serverErr <- err
+
+			return
+		}
+
+		defer conn.Close()
+
+		//nolint:forcetypeassert
+		serverErr <- conn.(*tls.Conn).Handshake()
+	}()
+
+	dialer := &tls.Dialer{NetDialer: nil, Config: clientCfg}
+
+	conn, err := dialer.DialContext(context.Background(), "tcp", listener.Addr().String())
+	if err != nil {
+		return nil, err
+	}
+
+	defer conn.Close()
+
+	if err := <-serverErr; err != nil {
+		return nil, err
+	}
+
+	//nolint:forcetypeassert
+	state := conn.(*tls.Conn).ConnectionState()
+
+	return &state, nil
+}
+
+func TestMutualTLS(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	ca := newTestCA(t, "ca")
+	caFile := filepath.Join(dir, "ca.pem")
+	require.NoError(t, os.WriteFile(caFile, ca.pem, 0o600))
+
+	serverCert, serverKey := ca.issue(t, dir, "server")
+	clientCert, clientKey := ca.issue(t, dir, "client")
+
+	serverCfg, err := tlsconfig.NewServerConfig(&tlsconfig.Option{
+		CAFile:             caFile,
+		CertFile:           serverCert,
+		KeyFile:            serverKey,
+		ServerName:         "",
+		InsecureSkipVerify: false,
+		MinVersion:         0,
+		ClientAuth:         true,
+		ReloadInterval:     0,
+	})
+	require.NoError(t, err)
+
+	clientCfg, err := tlsconfig.NewClientConfig(&tlsconfig.Option{
+		CAFile:             caFile,
+		CertFile:           clientCert,
+		KeyFile:            clientKey,
+		ServerName:         "localhost",
+		InsecureSkipVerify: false,
+		MinVersion:         0,
+		ClientAuth:         false,
+		ReloadInterval:     0,
+	})
+	require.NoError(t, err)
+
+	state, err := handshake(t, clientCfg, serverCfg)
+	require.NoError(t, err)
+	require.Equal(t, "server", state.PeerCertificates[0].Subject.CommonName)
+
+	// Without a client certificate the server must reject the connection.
+	anonymousCfg, err := tlsconfig.NewClientConfig(&tlsconfig.Option{
+		CAFile:             caFile,
+		CertFile:           "",
+		KeyFile:            "",
+		ServerName:         "localhost",
+		InsecureSkipVerify: false,
+		MinVersion:         0,
+		ClientAuth:         false,
+		ReloadInterval:     0,
+	})
+	require.NoError(t, err)
+
+	_, err = handshake(t, anonymousCfg, serverCfg)
+	require.Error(t, err)
+}
+
+func TestReloadOnRotation(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	oldCA := newTestCA(t, "old-ca")
+	caFile := filepath.Join(dir, "ca.pem")
+	require.NoError(t, os.WriteFile(caFile, oldCA.pem, 0o600))
+
+	serverCert, serverKey := oldCA.issue(t, dir, "server")
+
+	serverCfg, err := tlsconfig.NewServerConfig(&tlsconfig.Option{
+		CAFile:             "",
+		CertFile:           serverCert,
+		KeyFile:            serverKey,
+		ServerName:         "",
+		InsecureSkipVerify: false,
+		MinVersion:         0,
+		ClientAuth:         false,
+		ReloadInterval:     time.Millisecond,
+	})
+	require.NoError(t, err)
+
+	clientCfg, err := tlsconfig.NewClientConfig(&tlsconfig.Option{
+		CAFile:             caFile,
+		CertFile:           "",
+		KeyFile:            "",
+		ServerName:         "localhost",
+		InsecureSkipVerify: false,
+		MinVersion:         0,
+		ClientAuth:         false,
+		ReloadInterval:     time.Millisecond,
+	})
+	require.NoError(t, err)
+
+	_, err = handshake(t, clientCfg, serverCfg)
+	require.NoError(t, err)
+
+	// Rotate both the CA bundle and the server certificate in place.
+	newCA := newTestCA(t, "new-ca")
+	future := time.Now().Add(time.Minute)
+
+	require.NoError(t, os.WriteFile(caFile, newCA.pem, 0o600))
+	newCA.issue(t, dir, "server")
+
+	for _, file := range []string{caFile, serverCert, serverKey} {
+		require.NoError(t, os.Chtimes(file, future, future))
+	}
+
+	time.Sleep(5 * time.Millisecond)
+
+	state, err := handshake(t, clientCfg, serverCfg)
+	require.NoError(t, err)
+	require.Equal(t, "new-ca", state.PeerCertificates[0].Issuer.CommonName)
+}
+
+func TestInvalidOptions(t *testing.T) {
+	t.Parallel()
+
+	_, err := tlsconfig.NewClientConfig(&tlsconfig.Option{
+		CAFile:             "",
+		CertFile:           "client.crt",
+		KeyFile:            "",
+		ServerName:         "",
+		InsecureSkipVerify: false,
+		MinVersion:         0,
+		ClientAuth:         false,
+		ReloadInterval:     0,
+	})
+	require.ErrorIs(t, err, tlsconfig.ErrCertKeyPair)
+
+	_, err = tlsconfig.NewServerConfig(&tlsconfig.Option{
+		CAFile:             "",
+		CertFile:           "",
+		KeyFile:            "",
+		ServerName:         "",
+		InsecureSkipVerify: false,
+		MinVersion:         0,
+		ClientAuth:         false,
+		ReloadInterval:     0,
+	})
+	require.ErrorIs(t, err, tlsconfig.ErrMissingCert)
+
+	_, err = tlsconfig.NewServerConfig(&tlsconfig.Option{
+		CAFile:             "",
+		CertFile:           "server.crt",
+		KeyFile:            "server.key",
+		ServerName:         "",
+		InsecureSkipVerify: false,
+		MinVersion:         0,
+		ClientAuth:         true,
+		ReloadInterval:     0,
+	})
+	require.ErrorIs(t, err, tlsconfig.ErrMissingClientCA)
+}
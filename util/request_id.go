@@ -0,0 +1,17 @@
+package util
+
+import "context"
+
+type requestIDKey struct{}
+
+// ContextWithRequestID stores the request ID so it follows the request past the HTTP layer,
+// for instance into published messages.
+func ContextWithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+func RequestIDFromContext(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+
+	return requestID
+}
@@ -0,0 +1,178 @@
+package validator
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/shopspring/decimal"
+)
+
+// MinPasswordLength is the minimum number of characters of a strong password.
+const MinPasswordLength = 8
+
+//nolint:gochecknoglobals
+var slugRegex = regexp.MustCompile(`^[a-z0-9]+(?:-[a-z0-9]+)*$`)
+
+// Enum is implemented by types with a fixed set of values, such as string or int constants,
+// to be checked by the enum rule.
+type Enum interface {
+	IsValid() bool
+}
+
+type rule struct {
+	tag     string
+	fn      validator.Func
+	message string
+}
+
+// rules are the rules of RegisterRules. A nil fn only adds the message of a go-playground rule.
+func rules() []rule {
+	return []rule{
+		{"decimal", isDecimal, "{0} must be a valid decimal number"},
+		{"decimal_gt", compareDecimal(decimal.Decimal.GreaterThan), "{0} must be greater than {1}"},
+		{"decimal_gte", compareDecimal(decimal.Decimal.GreaterThanOrEqual), "{0} must be {1} or greater"},
+		{"decimal_lt", compareDecimal(decimal.Decimal.LessThan), "{0} must be less than {1}"},
+		{"decimal_lte", compareDecimal(decimal.Decimal.LessThanOrEqual), "{0} must be {1} or less"},
+		{"slug", isSlug, "{0} must contain only lower case letters, digits and single hyphens"},
+		{"password", isStrongPassword, fmt.Sprintf(
+			"{0} must be at least %d characters long and contain an upper case letter, a lower case letter, "+
+				"a digit and a symbol", MinPasswordLength)},
+		{"enum", isEnum, "{0} must be one of the allowed values"},
+		{"iso4217", nil, "{0} must be a valid ISO 4217 currency code"},
+		{"timezone", nil, "{0} must be a valid time zone"},
+	}
+}
+
+// RegisterRules adds the rules common to services, with their DefaultLocale messages:
+//   - decimal, decimal_gt, decimal_gte, decimal_lt and decimal_lte check strings and
+//     shopspring decimals, such as `validate:"decimal_gt=0,decimal_lte=100.5"`;
+//   - slug checks lower case words joined by single hyphens;
+//   - password checks MinPasswordLength characters with upper and lower case letters, a digit
+//     and a symbol;
+//   - enum checks values of types implementing Enum.
+//
+// It also adds the missing messages of the go-playground iso4217 and timezone rules, which with
+// e164 and ulid cover currency codes, time zones, phone numbers and ULIDs.
+func (v *Validator) RegisterRules() error {
+	v.Validator.RegisterCustomTypeFunc(decimalValue, decimal.Decimal{}, decimal.NullDecimal{})
+
+	for _, r := range rules() {
+		if r.fn == nil {
+			if err := v.RegisterMessage(DefaultLocale, r.tag, r.message); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if err := v.RegisterValidation(r.tag, r.fn, r.message); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// decimalValue validates decimals as their string, or as nil when null, so that omitempty and
+// required apply.
+func decimalValue(field reflect.Value) any {
+	switch value := field.Interface().(type) {
+	case decimal.Decimal:
+		return value.String()
+	case decimal.NullDecimal:
+		if !value.Valid {
+			return nil
+		}
+
+		return value.Decimal.String()
+	default:
+		return nil
+	}
+}
+
+func isDecimal(fl validator.FieldLevel) bool {
+	_, ok := parseDecimal(fl.Field())
+
+	return ok
+}
+
+// compareDecimal returns a rule comparing the field with the decimal parameter of the rule.
+func compareDecimal(compare func(decimal.Decimal, decimal.Decimal) bool) validator.Func {
+	return func(fl validator.FieldLevel) bool {
+		value, ok := parseDecimal(fl.Field())
+		if !ok {
+			return false
+		}
+
+		return compare(value, decimal.RequireFromString(fl.Param()))
+	}
+}
+
+func parseDecimal(field reflect.Value) (decimal.Decimal, bool) {
+	if field.Kind() != reflect.String {
+		return decimal.Decimal{}, false
+	}
+
+	value, err := decimal.NewFromString(field.String())
+	if err != nil {
+		return decimal.Decimal{}, false
+	}
+
+	return value, true
+}
+
+func isSlug(fl validator.FieldLevel) bool {
+	field := fl.Field()
+
+	return field.Kind() == reflect.String && slugRegex.MatchString(field.String())
+}
+
+func isStrongPassword(fl validator.FieldLevel) bool {
+	field := fl.Field()
+	if field.Kind() != reflect.String {
+		return false
+	}
+
+	password := field.String()
+	if utf8.RuneCountInString(password) < MinPasswordLength {
+		return false
+	}
+
+	var upper, lower, digit, symbol bool
+
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r):
+			symbol = true
+		}
+	}
+
+	return upper && lower && digit && symbol
+}
+
+func isEnum(fl validator.FieldLevel) bool {
+	field := fl.Field()
+
+	if enum, ok := field.Interface().(Enum); ok {
+		return enum.IsValid()
+	}
+
+	// IsValid may have a pointer receiver.
+	if field.CanAddr() {
+		if enum, ok := field.Addr().Interface().(Enum); ok {
+			return enum.IsValid()
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,114 @@
+package validator_test
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+	"github.com/thienhaole92/uframework/validator"
+)
+
+type Side string
+
+func (s Side) IsValid() bool {
+	return s == "buy" || s == "sell"
+}
+
+type Status int
+
+func (s *Status) IsValid() bool {
+	return *s >= 0 && *s <= 2
+}
+
+type Order struct {
+	Price    decimal.Decimal     `json:"price"     validate:"decimal_gt=0,decimal_lte=1000.5"`
+	Fee      decimal.NullDecimal `json:"fee"       validate:"omitempty,decimal_gte=0"`
+	Quantity string              `json:"quantity"  validate:"decimal,decimal_lt=10"`
+	Currency string              `json:"currency"  validate:"iso4217"`
+	Phone    string              `json:"phone"     validate:"e164"`
+	Slug     string              `json:"slug"      validate:"slug"`
+	Password string              `json:"password"  validate:"password"`
+	Timezone string              `json:"timezone"  validate:"timezone"`
+	ID       string              `json:"id"        validate:"ulid"`
+	Side     Side                `json:"side"      validate:"enum"`
+	Status   Status              `json:"status"    validate:"enum"`
+}
+
+func validOrder() Order {
+	return Order{
+		Price:    decimal.RequireFromString("1000.5"),
+		Fee:      decimal.NullDecimal{Decimal: decimal.Zero, Valid: false},
+		Quantity: "9.99",
+		Currency: "VND",
+		Phone:    "+84912345678",
+		Slug:     "spring-sale-2025",
+		Password: "S3cure!pass",
+		Timezone: "Asia/Ho_Chi_Minh",
+		ID:       "01ARZ3NDEKTSV4RRFFQ69G5FAV",
+		Side:     "buy",
+		Status:   2,
+	}
+}
+
+func TestRegisterRules(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		modify  func(*Order)
+		field   string
+		message string
+	}{
+		{"valid", func(*Order) {}, "", ""},
+		{"decimal gt", func(o *Order) { o.Price = decimal.Zero }, "price", "price must be greater than 0"},
+		{
+			"decimal lte", func(o *Order) { o.Price = decimal.RequireFromString("1000.51") },
+			"price", "price must be 1000.5 or less",
+		},
+		{
+			"null decimal gte", func(o *Order) { o.Fee = decimal.NewNullDecimal(decimal.NewFromInt(-1)) },
+			"fee", "fee must be 0 or greater",
+		},
+		{"decimal", func(o *Order) { o.Quantity = "1,5" }, "quantity", "quantity must be a valid decimal number"},
+		{"decimal lt", func(o *Order) { o.Quantity = "10" }, "quantity", "quantity must be less than 10"},
+		{"currency", func(o *Order) { o.Currency = "vnd" }, "currency", "currency must be a valid ISO 4217 currency code"},
+		{"phone", func(o *Order) { o.Phone = "0912345678" }, "phone", "phone must be a valid E.164 formatted phone number"},
+		{
+			"slug", func(o *Order) { o.Slug = "Spring--sale" },
+			"slug", "slug must contain only lower case letters, digits and single hyphens",
+		},
+		{
+			"password", func(o *Order) { o.Password = "s3cure!pass" }, "password",
+			"password must be at least 8 characters long and contain an upper case letter, " +
+				"a lower case letter, a digit and a symbol",
+		},
+		{"timezone", func(o *Order) { o.Timezone = "Local" }, "timezone", "timezone must be a valid time zone"},
+		{"ulid", func(o *Order) { o.ID = "01ARZ3NDEKTSV4RRFFQ69G5FAU!" }, "id", "id must be a valid ULID"},
+		{"enum", func(o *Order) { o.Side = "hold" }, "side", "side must be one of the allowed values"},
+		{"pointer enum", func(o *Order) { o.Status = 3 }, "status", "status must be one of the allowed values"},
+	}
+
+	validatorInstance := validator.DefaultRestValidator()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			order := validOrder()
+			tt.modify(&order)
+
+			// Status implements Enum with a pointer receiver, so validate an addressable order.
+			err := validatorInstance.Validate(&order)
+			if tt.field == "" {
+				require.NoError(t, err)
+
+				return
+			}
+
+			fields := validatorInstance.FieldErrors(err)
+			require.Len(t, fields, 1)
+			require.Equal(t, tt.field, fields[0].Field)
+			require.Equal(t, tt.message, fields[0].Message)
+		})
+	}
+}
@@ -1,17 +1,75 @@
 package validator
 
-import "github.com/go-playground/validator/v10"
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/locales"
+	"github.com/go-playground/locales/en"
+	ut "github.com/go-playground/universal-translator"
+	"github.com/go-playground/validator/v10"
+	entranslations "github.com/go-playground/validator/v10/translations/en"
+	"github.com/rs/zerolog/log"
+	"github.com/thienhaole92/uframework/apperror"
+)
+
+// DefaultLocale is the locale of messages when none of the requested locales is registered.
+const DefaultLocale = "en"
+
+var ErrUnknownLocale = errors.New("unknown locale")
+
+// fieldNameTags are the tags naming a field in requests, by precedence.
+//
+//nolint:gochecknoglobals
+var fieldNameTags = []string{"json", "query", "param", "form"}
 
 type Validator struct {
 	Validator *validator.Validate
+	// Translator holds the messages of the failed rules, per locale.
+	Translator *ut.UniversalTranslator
 }
 
+// DefaultRestValidator returns a validator that reports fields by their JSON name, or their query,
+// path or form parameter name, with English messages and the rules of RegisterRules.
 func DefaultRestValidator() *Validator {
-	r := &Validator{Validator: validator.New()}
+	english := en.New()
+
+	r := &Validator{
+		Validator:  validator.New(),
+		Translator: ut.New(english, english),
+	}
+
+	r.Validator.RegisterTagNameFunc(fieldName)
+
+	if err := r.AddLocale(english, entranslations.RegisterDefaultTranslations); err != nil {
+		log.Panic().Err(err).Msg("failed to register default validation messages")
+	}
+
+	if err := r.RegisterRules(); err != nil {
+		log.Panic().Err(err).Msg("failed to register validation rules")
+	}
 
 	return r
 }
 
+// fieldName returns the request name of a field, or an empty string to keep its Go name.
+func fieldName(field reflect.StructField) string {
+	for _, tag := range fieldNameTags {
+		name, _, _ := strings.Cut(field.Tag.Get(tag), ",")
+		if name == "-" {
+			return ""
+		}
+
+		if name != "" {
+			return name
+		}
+	}
+
+	return ""
+}
+
 func (v *Validator) Validate(i any) error {
 	if err := v.Validator.Struct(i); err != nil {
 		return err
@@ -19,3 +77,96 @@ func (v *Validator) Validate(i any) error {
 
 	return nil
 }
+
+// AddLocale adds the messages of a locale, registered by a function such as the
+// RegisterDefaultTranslations of the go-playground/validator translations packages.
+func (v *Validator) AddLocale(
+	locale locales.Translator,
+	register func(*validator.Validate, ut.Translator) error,
+) error {
+	if err := v.Translator.AddTranslator(locale, true); err != nil {
+		return fmt.Errorf("failed to add locale %s: %w", locale.Locale(), err)
+	}
+
+	trans, _ := v.Translator.GetTranslator(locale.Locale())
+
+	if err := register(v.Validator, trans); err != nil {
+		return fmt.Errorf("failed to register messages of locale %s: %w", locale.Locale(), err)
+	}
+
+	return nil
+}
+
+// RegisterValidation adds a rule with its DefaultLocale message. In messages, {0} is replaced by
+// the field name and {1} by the rule parameter.
+func (v *Validator) RegisterValidation(tag string, fn validator.Func, message string) error {
+	if err := v.Validator.RegisterValidation(tag, fn); err != nil {
+		return fmt.Errorf("failed to register rule %s: %w", tag, err)
+	}
+
+	return v.RegisterMessage(DefaultLocale, tag, message)
+}
+
+// RegisterMessage sets the message of a rule in a locale added before. In messages, {0} is
+// replaced by the field name and {1} by the rule parameter.
+func (v *Validator) RegisterMessage(locale, tag, message string) error {
+	trans, found := v.Translator.GetTranslator(locale)
+	if !found {
+		return fmt.Errorf("%w: %s", ErrUnknownLocale, locale)
+	}
+
+	err := v.Validator.RegisterTranslation(tag, trans, func(trans ut.Translator) error {
+		return trans.Add(tag, message, true)
+	}, func(trans ut.Translator, fieldErr validator.FieldError) string {
+		translated, err := trans.T(tag, fieldErr.Field(), fieldErr.Param())
+		if err != nil {
+			return fieldErr.Error()
+		}
+
+		return translated
+	})
+	if err != nil {
+		return fmt.Errorf("failed to register message of rule %s: %w", tag, err)
+	}
+
+	return nil
+}
+
+// RegisterStructValidation adds a validation of whole structs of the types of values, to check
+// rules across fields. Failures are reported with StructLevel.ReportError.
+func (v *Validator) RegisterStructValidation(fn validator.StructLevelFunc, values ...any) {
+	v.Validator.RegisterStructValidation(fn, values...)
+}
+
+// FieldErrors describes the failed rules of a validation error, with messages in the first of
+// locales that is registered, or in DefaultLocale. It returns nil for other errors.
+func (v *Validator) FieldErrors(err error, locales ...string) []apperror.FieldError {
+	var validationErrs validator.ValidationErrors
+	if !errors.As(err, &validationErrs) {
+		return nil
+	}
+
+	trans, _ := v.Translator.FindTranslator(locales...)
+
+	fields := make([]apperror.FieldError, 0, len(validationErrs))
+	for _, fieldErr := range validationErrs {
+		fields = append(fields, apperror.FieldError{
+			Field:   fieldPath(fieldErr),
+			Rule:    fieldErr.Tag(),
+			Param:   fieldErr.Param(),
+			Message: fieldErr.Translate(trans),
+		})
+	}
+
+	return fields
+}
+
+// fieldPath returns the path of the field within the validated struct, such as "address.city".
+func fieldPath(fieldErr validator.FieldError) string {
+	_, path, found := strings.Cut(fieldErr.Namespace(), ".")
+	if !found {
+		return fieldErr.Field()
+	}
+
+	return path
+}
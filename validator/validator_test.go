@@ -2,11 +2,15 @@ package validator_test
 
 import (
 	"errors"
+	"strings"
 	"testing"
 
+	"github.com/go-playground/locales/vi"
 	gvalidator "github.com/go-playground/validator/v10"
+	vitranslations "github.com/go-playground/validator/v10/translations/vi"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/thienhaole92/uframework/apperror"
 	"github.com/thienhaole92/uframework/validator"
 )
 
@@ -95,3 +99,106 @@ func TestValidate_AgeOutOfRange(t *testing.T) {
 	ok := errors.As(err, &validationErrors)
 	assert.True(t, ok)
 }
+
+type Address struct {
+	City    string `json:"city"     validate:"required"`
+	Country string `json:"country"  validate:"len=2"`
+	Street  string `json:"-"        validate:"required"`
+	Unit    string `query:"unit"    validate:"max=4"`
+	Comment string `validate:"max=8"`
+}
+
+type Signup struct {
+	Username string  `json:"username"         validate:"required,username"`
+	Password string  `json:"password"         validate:"required"`
+	Confirm  string  `json:"confirm_password"`
+	Address  Address `json:"address"`
+}
+
+func TestFieldErrors(t *testing.T) {
+	t.Parallel()
+
+	validatorInstance := validator.DefaultRestValidator()
+
+	err := validatorInstance.Validate(Address{
+		City:    "",
+		Country: "VNM",
+		Street:  "",
+		Unit:    "12345",
+		Comment: "too long comment",
+	})
+
+	require.Equal(t, []apperror.FieldError{
+		{Field: "city", Rule: "required", Param: "", Message: "city is a required field"},
+		{Field: "country", Rule: "len", Param: "2", Message: "country must be 2 characters in length"},
+		{Field: "Street", Rule: "required", Param: "", Message: "Street is a required field"},
+		{Field: "unit", Rule: "max", Param: "4", Message: "unit must be a maximum of 4 characters in length"},
+		{Field: "Comment", Rule: "max", Param: "8", Message: "Comment must be a maximum of 8 characters in length"},
+	}, validatorInstance.FieldErrors(err))
+
+	require.Nil(t, validatorInstance.FieldErrors(errors.New("not a validation error"))) //nolint:err113
+}
+
+func TestFieldErrors_Locale(t *testing.T) {
+	t.Parallel()
+
+	validatorInstance := validator.DefaultRestValidator()
+	require.NoError(t, validatorInstance.AddLocale(vi.New(), vitranslations.RegisterDefaultTranslations))
+
+	err := validatorInstance.Validate(Address{City: "", Country: "VN", Street: "1 Main", Unit: "", Comment: ""})
+
+	tests := []struct {
+		name    string
+		locales []string
+		message string
+	}{
+		{"registered", []string{"fr", "vi"}, "city không được bỏ trống"},
+		{"fallback", []string{"fr"}, "city is a required field"},
+		{"none", nil, "city is a required field"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			fields := validatorInstance.FieldErrors(err, tt.locales...)
+			require.Len(t, fields, 1)
+			require.Equal(t, tt.message, fields[0].Message)
+		})
+	}
+}
+
+func TestRegisterValidation(t *testing.T) {
+	t.Parallel()
+
+	validatorInstance := validator.DefaultRestValidator()
+
+	require.NoError(t, validatorInstance.RegisterValidation("username", func(fl gvalidator.FieldLevel) bool {
+		return !strings.ContainsAny(fl.Field().String(), " @")
+	}, "{0} may not contain spaces or @"))
+	require.NoError(t, validatorInstance.AddLocale(vi.New(), vitranslations.RegisterDefaultTranslations))
+	require.NoError(t, validatorInstance.RegisterMessage("vi", "username", "{0} không được chứa khoảng trắng hoặc @"))
+	require.ErrorIs(t, validatorInstance.RegisterMessage("fr", "username", "{0}"), validator.ErrUnknownLocale)
+
+	validatorInstance.RegisterStructValidation(func(sl gvalidator.StructLevel) {
+		signup, _ := sl.Current().Interface().(Signup)
+		if signup.Password != signup.Confirm {
+			sl.ReportError(signup.Confirm, "confirm_password", "Confirm", "eqfield", "password")
+		}
+	}, Signup{})
+
+	err := validatorInstance.Validate(Signup{
+		Username: "john doe",
+		Password: "secret",
+		Confirm:  "secrets",
+		Address:  Address{City: "Hanoi", Country: "VN", Street: "1 Main", Unit: "", Comment: ""},
+	})
+
+	require.Equal(t, []apperror.FieldError{
+		{Field: "username", Rule: "username", Param: "", Message: "username may not contain spaces or @"},
+		{Field: "confirm_password", Rule: "eqfield", Param: "password", Message: "confirm_password must be equal to password"},
+	}, validatorInstance.FieldErrors(err))
+
+	fields := validatorInstance.FieldErrors(err, "vi")
+	require.Equal(t, "username không được chứa khoảng trắng hoặc @", fields[0].Message)
+}